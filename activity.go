@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// activityEvent is a run that finished, or an action taken on a title.
+type activityEvent struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"` // "run" or "action"
+
+	// Runs.
+	Items    int `json:"items,omitempty"`
+	Found    int `json:"found,omitempty"`
+	Requests int `json:"requests,omitempty"`
+
+	// Actions.
+	Action string `json:"action,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Year   int    `json:"year,omitempty"`
+}
+
+// activityLog appends runs and actions to activity.jsonl in the state
+// directory, for the digest. All methods are no-ops on a nil log.
+type activityLog struct {
+	logger *logrus.Logger
+	path   string
+}
+
+func newActivityLog(logger *logrus.Logger, stateDir string) *activityLog {
+	return &activityLog{logger: logger, path: filepath.Join(stateDir, "activity.jsonl")}
+}
+
+func (a *activityLog) record(event activityEvent) {
+	if a == nil {
+		return
+	}
+	event.Time = time.Now()
+	if err := a.append(event); err != nil {
+		a.logger.WithField("error", err).Error("recording activity")
+	}
+}
+
+func (a *activityLog) recordAction(action string, item mediaItem) {
+	a.record(activityEvent{Kind: "action", Action: action, Title: item.Title, Year: item.Year})
+}
+
+func (a *activityLog) append(event activityEvent) error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(a.path))
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", a.path)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(event); err != nil {
+		return errors.Wrapf(err, "writing %s", a.path)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", a.path)
+}
+
+// since returns the events recorded after t.
+func (a *activityLog) since(t time.Time) ([]activityEvent, error) {
+	f, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", a.path)
+	}
+	defer f.Close()
+
+	var events []activityEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event activityEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, errors.Wrapf(err, "unmarshaling %s", a.path)
+		}
+		if event.Time.After(t) {
+			events = append(events, event)
+		}
+	}
+	return events, errors.Wrapf(scanner.Err(), "reading %s", a.path)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// arrClient talks to the v3 API shared by Radarr and Sonarr.
+type arrClient struct {
+	name    string
+	baseURL string
+	apiKey  string
+}
+
+type arrMedia struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Year   int    `json:"year"`
+	IMDbID string `json:"imdbId"`
+	TMDBID int    `json:"tmdbId"`
+	TVDBID int    `json:"tvdbId"`
+
+	Genres    []string `json:"genres"`
+	Monitored bool     `json:"monitored"`
+	Tags      []int    `json:"tags"`
+}
+
+// media returns every movie in Radarr or every series in Sonarr, with the
+// seasons Sonarr knows of.
+func (c *arrClient) media() ([]mediaItem, error) {
+	path := "/api/v3/movie"
+	if c.name == "Sonarr" {
+		path = "/api/v3/series"
+	}
+
+	var media []sonarrSeries
+	if err := c.get(path, &media); err != nil {
+		return nil, err
+	}
+
+	items := make([]mediaItem, 0, len(media))
+	for _, m := range media {
+		item := mediaItem{Section: c.name, Type: "movie", IMDbID: m.IMDbID, Title: m.Title, Year: m.Year, Genres: m.Genres}
+		if c.name == "Sonarr" {
+			item.Type = "show"
+		}
+		if m.TMDBID != 0 {
+			item.TMDBID = strconv.Itoa(m.TMDBID)
+		}
+		if m.TVDBID != 0 {
+			item.TVDBID = strconv.Itoa(m.TVDBID)
+		}
+		for _, season := range m.Seasons {
+			if season.SeasonNumber > 0 {
+				item.Seasons = append(item.Seasons, season.SeasonNumber)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+type arrExclusion struct {
+	TMDBID     int    `json:"tmdbId"`
+	MovieTitle string `json:"movieTitle"`
+	MovieYear  int    `json:"movieYear"`
+}
+
+// tmdbID returns the TMDB ID Radarr knows a movie by, looking it up when the
+// item doesn't carry one. It returns 0 when Radarr can't find the movie.
+func (c *arrClient) tmdbID(item mediaItem) (int, error) {
+	if id, err := strconv.Atoi(item.TMDBID); err == nil {
+		return id, nil
+	}
+
+	term := fmt.Sprintf("%s %d", item.Title, item.Year)
+	if item.IMDbID != "" {
+		term = "imdb:" + item.IMDbID
+	}
+	var matches []arrMedia
+	if err := c.get("/api/v3/movie/lookup?term="+url.QueryEscape(term), &matches); err != nil {
+		return 0, err
+	}
+	for _, m := range matches {
+		if item.IMDbID != "" || item.Year == 0 || m.Year == item.Year {
+			return m.TMDBID, nil
+		}
+	}
+	return 0, nil
+}
+
+// excludeStreamable adds every movie found on Netflix to Radarr's import
+// exclusion list, so list-based imports stop re-downloading them.
+func (c *arrClient) excludeStreamable(logger *logrus.Logger, cfg *config, activity *activityLog, results []checkResult, dryRun bool) {
+	var existing []arrExclusion
+	if err := c.get("/api/v3/exclusions", &existing); err != nil {
+		logger.WithField("error", err).Error("getting Radarr exclusions")
+		return
+	}
+	excluded := map[int]bool{}
+	for _, e := range existing {
+		excluded[e.TMDBID] = true
+	}
+
+	for _, result := range allowedResults(logger, cfg, actionRadarrExclude, results) {
+		item := result.Item
+		if item.Type == "show" {
+			continue
+		}
+		entry := logger.WithField("title", item.Title)
+		id, err := c.tmdbID(item)
+		if err != nil {
+			entry.WithField("error", err).Error("looking up movie in Radarr")
+			continue
+		}
+		if id == 0 {
+			entry.Warn("Radarr doesn't know this movie, not excluding it")
+			continue
+		}
+		if excluded[id] {
+			continue
+		}
+		if dryRun {
+			entry.Info("would add to Radarr import exclusions (dry run)")
+			continue
+		}
+
+		err = c.send("POST", "/api/v3/exclusions", arrExclusion{TMDBID: id, MovieTitle: item.Title, MovieYear: item.Year}, nil)
+		if err != nil {
+			entry.WithField("error", err).Error("adding Radarr exclusion")
+			continue
+		}
+		excluded[id] = true
+		entry.Info("added to Radarr import exclusions")
+		activity.recordAction(actionRadarrExclude, item)
+	}
+}
+
+func (c *arrClient) get(path string, v interface{}) error {
+	return c.send("GET", path, nil, v)
+}
+
+func (c *arrClient) send(method, path string, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "marshaling request")
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.baseURL, "/")+path, reader)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("X-Api-Key", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "calling %s", c.name)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("%s returned %s", c.name, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "decoding %s response", c.name)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// authConfig protects the dashboard and REST API served in serve mode.
+type authConfig struct {
+	// Mode is "basic" for HTTP basic auth against Username and the
+	// HTTP_PASSWORD secret, "header" to trust a user header set by an
+	// authenticating reverse proxy (e.g. oauth2-proxy or Authelia), or
+	// "none".
+	Mode     string `json:"mode"`
+	Username string `json:"username"`
+	// Header is the request header the proxy puts the authenticated user in.
+	// It defaults to X-Forwarded-User.
+	Header string `json:"header"`
+	// TrustedProxies are the addresses header auth is accepted from, so
+	// clients can't set the header themselves by going around the proxy.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// authenticator checks requests to the dashboard and REST API. Users
+// authenticated by basic or header auth can do everything; API clients send a
+// scoped token as "Authorization: Bearer <token>" instead.
+type authenticator struct {
+	logger   *logrus.Logger
+	cfg      authConfig
+	password string
+	proxies  *webhookVerifier
+	tokens   *tokenStore
+}
+
+func newAuthenticator(logger *logrus.Logger, cfg authConfig, password string, tokens *tokenStore) (*authenticator, error) {
+	a := &authenticator{logger: logger, cfg: cfg, password: password, tokens: tokens}
+	switch cfg.Mode {
+	case "", "none":
+	case "basic":
+		if cfg.Username == "" || password == "" {
+			return nil, errors.New("basic auth needs a username in the config and HTTP_PASSWORD in secrets.json")
+		}
+	case "header":
+		if a.cfg.Header == "" {
+			a.cfg.Header = "X-Forwarded-User"
+		}
+		if len(cfg.TrustedProxies) == 0 {
+			return nil, errors.New("header auth needs trusted_proxies")
+		}
+		var err error
+		a.proxies, err = newWebhookVerifier(logger, webhookConfig{AllowedSources: cfg.TrustedProxies}, "")
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unknown auth mode %q", cfg.Mode)
+	}
+	return a, nil
+}
+
+// authorize returns the authenticated user for a request, or the status to
+// reject it with: http.StatusUnauthorized when it isn't authenticated, or
+// http.StatusForbidden when its token doesn't have the given scope. With no
+// auth configured, everyone without a token is "anonymous".
+func (a *authenticator) authorize(r *http.Request, scope string) (string, int) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token, ok := a.tokens.lookup(strings.TrimPrefix(auth, "Bearer "))
+		if !ok {
+			return "", http.StatusUnauthorized
+		}
+		if !token.hasScope(scope) {
+			return "", http.StatusForbidden
+		}
+		return "token:" + token.Name, 0
+	}
+	if user := a.user(r); user != "" {
+		return user, 0
+	}
+	return "", http.StatusUnauthorized
+}
+
+// user returns the user authenticated by basic or header auth, or "".
+func (a *authenticator) user(r *http.Request) string {
+	switch a.cfg.Mode {
+	case "basic":
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return ""
+		}
+		userOK := subtle.ConstantTimeCompare([]byte(username), []byte(a.cfg.Username)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1
+		if !userOK || !passwordOK {
+			return ""
+		}
+		return username
+	case "header":
+		if !a.proxies.allowedSource(r) {
+			return ""
+		}
+		return r.Header.Get(a.cfg.Header)
+	default:
+		return "anonymous"
+	}
+}
+
+// wrap only lets requests through to next when they are authenticated and
+// allowed scope.
+func (a *authenticator) wrap(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, status := a.authorize(r, scope)
+		switch status {
+		case 0:
+			next.ServeHTTP(w, r)
+		case http.StatusForbidden:
+			a.logger.WithField("remote", r.RemoteAddr).WithField("path", r.URL.Path).WithField("scope", scope).Warn("rejecting token without the scope")
+			http.Error(w, "token lacks the "+scope+" scope", http.StatusForbidden)
+		default:
+			a.logger.WithField("remote", r.RemoteAddr).WithField("path", r.URL.Path).Warn("rejecting unauthenticated request")
+			if a.cfg.Mode == "basic" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="plex2netflix"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	})
+}
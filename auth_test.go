@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestServerRouteScopes(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	tokens, err := loadTokenStore(filepath.Join(t.TempDir(), "api_tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := tokens.create("home-assistant", []string{scopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan, err := tokens.create("cron", []string{scopeScan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := newAuthenticator(logger, authConfig{Mode: "basic", Username: "admin"}, "secret", tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dates, err := newDateFormatter("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{
+		logger:  logger,
+		cfg:     &config{dates: dates},
+		scan:    func([]checkResult) []checkResult { return nil },
+		apply:   func([]checkResult) {},
+		results: []checkResult{{Item: mediaItem{Title: "Okja", Year: 2017}, Found: true}},
+	}
+	mux := http.NewServeMux()
+	s.routes(mux, auth)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		basic  bool
+		want   int
+	}{
+		{"no credentials", "GET", "/api/results", "", false, http.StatusUnauthorized},
+		{"unknown token", "GET", "/api/results", "p2n_nope", false, http.StatusUnauthorized},
+		{"read token reads", "GET", "/api/results", read, false, http.StatusOK},
+		{"read token on dashboard", "GET", "/", read, false, http.StatusOK},
+		{"read token can't scan", "POST", "/api/scan", read, false, http.StatusForbidden},
+		{"read token can't apply actions", "POST", "/api/actions", read, false, http.StatusForbidden},
+		{"scan token scans", "POST", "/api/scan", scan, false, http.StatusAccepted},
+		{"scan token can't read", "GET", "/api/results", scan, false, http.StatusForbidden},
+		{"scan token can't apply actions", "POST", "/api/actions", scan, false, http.StatusForbidden},
+		{"basic auth reads", "GET", "/api/results", "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.basic {
+				req.SetBasicAuth("admin", "secret")
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// providerNames are the providers benchmark tries.
+var providerNames = []string{"unogs", "streaming-availability", "tmdb", "justwatch", "mock"}
+
+type knownAnswer struct {
+	item      mediaItem
+	country   string
+	onNetflix bool
+}
+
+// benchmarkSample is the default known-answer set: Netflix originals that
+// have stayed on Netflix everywhere, and exclusives of other services that
+// have never been on it.
+var benchmarkSample = []knownAnswer{
+	{mediaItem{Type: "movie", Title: "Bird Box", Year: 2018}, "us", true},
+	{mediaItem{Type: "movie", Title: "The Irishman", Year: 2019}, "us", true},
+	{mediaItem{Type: "movie", Title: "Roma", Year: 2018}, "us", true},
+	{mediaItem{Type: "movie", Title: "Extraction", Year: 2020}, "us", true},
+	{mediaItem{Type: "show", Title: "Stranger Things", Year: 2016}, "us", true},
+	{mediaItem{Type: "show", Title: "The Crown", Year: 2016}, "us", true},
+	{mediaItem{Type: "show", Title: "The Mandalorian", Year: 2019}, "us", false},
+	{mediaItem{Type: "show", Title: "Ted Lasso", Year: 2020}, "us", false},
+	{mediaItem{Type: "show", Title: "The Boys", Year: 2019}, "us", false},
+	{mediaItem{Type: "show", Title: "Game of Thrones", Year: 2011}, "us", false},
+}
+
+// readAnswers reads a known-answer set from a CSV file with Title, Year,
+// Type, Country and On Netflix ("yes" or "no") columns.
+func readAnswers(path string) ([]knownAnswer, error) {
+	records, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]knownAnswer, 0, len(records))
+	for _, record := range records {
+		year, _ := strconv.Atoi(record["Year"])
+		typ := strings.ToLower(record["Type"])
+		if typ == "" {
+			typ = "movie"
+		}
+		answers = append(answers, knownAnswer{
+			item:      mediaItem{Type: typ, Title: record["Title"], Year: year},
+			country:   strings.ToLower(record["Country"]),
+			onNetflix: strings.EqualFold(record["On Netflix"], "yes"),
+		})
+	}
+	return answers, nil
+}
+
+// countingTransport counts the requests that go through it, as a measure of
+// a provider's quota cost.
+type countingTransport struct {
+	requests int64
+	next     http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	return t.next.RoundTrip(req)
+}
+
+// runBenchmark implements the benchmark subcommand. It runs the known-answer
+// set through every provider that can be created with the current secrets.
+func runBenchmark(logger *logrus.Logger, cfg *config, secrets map[string]string, stateDir, answersPath string) {
+	answers := benchmarkSample
+	if answersPath != "" {
+		var err error
+		if answers, err = readAnswers(answersPath); err != nil {
+			logger.WithField("error", err).Fatal("reading known answers")
+		}
+	}
+	if len(answers) == 0 {
+		logger.Fatal("no known answers to benchmark with")
+	}
+
+	// Benchmark requests count against the same quotas as scans.
+	limiters := newLimiterPool(logger, cfg.Unogs, stateDir)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Provider\tAccuracy\tErrors\tMean latency\tRequests\tRequests per title\t\n")
+	for _, name := range providerNames {
+		// Without a cache every lookup costs what it would on a first run.
+		p, err := newProvider(logger, name, cfg, secrets, nil, limiters)
+		if err != nil {
+			logger.WithField("provider", name).WithField("error", err).Warn("skipping provider")
+			continue
+		}
+
+		counter := &countingTransport{next: httpClient.Transport}
+		if counter.next == nil {
+			counter.next = http.DefaultTransport
+		}
+		httpClient.Transport = counter
+		correct, failed, elapsed := 0, 0, time.Duration(0)
+		for _, answer := range answers {
+			start := time.Now()
+			m, err := p.findOnNetflix(answer.item, []string{answer.country}, nil)
+			elapsed += time.Since(start)
+			switch {
+			case err != nil:
+				failed++
+				logger.WithField("provider", name).WithField("title", answer.item.Title).WithField("error", err).Debug("benchmark lookup failed")
+			case m.Found == answer.onNetflix:
+				correct++
+			default:
+				logger.WithField("provider", name).WithField("title", answer.item.Title).WithField("expected", answer.onNetflix).Debug("benchmark answer was wrong")
+			}
+		}
+		httpClient.Transport = counter.next
+
+		fmt.Fprintf(w, "%s\t%.0f%%\t%d\t%s\t%d\t%.1f\t\n",
+			name,
+			100*float64(correct)/float64(len(answers)),
+			failed,
+			(elapsed / time.Duration(len(answers))).Round(time.Millisecond),
+			counter.requests,
+			float64(counter.requests)/float64(len(answers)),
+		)
+	}
+	w.Flush()
+	if err := limiters.save(); err != nil {
+		logger.WithField("error", err).Warn("saving request counts")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type cacheConfig struct {
+	// TTL is how long a cached lookup is trusted before the provider is asked
+	// again, e.g. "7d" (the default) or "12h". "0" turns the cache off.
+	TTL string `json:"ttl"`
+	// File defaults to cache.json in -state-dir.
+	File string `json:"file"`
+
+	ttl time.Duration
+}
+
+// path returns where the cache is kept.
+func (c cacheConfig) path(stateDir string) string {
+	if c.File != "" {
+		return c.File
+	}
+	return filepath.Join(stateDir, "cache.json")
+}
+
+type cacheEntry struct {
+	Value   []string  `json:"value"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// lookupCache keeps provider lookups across runs in the state directory, so
+// unchanged titles don't cost API quota every run. Keys are namespaced by
+// kind, e.g. "search:<title>|<year>|<year tolerance>|<type>" for the Netflix
+// ID of a search's best candidate and its score, and "countries:<netflix ID>"
+// for where an ID is available. A nil cache never hits.
+type lookupCache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+func loadCache(cfg cacheConfig, stateDir string) (*lookupCache, error) {
+	c := &lookupCache{path: cfg.path(stateDir), ttl: cfg.ttl, Entries: map[string]*cacheEntry{}}
+	bytes, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", c.path)
+	}
+	if err := json.Unmarshal(bytes, c); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", c.path)
+	}
+	return c, nil
+}
+
+// get returns the cached value for key if it was fetched within the TTL.
+func (c *lookupCache) get(key string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Entries[key]
+	if !ok || time.Since(entry.Fetched) > c.ttl {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (c *lookupCache) put(key string, value []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Entries == nil {
+		c.Entries = map[string]*cacheEntry{}
+	}
+	c.Entries[key] = &cacheEntry{Value: value, Fetched: time.Now()}
+}
+
+// prune removes the entries fetched more than olderThan ago and returns how
+// many it removed.
+func (c *lookupCache) prune(olderThan time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, entry := range c.Entries {
+		if time.Since(entry.Fetched) > olderThan {
+			delete(c.Entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *lookupCache) save() error {
+	if c == nil || c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bytes, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling cache")
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(c.path))
+	}
+	return errors.Wrapf(ioutil.WriteFile(c.path, bytes, 0644), "writing %s", c.path)
+}
+
+// manageCache implements the cache subcommand: stats, get <title>,
+// prune -older-than <age> and clear.
+func manageCache(logger *logrus.Logger, cfg *config, stateDir string, args []string) {
+	cache, err := loadCache(cfg.Cache, stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading cache")
+	}
+
+	if len(args) == 0 {
+		logger.Fatal("usage: plex2netflix cache stats|get <title>|prune -older-than <age>|clear|purge")
+	}
+	switch args[0] {
+	case "stats":
+		kinds := map[string]int{}
+		stale := 0
+		var oldest, newest time.Time
+		for key, entry := range cache.Entries {
+			kinds[strings.SplitN(key, ":", 2)[0]]++
+			if time.Since(entry.Fetched) > cache.ttl {
+				stale++
+			}
+			if oldest.IsZero() || entry.Fetched.Before(oldest) {
+				oldest = entry.Fetched
+			}
+			if entry.Fetched.After(newest) {
+				newest = entry.Fetched
+			}
+		}
+		fmt.Printf("%d entries in %s\n", len(cache.Entries), cache.path)
+		for _, kind := range []string{"search", "countries", "seasons"} {
+			fmt.Printf("  %s: %d\n", kind, kinds[kind])
+		}
+		fmt.Printf("  older than the %s TTL, refetched on the next run: %d\n", cache.ttl, stale)
+		if len(cache.Entries) > 0 {
+			fmt.Printf("  oldest: %s\n  newest: %s\n", cfg.dates.dateTime(oldest), cfg.dates.dateTime(newest))
+		}
+	case "get":
+		if len(args) < 2 {
+			logger.Fatal("usage: plex2netflix cache get <title>")
+		}
+		query := strings.ToLower(strings.Join(args[1:], " "))
+		var keys []string
+		for key := range cache.Entries {
+			if strings.HasPrefix(key, "search:") && strings.Contains(strings.ToLower(key), query) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entry := cache.Entries[key]
+			fmt.Printf("%s, fetched %s\n", strings.TrimPrefix(key, "search:"), cfg.dates.dateTime(entry.Fetched))
+			if len(entry.Value) == 0 {
+				fmt.Println("  no match on Netflix")
+			}
+			if len(entry.Value) == 0 {
+				continue
+			}
+			// The value is the best candidate's Netflix ID and its score,
+			// or only the ID for entries cached before scores were kept.
+			id, score := entry.Value[0], "1"
+			if len(entry.Value) > 1 {
+				score = entry.Value[1]
+			}
+			if countries, ok := cache.Entries["countries:"+id]; ok {
+				fmt.Printf("  netflix ID %s scoring %s, in %s, fetched %s\n", id, score, strings.Join(countries.Value, ","), cfg.dates.dateTime(countries.Fetched))
+			} else {
+				fmt.Printf("  netflix ID %s scoring %s\n", id, score)
+			}
+		}
+	case "prune":
+		fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+		var olderThan time.Duration
+		fs.Var((*ageValue)(&olderThan), "older-than", "remove entries fetched longer ago than this, e.g. 30d")
+		fs.Parse(args[1:])
+		if olderThan == 0 {
+			logger.Fatal("usage: plex2netflix cache prune -older-than <age>")
+		}
+		removed := cache.prune(olderThan)
+		if err := cache.save(); err != nil {
+			logger.WithField("error", err).Fatal("saving cache")
+		}
+		logger.WithField("removed", removed).WithField("kept", len(cache.Entries)).Info("pruned cache")
+	case "clear", "purge":
+		if err := os.Remove(cache.path); err != nil && !os.IsNotExist(err) {
+			logger.WithField("error", err).Fatal("clearing cache")
+		}
+		logger.WithField("removed", len(cache.Entries)).Info("cleared cache")
+	default:
+		logger.Fatal("usage: plex2netflix cache stats|get <title>|prune -older-than <age>|clear|purge")
+	}
+}
@@ -0,0 +1,792 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type checkResult struct {
+	Item  mediaItem `json:"item"`
+	Found bool      `json:"found"`
+	// NetflixID is the matched Netflix title, if any, and Countries are
+	// where it's available.
+	NetflixID string   `json:"netflix_id,omitempty"`
+	Countries []string `json:"countries,omitempty"`
+	// Confidence is how safe it is to delete the local copy of a found item,
+	// from 0 to 1.
+	Confidence float64 `json:"confidence"`
+	// NetflixSeasons are the seasons of a found show that Netflix has, when
+	// the provider knows them.
+	NetflixSeasons []int `json:"netflix_seasons,omitempty"`
+	// NetflixQuality is the best video quality Netflix streams a found item
+	// in, "sd", "hd" or "uhd", when the provider knows it.
+	NetflixQuality string `json:"netflix_quality,omitempty"`
+	// QualityVerdict is "local" when the local copy of a found item is
+	// better quality than Netflix's, or "netflix" when it isn't, if both
+	// are known.
+	QualityVerdict string `json:"quality_verdict,omitempty"`
+	// AudioLanguages and Subtitles are the languages Netflix offers a
+	// matched item in, in the countries asked about, when the provider
+	// knows them.
+	AudioLanguages []string `json:"audio_languages,omitempty"`
+	Subtitles      []string `json:"subtitles,omitempty"`
+	// AudioDescription and ClosedCaptions are whether Netflix offers a
+	// matched item with them in any of the countries asked about, when the
+	// provider knows.
+	AudioDescription bool `json:"audio_description,omitempty"`
+	ClosedCaptions   bool `json:"closed_captions,omitempty"`
+	// Expires is the last day a matched item streams in each country it's
+	// leaving, when the provider knows.
+	Expires map[string]time.Time `json:"expires,omitempty"`
+	// Leaving is the last day a found item streams in the countries asked
+	// about, when the provider knows it's leaving.
+	Leaving time.Time `json:"leaving,omitempty"`
+	// MatchScore is how sure the provider is that it matched the right title,
+	// from 0 to 1.
+	MatchScore float64 `json:"match_score,omitempty"`
+	// Services are the streaming services a found item is on, when services
+	// other than Netflix are checked.
+	Services []string `json:"services,omitempty"`
+	// Error is why the item couldn't be checked. Found is false then, but
+	// that doesn't mean the item isn't on Netflix.
+	Error string `json:"error,omitempty"`
+}
+
+// checker runs items through the availability pipeline.
+type checker struct {
+	logger   *logrus.Logger
+	provider provider
+	cfg      *config
+	tmdb     *tmdbClient
+	// olderThan skips items added to the library more recently than this, so
+	// the household gets to watch new media before it's flagged.
+	olderThan time.Duration
+	// explain logs how each item's decision was made.
+	explain bool
+	// history, when set, records every result in the availability timeline,
+	// and the results of each run are saved to stateDir.
+	history *historyStore
+	cache   *lookupCache
+	// limiters logs what's left of the RapidAPI quotas after each run.
+	limiters *limiterPool
+	tracer   *tracer
+	activity *activityLog
+	stateDir string
+	notifier *notifier
+	// followRemoved keeps checking titles that were on Netflix after they
+	// disappear from the input, e.g. because they were deleted, so that the
+	// user hears when they leave Netflix too.
+	followRemoved bool
+	// concurrency is how many items are looked up at once. The provider's
+	// rate limiter still applies across all of them.
+	concurrency int
+	// overrides pin titles to known Netflix IDs.
+	overrides overrides
+	// keep lists titles that are skipped entirely.
+	keep keepList
+	// table shows the results as a table at the end of the run, so each
+	// item's outcome is only logged at debug level.
+	table bool
+	// changesOnly logs each item's outcome at debug level too, for serve
+	// mode, which reports the changes between scans instead.
+	changesOnly bool
+	// failFast stops the run at the first item that can't be looked up,
+	// instead of carrying on and summarizing the errors at the end.
+	failFast bool
+
+	// mu guards the history and results while a run is in progress, so they
+	// can be flushed from a signal handler.
+	mu       sync.Mutex
+	results  []checkResult
+	journal  *os.File
+	complete bool
+	// requestsAtStart is the provider's request count when the run started.
+	requestsAtStart int
+	span            *span
+	// progress is shown while a run is checking items on a terminal.
+	progress *progressBar
+	// stream, when set, gets each result as a line of JSON as soon as it's
+	// checked.
+	stream io.Writer
+}
+
+func (c *checker) check(items []mediaItem) []checkResult {
+	logger, cfg := c.logger, c.cfg
+	c.start(len(items))
+	span := c.tracer.start("check").setInt("items", len(items))
+	defer span.end(nil)
+	defer func() {
+		if r := recover(); r != nil {
+			c.flush()
+			panic(r)
+		}
+	}()
+	c.span = span
+
+	// Copies of the same item, e.g. in several libraries, are looked up once.
+	cutoff := time.Now().Add(-c.olderThan)
+	var keys []string
+	copies := map[string][]mediaItem{}
+	for _, item := range items {
+		if c.olderThan > 0 && item.AddedAt.After(cutoff) {
+			logger.WithField("title", item.Title).WithField("added", cfg.dates.date(item.AddedAt)).Debug("skipping recently added item")
+			continue
+		}
+		if c.keep.has(item) {
+			logger.WithField("title", item.Title).WithField("section", item.Section).Info("skipping item on the keep list")
+			continue
+		}
+
+		key := item.key() + "|" + strings.Join(cfg.countriesFor(item.Section), ",")
+		if _, ok := copies[key]; ok {
+			logger.WithField("title", item.Title).WithField("section", item.Section).Debug("already checked a copy of this item")
+		} else {
+			keys = append(keys, key)
+		}
+		copies[key] = append(copies[key], item)
+	}
+
+	var queued []mediaItem
+	for _, key := range keys {
+		queued = append(queued, copies[key]...)
+	}
+	if c.stream != os.Stdout {
+		c.progress = newProgressBar(logger, queued)
+	}
+
+	checked := make(map[string]checkResult, len(keys))
+	var checkedMu sync.Mutex
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					c.flush()
+					panic(r)
+				}
+			}()
+			for key := range work {
+				first := copies[key][0]
+				result := c.lookup(first, cfg.countriesFor(first.Section))
+				c.add(result)
+				for _, item := range copies[key][1:] {
+					copied := result
+					copied.Item = item
+					c.add(copied)
+				}
+				checkedMu.Lock()
+				checked[key] = result
+				checkedMu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+	c.progress.finish()
+
+	if c.history != nil && c.followRemoved {
+		c.checkRemoved(checked)
+	}
+	c.mu.Lock()
+	c.complete = true
+	results := c.results
+	c.mu.Unlock()
+	span.setInt("found", countFound(results))
+	c.flush()
+	run := activityEvent{Time: time.Now(), Kind: "run", Items: len(results), Found: countFound(results), Requests: c.requests() - c.requestsAtStart}
+	c.activity.record(run)
+	if c.history != nil {
+		if err := c.history.recordRun(run); err != nil {
+			c.logger.WithField("error", err).Error("saving history")
+		}
+	}
+
+	c.reportDuplicates(results)
+	c.reportErrors(results)
+	c.reportLowConfidence(results)
+	c.reportReclaimable(results)
+	c.limiters.logRemaining()
+	return results
+}
+
+// start resets the results and opens the journal for a new run.
+func (c *checker) start(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = make([]checkResult, 0, size)
+	c.complete = false
+	c.requestsAtStart = c.requests()
+	if c.history == nil {
+		return
+	}
+	if err := os.MkdirAll(c.stateDir, 0755); err != nil {
+		c.logger.WithField("error", err).Error("creating state directory")
+		return
+	}
+	if n, err := recoverJournal(c.stateDir); err != nil {
+		c.logger.WithField("error", err).Warn("recovering results from the journal")
+	} else if n > 0 {
+		c.logger.WithField("results", n).Warn("recovered partial results of a run that was killed")
+	}
+	// The last complete run's results are kept to show what changed.
+	path := filepath.Join(c.stateDir, "results.json")
+	if saved, err := loadResults(path); err == nil && !saved.Partial {
+		if err := os.Rename(path, filepath.Join(c.stateDir, "results.previous.json")); err != nil {
+			c.logger.WithField("error", err).Warn("keeping previous results")
+		}
+	}
+	journal, err := os.Create(filepath.Join(c.stateDir, "results.journal"))
+	if err != nil {
+		c.logger.WithField("error", err).Error("creating results journal")
+		return
+	}
+	c.journal = journal
+}
+
+// add records a result, writing it to the journal straight away so that it
+// survives the process being killed.
+func (c *checker) add(result checkResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, result)
+	c.progress.advance(result.Item.Section)
+	if c.stream != nil {
+		if err := json.NewEncoder(c.stream).Encode(newExportRecord(result)); err != nil {
+			c.logger.WithField("error", err).Error("writing result")
+		}
+	}
+	if c.journal == nil {
+		return
+	}
+	if err := json.NewEncoder(c.journal).Encode(result); err != nil {
+		c.logger.WithField("error", err).Error("writing results journal")
+	}
+}
+
+// flush saves the history and the results checked so far. It's called at
+// the end of a run, and when a run is cut short by a signal, a fatal error
+// or a panic. The journal is removed once the results are saved.
+func (c *checker) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.tracer.flush(); err != nil {
+		c.logger.WithField("error", err).Warn("exporting traces")
+	}
+	if err := c.limiters.save(); err != nil {
+		c.logger.WithField("error", err).Warn("saving request counts")
+	}
+	if c.history == nil {
+		return
+	}
+	if err := c.history.save(); err != nil {
+		c.logger.WithField("error", err).Error("saving history")
+	}
+	if err := c.cache.save(); err != nil {
+		c.logger.WithField("error", err).Error("saving cache")
+	}
+	if err := saveResults(filepath.Join(c.stateDir, "results.json"), c.results, !c.complete); err != nil {
+		c.logger.WithField("error", err).Error("saving results")
+		return
+	}
+	if c.journal != nil {
+		c.journal.Close()
+		os.Remove(c.journal.Name())
+		c.journal = nil
+	}
+}
+
+// lookup checks a single item with the provider, logs the outcome and
+// records it in the history.
+func (c *checker) lookup(item mediaItem, countries []string) checkResult {
+	logger, cfg := c.logger, c.cfg
+	var ex *explanation
+	if c.explain {
+		ex = &explanation{}
+	}
+	span := c.tracer.startChild(c.span, "lookup").
+		setString("title", item.Title).
+		setInt("year", item.Year).
+		setString("library", item.Section).
+		setString("type", item.Type)
+	m, services, available, err := c.find(item, countries, ex)
+	found := m.Found
+	if err == nil {
+		span.setString("found", strconv.FormatBool(found))
+	}
+	span.end(err)
+	if ex != nil {
+		ex.log(logger, item)
+	}
+	if err != nil {
+		entry := logger.WithField("error", err).WithField("title", item.Title).WithField("year", item.Year)
+		if c.failFast {
+			entry.Fatal("finding on Netflix")
+		}
+		entry.Error("finding on Netflix, skipping")
+		return checkResult{Item: item, Error: err.Error()}
+	}
+
+	result := checkResult{Item: item, Found: found, NetflixID: m.NetflixID, Countries: m.Countries, Services: services}
+	if found && (!c.checkLanguages(&result, countries) || !c.checkAccessibility(&result, countries)) {
+		found, result.Found = false, false
+	}
+	if found {
+		result.MatchScore = m.Score
+		if result.MatchScore == 0 {
+			result.MatchScore = 1
+		}
+		result.Confidence = result.MatchScore
+		c.enrichRatings(&item)
+		result.Item = item
+		entry := logger.WithField("title", item.Title).WithField("countries", strings.Join(countries, ","))
+		if !cfg.netflixOnly() {
+			entry = entry.WithField("services", strings.Join(services, ","))
+		}
+		for source, rating := range item.Ratings {
+			entry = entry.WithField(source+"_rating", rating)
+		}
+		if !item.LastWatched.IsZero() {
+			entry = entry.WithField("last_watched", cfg.dates.date(item.LastWatched)).WithField("play_count", item.PlayCount)
+		}
+		c.checkQuality(&result, countries)
+		c.checkLeaving(&result, countries)
+		c.compareSeasons(&result, countries)
+		if item.Edition != "" {
+			result.Confidence *= editionConfidence
+			entry.WithField("edition", item.Edition).WithField("confidence", result.Confidence).
+				Warn("found on netflix, but netflix likely streams the theatrical cut")
+		} else if c.table || c.changesOnly {
+			entry.Debug("found on netflix")
+		} else {
+			entry.Info("found on netflix")
+		}
+	}
+	if c.history != nil {
+		// The history follows what the provider has, not what the
+		// requirement flags make of it, so that changing a flag between runs
+		// doesn't look like a title leaving Netflix.
+		c.mu.Lock()
+		_, changed := c.history.record(item, countries, available, time.Now())
+		c.mu.Unlock()
+		if changed && !available && c.notifier != nil {
+			c.notifier.notify(
+				"left_netflix",
+				fmt.Sprintf("%s (%d) has left Netflix. Re-acquire it if the local copy was deleted.", item.Title, item.Year),
+				map[string]interface{}{"title": item.Title, "year": item.Year, "countries": strings.Join(countries, ",")},
+			)
+		}
+	}
+
+	return result
+}
+
+// find looks the item up on every configured service. The match is
+// Netflix's when the item is on Netflix, or else the first other service's,
+// and services lists every service it's on when services other than Netflix
+// are checked. available reports whether any service has it in any of the
+// countries, before -all-countries is applied.
+func (c *checker) find(item mediaItem, countries []string, ex *explanation) (match netflixMatch, services []string, available bool, err error) {
+	for _, service := range c.cfg.Services {
+		var m netflixMatch
+		if id, ok := c.overrides.find(item); ok && service == "netflix" {
+			m, err = overrideMatch(c.provider, id, countries, ex)
+		} else if service == "netflix" {
+			m, err = c.provider.findOnNetflix(item, countries, ex)
+		} else if sp, ok := c.provider.(serviceProvider); ok {
+			m, err = sp.findOnService(item, countries, service, ex)
+		} else {
+			return match, nil, false, errors.Errorf("the provider only knows about netflix, not %s", service)
+		}
+		if err != nil {
+			return match, nil, false, err
+		}
+		available = available || m.Found
+		if c.cfg.CountryMatch == "all" && m.Countries != nil {
+			m.Found = containsAll(m.Countries, countries)
+			if !m.Found {
+				ex.decide("%s has it, but not in all of %s", service, strings.Join(countries, ","))
+			}
+		}
+		if m.Found {
+			services = append(services, service)
+			if !match.Found {
+				match = m
+			}
+		} else if service == "netflix" {
+			match = m
+		}
+	}
+	if c.cfg.netflixOnly() {
+		services = nil
+	}
+	return match, services, available, nil
+}
+
+// compareSeasons checks which of a found show's local seasons Netflix has.
+// When it only has some of them, the confidence drops to the share it has,
+// since deleting the show would lose the rest.
+func (c *checker) compareSeasons(result *checkResult, countries []string) {
+	sp, ok := c.provider.(seasonProvider)
+	if !ok || result.Item.Type != "show" || len(result.Item.Seasons) == 0 || result.NetflixID == "" {
+		return
+	}
+	seasons, err := sp.netflixSeasons(result.NetflixID, countries)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting Netflix seasons")
+		return
+	}
+	result.NetflixSeasons = seasons
+
+	onNetflix := map[int]bool{}
+	for _, s := range seasons {
+		onNetflix[s] = true
+	}
+	var missing []string
+	for _, s := range result.Item.Seasons {
+		if !onNetflix[s] {
+			missing = append(missing, strconv.Itoa(s))
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	result.Confidence *= float64(len(result.Item.Seasons)-len(missing)) / float64(len(result.Item.Seasons))
+	c.logger.WithField("title", result.Item.Title).
+		WithField("missing_seasons", strings.Join(missing, ",")).
+		WithField("confidence", result.Confidence).
+		Warn("found on netflix, but netflix doesn't have every season in the library")
+}
+
+// checkLanguages records the audio and subtitle languages Netflix offers a
+// found item in, and reports whether they include the required ones in any
+// of the countries asked about, or all of them when it has to be in all.
+func (c *checker) checkLanguages(result *checkResult, countries []string) bool {
+	required := len(c.cfg.RequireAudio) > 0 || len(c.cfg.RequireSubtitles) > 0
+	if !c.cfg.netflixOnly() && !containsAny(result.Services, []string{"netflix"}) {
+		return true
+	}
+	lp, ok := c.provider.(languageProvider)
+	if !ok || result.NetflixID == "" {
+		if required {
+			c.logger.WithField("title", result.Item.Title).Info("on netflix, but its languages aren't known")
+		}
+		return !required
+	}
+	audio, subtitles, err := lp.netflixLanguages(result.NetflixID)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting Netflix languages")
+		return !required
+	}
+	var satisfied, checked int
+	for _, country := range countries {
+		if !containsAny(result.Countries, []string{country}) {
+			continue
+		}
+		checked++
+		result.AudioLanguages = append(result.AudioLanguages, audio[country]...)
+		result.Subtitles = append(result.Subtitles, subtitles[country]...)
+		if containsAll(audio[country], c.cfg.RequireAudio) && containsAll(subtitles[country], c.cfg.RequireSubtitles) {
+			satisfied++
+		}
+	}
+	result.AudioLanguages, result.Subtitles = uniqueSorted(result.AudioLanguages), uniqueSorted(result.Subtitles)
+	ok = satisfied > 0
+	if c.cfg.CountryMatch == "all" {
+		ok = satisfied == checked
+	}
+	if !ok {
+		c.logger.WithField("title", result.Item.Title).
+			WithField("audio", strings.Join(result.AudioLanguages, ",")).
+			WithField("subtitles", strings.Join(result.Subtitles, ",")).
+			Info("on netflix, but not with the required audio or subtitles")
+	}
+	return ok
+}
+
+// checkAccessibility records whether Netflix offers a found item with audio
+// description and closed captions, and with require_audio_description set,
+// reports whether it has audio description in any of the countries asked
+// about, or all of them when it has to be in all.
+func (c *checker) checkAccessibility(result *checkResult, countries []string) bool {
+	required := c.cfg.RequireAudioDescription
+	if !c.cfg.netflixOnly() && !containsAny(result.Services, []string{"netflix"}) {
+		return true
+	}
+	ap, ok := c.provider.(accessibilityProvider)
+	if !ok || result.NetflixID == "" {
+		if required {
+			c.logger.WithField("title", result.Item.Title).Info("on netflix, but whether it has audio description isn't known")
+		}
+		return !required
+	}
+	features, err := ap.netflixAccessibility(result.NetflixID)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting Netflix accessibility features")
+		return !required
+	}
+	var described, checked int
+	for _, country := range countries {
+		if !containsAny(result.Countries, []string{country}) {
+			continue
+		}
+		checked++
+		f := features[country]
+		result.ClosedCaptions = result.ClosedCaptions || f.ClosedCaptions
+		if f.AudioDescription {
+			result.AudioDescription = true
+			described++
+		}
+	}
+	if !required {
+		return true
+	}
+	ok = described > 0
+	if c.cfg.CountryMatch == "all" {
+		ok = described == checked
+	}
+	if !ok {
+		c.logger.WithField("title", result.Item.Title).Info("on netflix, but without audio description")
+	}
+	return ok
+}
+
+// checkQuality records the best video quality Netflix streams a found item
+// in, if the provider knows it, and compares the local copy with it.
+func (c *checker) checkQuality(result *checkResult, countries []string) {
+	qp, ok := c.provider.(qualityProvider)
+	if !ok {
+		return
+	}
+	quality, err := qp.netflixQuality(result.Item, countries)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting Netflix video quality")
+		return
+	}
+	result.NetflixQuality = quality
+	verdict, reason := compareQuality(result.Item, quality)
+	result.QualityVerdict = verdict
+	if verdict == qualityLocal {
+		c.logger.WithField("title", result.Item.Title).
+			WithField("local_resolution", result.Item.Resolution).
+			WithField("netflix_quality", quality).
+			WithField("reason", reason).
+			Info("the local copy is better quality than netflix's")
+	}
+}
+
+// checkLeaving records when a found item leaves Netflix, if the provider
+// knows: the day it's gone from every country asked about it's in, or from
+// the first of them when it has to be in all of them.
+func (c *checker) checkLeaving(result *checkResult, countries []string) {
+	ep, ok := c.provider.(expiryProvider)
+	if !ok || result.NetflixID == "" {
+		return
+	}
+	expires, err := ep.netflixExpiry(result.NetflixID)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting Netflix expiry dates")
+		return
+	}
+	if len(expires) > 0 {
+		result.Expires = expires
+	}
+	var leaving time.Time
+	for _, country := range countries {
+		if !containsAny(result.Countries, []string{country}) {
+			continue
+		}
+		t, ok := expires[country]
+		if c.cfg.CountryMatch == "all" {
+			if ok && (leaving.IsZero() || t.Before(leaving)) {
+				leaving = t
+			}
+			continue
+		}
+		if !ok {
+			return
+		}
+		if t.After(leaving) {
+			leaving = t
+		}
+	}
+	result.Leaving = leaving
+	if !leaving.IsZero() {
+		c.logger.WithField("title", result.Item.Title).WithField("leaving", c.cfg.dates.date(leaving)).Info("leaving netflix")
+	}
+}
+
+// checkRemoved rechecks the titles that were on Netflix at the last run but
+// weren't part of this one.
+func (c *checker) checkRemoved(checked map[string]checkResult) {
+	seen := map[string]bool{}
+	for _, result := range checked {
+		seen[result.Item.key()] = true
+	}
+	for _, item := range c.history.availableItems() {
+		if !seen[item.key()] {
+			c.logger.WithField("title", item.Title).Debug("rechecking a title that's no longer in the library")
+			c.lookup(item, c.cfg.countriesFor(item.Section))
+		}
+	}
+}
+
+// reportDuplicates warns about found items that have more than one local
+// copy, either across libraries or as several files of the same item.
+func (c *checker) reportDuplicates(results []checkResult) {
+	copies := map[string][]mediaItem{}
+	var keys []string
+	for _, result := range results {
+		if !result.Found {
+			continue
+		}
+		key := result.Item.key()
+		if copies[key] == nil {
+			keys = append(keys, key)
+		}
+		copies[key] = append(copies[key], result.Item)
+	}
+
+	for _, key := range keys {
+		items := copies[key]
+		var sections, files []string
+		for _, item := range items {
+			sections = append(sections, item.Section)
+			files = append(files, item.Files...)
+		}
+		if len(items) < 2 && len(files) < 2 {
+			continue
+		}
+		c.logger.WithField("title", items[0].Title).
+			WithField("sections", strings.Join(sections, ",")).
+			WithField("files", strings.Join(files, ",")).
+			Warn("found on netflix with several local copies, keep at most one")
+	}
+}
+
+// reportReclaimable logs how much disk space removing everything found on
+// Netflix would free, per library and in total, from the sizes Plex reported.
+func (c *checker) reportReclaimable(results []checkResult) {
+	sizes := map[string]int64{}
+	var sections []string
+	var total int64
+	for _, result := range results {
+		item := result.Item
+		if !result.Found || item.Size == 0 {
+			continue
+		}
+		if _, ok := sizes[item.Section]; !ok {
+			sections = append(sections, item.Section)
+		}
+		sizes[item.Section] += item.Size
+		total += item.Size
+	}
+	if total == 0 {
+		return
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		c.logger.WithField("section", section).WithField("size", formatSize(sizes[section])).Info("could be freed in library")
+	}
+	c.logger.WithField("size", formatSize(total)).Info("could be freed by removing everything found on netflix")
+}
+
+// reportLowConfidence lists the found items whose titles didn't match
+// exactly, so the matches can be reviewed before acting on them.
+func (c *checker) reportLowConfidence(results []checkResult) {
+	for _, result := range results {
+		if result.Found && result.MatchScore < 1 {
+			c.logger.WithField("title", result.Item.Title).
+				WithField("year", result.Item.Year).
+				WithField("netflix_id", result.NetflixID).
+				WithField("match_score", fmt.Sprintf("%.2f", result.MatchScore)).
+				Warn("review this match, the title didn't match exactly")
+		}
+	}
+}
+
+// reportErrors summarizes the items that couldn't be checked, so they can
+// be retried rather than mistaken for titles that aren't on Netflix.
+func (c *checker) reportErrors(results []checkResult) {
+	var titles []string
+	for _, result := range results {
+		if result.Error != "" {
+			titles = append(titles, fmt.Sprintf("%s (%d)", result.Item.Title, result.Item.Year))
+		}
+	}
+	if len(titles) == 0 {
+		return
+	}
+	c.logger.WithField("errors", len(titles)).
+		WithField("checked", len(results)-len(titles)).
+		WithField("titles", strings.Join(titles, ", ")).
+		Warn("some items couldn't be checked, run again to retry them")
+}
+
+// requests returns how many API requests the provider has made, when it
+// counts them.
+func (c *checker) requests() int {
+	if counter, ok := c.provider.(requestCounter); ok {
+		return counter.requests()
+	}
+	return 0
+}
+
+func countFound(results []checkResult) int {
+	found := 0
+	for _, result := range results {
+		if result.Found {
+			found++
+		}
+	}
+	return found
+}
+
+// reportToSource logs the checked titles that aren't streamable, for list
+// inputs where the question is what still needs to be acquired.
+func reportToSource(logger *logrus.Logger, results []checkResult) {
+	missing := 0
+	for _, result := range results {
+		if !result.Found && result.Error == "" {
+			logger.WithField("title", result.Item.Title).WithField("year", result.Item.Year).Info("not on netflix, needs sourcing")
+			missing++
+		}
+	}
+	logger.WithField("streamable", countFound(results)).WithField("to_source", missing).Info("finished checking list")
+}
+
+// enrichRatings adds the TMDB rating to found items when Plex didn't
+// provide one and a TMDB API key is configured.
+func (c *checker) enrichRatings(item *mediaItem) {
+	if c.tmdb == nil || item.Ratings["tmdb"] != 0 {
+		return
+	}
+	rating, err := c.tmdb.rating(*item)
+	if err != nil {
+		c.logger.WithField("error", err).WithField("title", item.Title).Warn("getting TMDB rating")
+		return
+	}
+	if rating == 0 {
+		return
+	}
+	if item.Ratings == nil {
+		item.Ratings = map[string]float64{}
+	}
+	item.Ratings["tmdb"] = rating
+}
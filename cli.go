@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand, as listed in the usage message.
+type command struct {
+	name string
+	args string
+	help string
+	// ownFlags commands parse the flags after them themselves.
+	ownFlags bool
+}
+
+var commands = []command{
+	{name: "scan", help: "check the Plex libraries, the default"},
+	{name: "check", args: "<title> [-year <year>]", help: "check one title on Netflix, without Plex"},
+	{name: "scan-dir", args: "<directory>", help: "check the media files in a directory"},
+	{name: "letterboxd", args: "<watchlist.csv>", help: "check a Letterboxd export"},
+	{name: "imdb", args: "<export.csv>", help: "check an IMDb list export"},
+	{name: "trakt", args: "watchlist|collection", help: "check a Trakt list"},
+	{name: "simkl", args: "[list]", help: "check a Simkl list"},
+	{name: "watchlist", help: "check the plex.tv watchlist"},
+	{name: "radarr", help: "check the movies in Radarr"},
+	{name: "sonarr", help: "check the series in Sonarr"},
+	{name: "serve", args: "[-interval <interval|cron expression>]", help: "keep running, scanning on a schedule and reporting what changed"},
+	{name: "report", args: "[diff]", help: "print the last run's results as a table, or in -format, or what changed since the run before"},
+	{name: "history", args: "[-since <age>] [-trend|-on-netflix] [title]", help: "show titles' Netflix availability over time", ownFlags: true},
+	{name: "stats", help: "break the last run's results down by library, genre, decade and resolution"},
+	{name: "diff", args: "<old.json> <new.json>", help: "compare two results files"},
+	{name: "export", args: "<results.csv|xlsx|json|ndjson|html|md>", help: "write the last run's results to a file"},
+	{name: "cache", args: "stats|get <title>|prune -older-than <age>|clear|purge", help: "inspect or empty the lookup cache", ownFlags: true},
+	{name: "undo", args: "[title]", help: "restore files from -quarantine-dir"},
+	{name: "benchmark", args: "[titles.csv]", help: "compare the providers on known titles"},
+	{name: "digest", args: "[-since <age>]", help: "email a summary of recent changes", ownFlags: true},
+	{name: "login", help: "sign in to plex.tv and save the Plex token"},
+	{name: "token", args: "create <name> <scopes>|list|revoke <name>", help: "manage REST API tokens", ownFlags: true},
+	{name: "version", help: "print the version"},
+}
+
+// parseCommand returns the subcommand, "scan" when there's none, and its
+// arguments. Flags can come before or after the subcommand, e.g.
+// "plex2netflix scan -country us", except for commands with their own flags.
+func parseCommand() (string, []string) {
+	if flag.NArg() == 0 {
+		return "scan", nil
+	}
+	name, rest := flag.Arg(0), flag.Args()[1:]
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cmd.ownFlags {
+		return name, rest
+	}
+	var args []string
+	for {
+		flag.CommandLine.Parse(rest)
+		rest = flag.Args()
+		if len(rest) == 0 {
+			return name, args
+		}
+		args, rest = append(args, rest[0]), rest[1:]
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: plex2netflix [flags] [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", c.name, c.help)
+		if c.args != "" {
+			fmt.Fprintf(out, "  %-12s   %s %s\n", "", c.name, c.args)
+		}
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
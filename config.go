@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// config is read from the JSON or YAML file given with -config, or
+// PLEX2NETFLIX_CONFIG. Every setting is optional, environment variables
+// override the file (see configEnv), and flags override both.
+type config struct {
+	// Plex is where the Plex server is.
+	Plex plexConfig `json:"plex"`
+	// StateDir, Output, Out and Concurrency are defaults for the flags of the
+	// same names.
+	StateDir    string `json:"state_dir"`
+	Output      string `json:"output"`
+	Out         string `json:"out"`
+	Concurrency int    `json:"concurrency"`
+	// CountryBreakdown is the default for -country-breakdown.
+	CountryBreakdown bool `json:"country_breakdown"`
+	// Countries are the Netflix catalogs a title is looked up in, as ISO
+	// 3166-1 alpha-2 codes.
+	Countries []string `json:"countries"`
+	// Services are the streaming services to check: netflix (the default),
+	// prime, disney+, hulu and max. A title counts as found when it's on any
+	// of them.
+	Services []string `json:"services"`
+	// OverridesFile is a JSON file pinning titles to Netflix IDs, see
+	// overrides.
+	OverridesFile string `json:"overrides_file"`
+	// KeepFile lists titles that are never checked, see keepList.
+	KeepFile string `json:"keep_file"`
+	// MinConfidence is the lowest score, from 0 to 1, a title search result
+	// can have and still be taken as the item. It defaults to 0.85.
+	MinConfidence float64 `json:"min_confidence"`
+	// YearTolerance is how many years a search result's year can differ from
+	// the item's by. It defaults to 1.
+	YearTolerance *int `json:"year_tolerance"`
+	// LeavingWithin keeps actions away from titles leaving Netflix within
+	// this long, e.g. "30d", so local copies of them aren't deleted.
+	LeavingWithin string `json:"leaving_within"`
+	// RequireQuality keeps actions away from titles Netflix doesn't stream in
+	// at least this video quality, "sd", "hd" or "uhd", so a 4K copy isn't
+	// replaced by an SD stream. Titles whose Netflix quality isn't known are
+	// held back too.
+	RequireQuality string `json:"require_quality"`
+	// RequireAudio and RequireSubtitles are languages, as ISO 639-1 codes
+	// like "ja" or names like "Japanese", that Netflix must offer a title in
+	// for it to count as found in a country. Titles whose languages the
+	// provider doesn't know never do while they're set.
+	RequireAudio     []string `json:"require_audio"`
+	RequireSubtitles []string `json:"require_subtitles"`
+	// RequireAudioDescription only counts titles as found in countries where
+	// Netflix offers them with audio description.
+	RequireAudioDescription bool `json:"require_audio_description"`
+	// CountryMatch is "any" (the default) to count a title as found if it's
+	// in any of the countries, or "all" to require every one of them.
+	CountryMatch string `json:"country_match"`
+	// Libraries holds per-library overrides keyed by library (section) name.
+	Libraries map[string]libraryConfig `json:"libraries"`
+	// Timezone is an IANA zone name like "Europe/Berlin" used when printing
+	// dates. It defaults to the local timezone.
+	Timezone string `json:"timezone"`
+	// Locale is a language tag like "en-GB" that picks the date format. It
+	// defaults to ISO 8601 dates.
+	Locale string `json:"locale"`
+	// UserAgent is sent with every outbound request. It defaults to one that
+	// identifies the plex2netflix build.
+	UserAgent string `json:"user_agent"`
+	// Unogs configures the uNoGS provider.
+	Unogs unogsConfig `json:"unogs"`
+	// Webhook restricts who can post to the webhook listener. The shared
+	// secret is WEBHOOK_SECRET in secrets.json.
+	Webhook webhookConfig `json:"webhook"`
+	// Auth protects the dashboard and REST API.
+	Auth authConfig `json:"auth"`
+	// Notify configures where notifications are sent.
+	Notify notifyConfig `json:"notify"`
+	// Policies restrict the actions taken on items by genre.
+	Policies []policy `json:"policies"`
+	// Log configures the log level and rotation of the -log-file.
+	Log logConfig `json:"log"`
+	// Tracing exports OpenTelemetry spans for each scan.
+	Tracing tracingConfig `json:"tracing"`
+	// Digest configures the email summary of the week's changes.
+	Digest digestConfig `json:"digest"`
+	// Serve configures serve mode.
+	Serve serveConfig `json:"serve"`
+	// Cache configures the lookup cache.
+	Cache cacheConfig `json:"cache"`
+	// Household decides whose views count for -unwatched-for.
+	Household householdConfig `json:"household"`
+
+	dates         dateFormatter
+	leavingWithin time.Duration
+}
+
+type plexConfig struct {
+	// Host defaults to localhost, Port to 32400 and Scheme to http.
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Scheme string `json:"scheme"`
+	// CACert is a PEM file of extra CA certificates to trust for the server,
+	// e.g. a reverse proxy's own CA.
+	CACert string `json:"ca_cert"`
+	// InsecureSkipVerify turns off certificate verification for the server.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// Discover finds the server through the plex.tv account that owns
+	// PLEX_TOKEN instead of connecting to Host. Server picks one by name
+	// when the account has several.
+	Discover bool   `json:"discover"`
+	Server   string `json:"server"`
+	// ExcludeLabel skips items that have this Plex label, e.g. "p2n:keep".
+	ExcludeLabel string `json:"exclude_label"`
+	// Collection and Label, when set, are put on every item found on
+	// Netflix, and taken off items that aren't any more.
+	Collection string `json:"collection"`
+	Label      string `json:"label"`
+	// Playlist, when set, is a video playlist kept to the items found on
+	// Netflix.
+	Playlist string `json:"playlist"`
+}
+
+// url returns the base URL of the Plex server.
+func (p plexConfig) url() string {
+	return fmt.Sprintf("%s://%s:%d", p.Scheme, p.Host, p.Port)
+}
+
+type unogsConfig struct {
+	// BaseURL replaces the RapidAPI endpoint, e.g. for a caching proxy.
+	BaseURL string `json:"base_url"`
+	// RequestsPerSecond and Burst limit how fast requests are made. There is
+	// no limit by default.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+	// DailyQuota stops lookups once this many requests have been made in a
+	// day, leaving the rest of a plan's quota for other uses.
+	DailyQuota int `json:"daily_quota"`
+}
+
+type householdConfig struct {
+	// WatchedBy is "anyone" (the default), where an item counts as watched
+	// once any household member has seen it, or "everyone", where it only
+	// counts once every member has.
+	WatchedBy string `json:"watched_by"`
+	// Users lists the household's usernames. It defaults to the server owner
+	// and every Plex Home or managed user known to Tautulli.
+	Users []string `json:"users"`
+}
+
+type libraryConfig struct {
+	Countries []string `json:"countries"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path != "" {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", path)
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			if bytes, err = yamlToJSON(bytes); err != nil {
+				return nil, errors.Wrapf(err, "unmarshaling %s", path)
+			}
+		}
+		if err := json.Unmarshal(bytes, cfg); err != nil {
+			return nil, errors.Wrapf(err, "unmarshaling %s", path)
+		}
+	}
+	if err := cfg.applyEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+
+	if cfg.Plex.Host == "" {
+		cfg.Plex.Host = "localhost"
+	}
+	if cfg.Plex.Port == 0 {
+		cfg.Plex.Port = 32400
+	}
+	if cfg.Plex.Scheme == "" {
+		cfg.Plex.Scheme = "http"
+	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = ".plex2netflix"
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MinConfidence == 0 {
+		cfg.MinConfidence = defaultMinConfidence
+	}
+	if cfg.YearTolerance == nil {
+		tolerance := defaultYearTolerance
+		cfg.YearTolerance = &tolerance
+	}
+
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = userAgent()
+	}
+	if cfg.Unogs.BaseURL == "" {
+		cfg.Unogs.BaseURL = "https://unogs-unogs-v1.p.rapidapi.com"
+	}
+	cfg.Unogs.BaseURL = strings.TrimSuffix(cfg.Unogs.BaseURL, "/")
+	if len(cfg.Countries) == 0 {
+		cfg.Countries = []string{"us"}
+	}
+	var err error
+	cfg.dates, err = newDateFormatter(cfg.Timezone, cfg.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Cache.TTL == "" {
+		cfg.Cache.TTL = "7d"
+	}
+	if cfg.Cache.ttl, err = parseAge(cfg.Cache.TTL); err != nil {
+		return nil, errors.Wrap(err, "parsing cache.ttl")
+	}
+
+	if cfg.LeavingWithin != "" {
+		if cfg.leavingWithin, err = parseAge(cfg.LeavingWithin); err != nil {
+			return nil, errors.Wrap(err, "parsing leaving_within")
+		}
+	}
+
+	if cfg.RequireQuality, err = parseQuality(cfg.RequireQuality); err != nil {
+		return nil, errors.Wrap(err, "parsing require_quality")
+	}
+
+	cfg.RequireAudio = languageCodeList(strings.Join(cfg.RequireAudio, ","))
+	cfg.RequireSubtitles = languageCodeList(strings.Join(cfg.RequireSubtitles, ","))
+
+	switch cfg.CountryMatch {
+	case "":
+		cfg.CountryMatch = "any"
+	case "any", "all":
+	default:
+		return nil, errors.Errorf("country_match must be any or all, not %q", cfg.CountryMatch)
+	}
+	switch cfg.Household.WatchedBy {
+	case "":
+		cfg.Household.WatchedBy = "anyone"
+	case "anyone", "everyone":
+	default:
+		return nil, errors.Errorf("household.watched_by must be anyone or everyone, not %q", cfg.Household.WatchedBy)
+	}
+
+	if err := cfg.setServices(cfg.Services); err != nil {
+		return nil, err
+	}
+	cfg.Countries = lowerAll(cfg.Countries)
+	for name, library := range cfg.Libraries {
+		library.Countries = lowerAll(library.Countries)
+		cfg.Libraries[name] = library
+	}
+	return cfg, nil
+}
+
+// yamlToJSON converts a YAML config to JSON, so that it's read with the same
+// field names and types as a JSON one.
+func yamlToJSON(in []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(in, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue replaces the map[interface{}]interface{} that yaml.v2 decodes
+// mappings to, which encoding/json can't marshal, with string-keyed maps.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// configEnv lists the environment variables that override config settings,
+// for running in containers without a config file.
+var configEnv = map[string]func(c *config, value string) error{
+	"PLEX2NETFLIX_PLEX_HOST":    func(c *config, v string) error { c.Plex.Host = v; return nil },
+	"PLEX2NETFLIX_PLEX_SCHEME":  func(c *config, v string) error { c.Plex.Scheme = v; return nil },
+	"PLEX2NETFLIX_PLEX_CA_CERT": func(c *config, v string) error { c.Plex.CACert = v; return nil },
+	"PLEX2NETFLIX_PLEX_PORT": func(c *config, v string) (err error) {
+		c.Plex.Port, err = strconv.Atoi(v)
+		return err
+	},
+	"PLEX2NETFLIX_COUNTRIES":     func(c *config, v string) error { c.Countries = strings.Split(v, ","); return nil },
+	"PLEX2NETFLIX_SERVICES":      func(c *config, v string) error { c.Services = strings.Split(v, ","); return nil },
+	"PLEX2NETFLIX_COUNTRY_MATCH": func(c *config, v string) error { c.CountryMatch = v; return nil },
+	"PLEX2NETFLIX_STATE_DIR":     func(c *config, v string) error { c.StateDir = v; return nil },
+	"PLEX2NETFLIX_OUTPUT":        func(c *config, v string) error { c.Output = v; return nil },
+	"PLEX2NETFLIX_OUT":           func(c *config, v string) error { c.Out = v; return nil },
+	"PLEX2NETFLIX_CONCURRENCY": func(c *config, v string) (err error) {
+		c.Concurrency, err = strconv.Atoi(v)
+		return err
+	},
+	"PLEX2NETFLIX_CACHE_FILE":     func(c *config, v string) error { c.Cache.File = v; return nil },
+	"PLEX2NETFLIX_CACHE_TTL":      func(c *config, v string) error { c.Cache.TTL = v; return nil },
+	"PLEX2NETFLIX_UNOGS_BASE_URL": func(c *config, v string) error { c.Unogs.BaseURL = v; return nil },
+}
+
+func (c *config) applyEnv(getenv func(string) string) error {
+	for name, set := range configEnv {
+		if value := getenv(name); value != "" {
+			if err := set(c, value); err != nil {
+				return errors.Wrapf(err, "parsing %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// setServices sets the services to check, which default to Netflix.
+func (c *config) setServices(services []string) error {
+	c.Services = nil
+	for _, s := range services {
+		name := serviceName(s)
+		if name == "" {
+			return errors.Errorf("unknown streaming service %q, use netflix, prime, disney+, hulu or max", s)
+		}
+		c.Services = append(c.Services, name)
+	}
+	if len(c.Services) == 0 {
+		c.Services = []string{"netflix"}
+	}
+	return nil
+}
+
+// matcher returns the title matcher for providers' searches.
+func (c *config) matcher() titleMatcher {
+	return titleMatcher{minConfidence: c.MinConfidence, yearTolerance: *c.YearTolerance}
+}
+
+// netflixOnly reports whether Netflix is the only service checked.
+func (c *config) netflixOnly() bool {
+	return len(c.Services) == 1 && c.Services[0] == "netflix"
+}
+
+// countriesFor returns the Netflix catalogs to check for items in the given
+// library section.
+func (c *config) countriesFor(section string) []string {
+	if library, ok := c.Libraries[section]; ok && len(library.Countries) > 0 {
+		return library.Countries
+	}
+	return c.Countries
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return lowered
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type dateLayout struct {
+	date string
+	time string
+}
+
+// dateLayouts are keyed by lowercase BCP 47 language tag, falling back to the
+// language alone (e.g. "de" for "de-AT").
+var dateLayouts = map[string]dateLayout{
+	"":      {"2006-01-02", "15:04:05"},
+	"en":    {"01/02/2006", "3:04:05 PM"},
+	"en-us": {"01/02/2006", "3:04:05 PM"},
+	"en-gb": {"02/01/2006", "15:04:05"},
+	"en-au": {"02/01/2006", "3:04:05 pm"},
+	"en-ca": {"2006-01-02", "3:04:05 p.m."},
+	"de":    {"02.01.2006", "15:04:05"},
+	"es":    {"02/01/2006", "15:04:05"},
+	"fr":    {"02/01/2006", "15:04:05"},
+	"it":    {"02/01/2006", "15:04:05"},
+	"ja":    {"2006/01/02", "15:04:05"},
+	"nl":    {"02-01-2006", "15:04:05"},
+	"pt":    {"02/01/2006", "15:04:05"},
+	"sv":    {"2006-01-02", "15:04:05"},
+}
+
+// dateFormatter renders dates in the configured timezone and locale.
+type dateFormatter struct {
+	location *time.Location
+	layout   dateLayout
+}
+
+func newDateFormatter(timezone, locale string) (dateFormatter, error) {
+	location := time.Local
+	if timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return dateFormatter{}, errors.Wrapf(err, "loading timezone %q", timezone)
+		}
+	}
+
+	tag := strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	layout, ok := dateLayouts[tag]
+	if !ok {
+		layout, ok = dateLayouts[strings.SplitN(tag, "-", 2)[0]]
+	}
+	if !ok {
+		return dateFormatter{}, errors.Errorf("unsupported locale %q", locale)
+	}
+	return dateFormatter{location: location, layout: layout}, nil
+}
+
+func (f dateFormatter) date(t time.Time) string {
+	return t.In(f.location).Format(f.layout.date)
+}
+
+func (f dateFormatter) dateTime(t time.Time) string {
+	return t.In(f.location).Format(f.layout.date + " " + f.layout.time)
+}
+
+// logFormatter wraps a logrus formatter so that log timestamps are rendered
+// in the configured timezone and locale. JSON logs keep RFC 3339 timestamps,
+// which is what log shippers parse.
+func (f dateFormatter) logFormatter(format string) logrus.Formatter {
+	var next logrus.Formatter = &logrus.TextFormatter{FullTimestamp: true, TimestampFormat: f.layout.date + " " + f.layout.time}
+	if format == "json" {
+		next = &logrus.JSONFormatter{}
+	}
+	return &locationFormatter{Formatter: next, location: f.location}
+}
+
+type locationFormatter struct {
+	logrus.Formatter
+	location *time.Location
+}
+
+func (f *locationFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entry.Time = entry.Time.In(f.location)
+	return f.Formatter.Format(entry)
+}
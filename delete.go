@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/sirupsen/logrus"
+)
+
+// actionDelete is the Plex deletion action, as used in policies.
+const actionDelete = "delete"
+
+// deletePlexItems deletes the items found on Netflix from Plex, files and
+// all. It always lists what would be deleted and the space that frees first,
+// and only goes ahead if the user types "yes" at the terminal; with dryRun
+// it stops at the list. Only items whose confidence is 1 are deleted, so
+// fuzzy matches, editions and shows missing seasons are left for review.
+func deletePlexItems(logger *logrus.Logger, conn *plex.Plex, cfg *config, activity *activityLog, results []checkResult, dryRun bool) {
+	doomed, size := deletableItems(logger, cfg, results)
+	if len(doomed) == 0 {
+		logger.Info("nothing to delete")
+		return
+	}
+
+	// The list goes to stderr with the prompt, since stdout may be the
+	// report.
+	fmt.Fprintf(os.Stderr, "These %d items would be deleted from Plex with their files, freeing %s:\n", len(doomed), formatSize(size))
+	for _, item := range doomed {
+		fmt.Fprintf(os.Stderr, "  %s (%d), %s, %s\n", item.Title, item.Year, item.Section, formatSize(item.Size))
+	}
+	if dryRun {
+		logger.Info("dry run, nothing deleted")
+		return
+	}
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		logger.Error("-delete needs a terminal to confirm on, nothing deleted")
+		return
+	}
+	fmt.Fprint(os.Stderr, `Type "yes" to delete them: `)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		logger.Info("not confirmed, nothing deleted")
+		return
+	}
+
+	deleteFromPlex(logger, conn, activity, doomed)
+}
+
+// deletableItems returns the Plex items of the results that may be deleted,
+// each once, and the space deleting them frees.
+func deletableItems(logger *logrus.Logger, cfg *config, results []checkResult) ([]mediaItem, int64) {
+	var items []mediaItem
+	var size int64
+	seen := map[string]bool{}
+	for _, result := range allowedResults(logger, cfg, actionDelete, results) {
+		item := result.Item
+		if item.RatingKey == "" || seen[item.RatingKey] {
+			continue
+		}
+		if result.Confidence < 1 {
+			logger.WithField("title", item.Title).WithField("confidence", result.Confidence).Info("not deleting a match that needs review")
+			continue
+		}
+		seen[item.RatingKey] = true
+		items = append(items, item)
+		size += item.Size
+	}
+	return items, size
+}
+
+// deleteFromPlex deletes items from Plex with their files.
+func deleteFromPlex(logger *logrus.Logger, conn *plex.Plex, activity *activityLog, items []mediaItem) {
+	for _, item := range items {
+		entry := logger.WithField("title", item.Title).WithField("section", item.Section)
+		if err := plexDo(conn, "DELETE", "/library/metadata/"+item.RatingKey, nil); err != nil {
+			entry.WithField("error", err).Error("deleting from Plex, is deleting media allowed in the server's settings?")
+			continue
+		}
+		entry.Info("deleted from Plex")
+		activity.recordAction(actionDelete, item)
+	}
+}
+
+// formatSize formats a byte count in binary units, e.g. "1.5 TB".
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTP"[exp])
+}
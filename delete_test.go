@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDeletableItems(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	cfg := &config{Policies: []policy{{Genres: []string{"Documentary"}, ReportOnly: true}}}
+	results := []checkResult{
+		{Item: mediaItem{Title: "Roma", RatingKey: "1", Size: 3 << 30}, Found: true, Confidence: 1},
+		// The same title in another library is the same Plex item.
+		{Item: mediaItem{Title: "Roma", RatingKey: "1", Size: 3 << 30}, Found: true, Confidence: 1},
+		{Item: mediaItem{Title: "Okja", RatingKey: "2", Size: 1 << 30}, Found: true, Confidence: 1},
+		{Item: mediaItem{Title: "Heat", RatingKey: "3", Size: 5 << 30}, Found: true, Confidence: 0.9},
+		{Item: mediaItem{Title: "Taxi Driver", RatingKey: "4", Size: 2 << 30}},
+		{Item: mediaItem{Title: "Icarus", RatingKey: "5", Genres: []string{"Documentary"}}, Found: true, Confidence: 1},
+		// Items from -input or -scan-dir aren't in Plex.
+		{Item: mediaItem{Title: "Bird Box"}, Found: true, Confidence: 1},
+	}
+
+	items, size := deletableItems(logger, cfg, results)
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	if !reflect.DeepEqual(titles, []string{"Roma", "Okja"}) {
+		t.Errorf("deletable titles = %q, want Roma and Okja", titles)
+	}
+	if size != 4<<30 {
+		t.Errorf("size = %s, want 4.0 GB", formatSize(size))
+	}
+}
+
+func TestDeleteFromPlex(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.Header.Get("X-Plex-Token") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/library/metadata/2" {
+			// Deleting media is off in the server's settings.
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		deleted = append(deleted, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	activity := newActivityLog(logger, t.TempDir())
+	items := []mediaItem{{Title: "Roma", RatingKey: "1"}, {Title: "Okja", RatingKey: "2"}, {Title: "Bird Box", RatingKey: "3"}}
+	deleteFromPlex(logger, &plex.Plex{URL: server.URL, Token: "token"}, activity, items)
+	if !reflect.DeepEqual(deleted, []string{"/library/metadata/1", "/library/metadata/3"}) {
+		t.Errorf("deleted %q, want Roma and Bird Box", deleted)
+	}
+	events, err := activity.since(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Action != actionDelete || events[1].Title != "Bird Box" {
+		t.Errorf("recorded %v, want the deletions of Roma and Bird Box", events)
+	}
+}
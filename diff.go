@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// showDiff implements the diff subcommand. It compares the matches in two
+// saved results files, keyed by library and title.
+func showDiff(logger *logrus.Logger, cfg *config, oldPath, newPath string) {
+	older, err := loadResults(oldPath)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading old results")
+	}
+	newer, err := loadResults(newPath)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading new results")
+	}
+
+	before, after := resultsByKey(older.Results), resultsByKey(newer.Results)
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var added, removed, changed []string
+	for _, key := range sorted {
+		o, inOld := before[key]
+		n, inNew := after[key]
+		wasFound, isFound := inOld && o.Found, inNew && n.Found
+		switch {
+		case isFound && !wasFound:
+			added = append(added, describeResult(n))
+		case wasFound && !isFound:
+			note := "no longer on netflix"
+			if !inNew {
+				note = "not in the new run"
+			}
+			removed = append(removed, fmt.Sprintf("%s, %s", describeResult(o), note))
+		case wasFound && isFound && o.Confidence != n.Confidence:
+			changed = append(changed, fmt.Sprintf("%s, confidence %.2f -> %.2f", describeResult(n), o.Confidence, n.Confidence))
+		}
+	}
+
+	fmt.Printf("Comparing %s with %s\n", cfg.dates.dateTime(older.Time), cfg.dates.dateTime(newer.Time))
+	for _, section := range []struct {
+		name  string
+		lines []string
+	}{{"Added", added}, {"Removed", removed}, {"Changed", changed}} {
+		fmt.Printf("\n%s (%d)\n", section.name, len(section.lines))
+		for _, line := range section.lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
+
+// showChanges shows what changed between the last run and the one before,
+// for -diff and report diff.
+func showChanges(logger *logrus.Logger, cfg *config, stateDir string) {
+	previous := filepath.Join(stateDir, "results.previous.json")
+	if _, err := os.Stat(previous); os.IsNotExist(err) {
+		logger.Info("no earlier run to compare with yet")
+		return
+	}
+	showDiff(logger, cfg, previous, filepath.Join(stateDir, "results.json"))
+}
+
+func resultsByKey(results []checkResult) map[string]checkResult {
+	byKey := make(map[string]checkResult, len(results))
+	for _, result := range results {
+		byKey[result.Item.Section+"|"+result.Item.key()] = result
+	}
+	return byKey
+}
+
+func describeResult(result checkResult) string {
+	return fmt.Sprintf("%s (%d) in %s", result.Item.Title, result.Item.Year, result.Item.Section)
+}
+
+// arrivedOnNetflix returns the results found on Netflix that weren't in
+// previous, so all of them when there are no previous results.
+func arrivedOnNetflix(previous, results []checkResult) []checkResult {
+	before := resultsByKey(previous)
+	var arrived []checkResult
+	for _, result := range results {
+		if result.Found && !before[result.Item.Section+"|"+result.Item.key()].Found {
+			arrived = append(arrived, result)
+		}
+	}
+	return arrived
+}
+
+// leftNetflix returns the results that were found on Netflix in previous and
+// have been checked and not found since.
+func leftNetflix(previous, results []checkResult) []checkResult {
+	before := resultsByKey(previous)
+	var left []checkResult
+	for _, result := range results {
+		if !result.Found && result.Error == "" && before[result.Item.Section+"|"+result.Item.key()].Found {
+			left = append(left, result)
+		}
+	}
+	return left
+}
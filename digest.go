@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type digestConfig struct {
+	// SMTPHost is the mail server the digest is sent through. Without it the
+	// digest is printed instead. The password is SMTP_PASSWORD in
+	// secrets.json.
+	SMTPHost string `json:"smtp_host"`
+	// SMTPPort defaults to 587.
+	SMTPPort int      `json:"smtp_port"`
+	Username string   `json:"username"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// buildDigest summarises what happened since the given time: titles that
+// arrived on or left Netflix, actions taken, and runs and the API requests
+// they made.
+func buildDigest(cfg *config, history *historyStore, activity []activityEvent, since time.Time) string {
+	var arrived, left []string
+	history.mu.Lock()
+	for _, th := range history.Titles {
+		for i, event := range th.Events {
+			if !event.Time.After(since) {
+				continue
+			}
+			line := fmt.Sprintf("%s (%d) on %s", th.Title, th.Year, cfg.dates.date(event.Time))
+			switch {
+			case event.Available:
+				arrived = append(arrived, line)
+			case i > 0:
+				left = append(left, line)
+			}
+		}
+	}
+	history.mu.Unlock()
+	sort.Strings(arrived)
+	sort.Strings(left)
+
+	var actions []string
+	runs, requests := 0, 0
+	for _, event := range activity {
+		switch event.Kind {
+		case "run":
+			runs++
+			requests += event.Requests
+		case "action":
+			actions = append(actions, fmt.Sprintf("%s: %s (%d) on %s", event.Action, event.Title, event.Year, cfg.dates.date(event.Time)))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "plex2netflix digest since %s\n", cfg.dates.date(since))
+	for _, section := range []struct {
+		name  string
+		lines []string
+	}{
+		{"Now on Netflix", arrived},
+		{"Left Netflix", left},
+		{"Actions taken", actions},
+	} {
+		fmt.Fprintf(&b, "\n%s (%d)\n", section.name, len(section.lines))
+		for _, line := range section.lines {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(&b, "\n%d runs made %d provider requests.\n", runs, requests)
+	return b.String()
+}
+
+func sendDigest(cfg digestConfig, password, body string) error {
+	if len(cfg.To) == 0 || cfg.From == "" {
+		return errors.New("digest needs from and to addresses")
+	}
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, password, cfg.SMTPHost)
+	}
+	msg := "From: " + cfg.From + "\r\n" +
+		"To: " + strings.Join(cfg.To, ", ") + "\r\n" +
+		"Subject: plex2netflix weekly digest\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.Replace(body, "\n", "\r\n", -1)
+	addr := cfg.SMTPHost + ":" + strconv.Itoa(port)
+	return errors.Wrapf(smtp.SendMail(addr, auth, cfg.From, cfg.To, []byte(msg)), "sending digest through %s", addr)
+}
+
+// runDigest implements the digest subcommand, which emails (or prints) the
+// changes of the past week, or of -since.
+func runDigest(logger *logrus.Logger, cfg *config, secrets map[string]string, stateDir string, args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	period := 7 * 24 * time.Hour
+	fs.Var((*ageValue)(&period), "since", "how far back the digest goes, e.g. 7d")
+	fs.Parse(args)
+
+	history, err := loadHistory(stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading history")
+	}
+	since := time.Now().Add(-period)
+	activity, err := newActivityLog(logger, stateDir).since(since)
+	if err != nil {
+		logger.WithField("error", err).Fatal("reading activity")
+	}
+
+	body := buildDigest(cfg, history, activity, since)
+	if cfg.Digest.SMTPHost == "" {
+		fmt.Print(body)
+		return
+	}
+	if err := sendDigest(cfg.Digest, secrets["SMTP_PASSWORD"], body); err != nil {
+		logger.WithField("error", err).Fatal("sending digest")
+	}
+	logger.WithField("to", strings.Join(cfg.Digest.To, ",")).Info("sent digest")
+}
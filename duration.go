@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseAge parses a duration that may also use day ("30d") and week ("2w")
+// units, which time.ParseDuration doesn't support.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, errors.Errorf("invalid age %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// ageValue is a flag.Value for ages accepted by parseAge.
+type ageValue time.Duration
+
+func (a *ageValue) String() string {
+	if a == nil || *a == 0 {
+		return ""
+	}
+	return time.Duration(*a).String()
+}
+
+func (a *ageValue) Set(s string) error {
+	d, err := parseAge(s)
+	if err != nil {
+		return err
+	}
+	*a = ageValue(d)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// editionPatterns recognise non-theatrical cuts in file names, including
+// Plex's "{edition-...}" naming convention.
+var editionPatterns = []struct {
+	pattern *regexp.Regexp
+	name    string
+}{
+	{regexp.MustCompile(`(?i)\{edition-([^}]+)\}`), ""},
+	{regexp.MustCompile(`(?i)\bdirector'?s[ ._-]cut\b`), "Director's Cut"},
+	{regexp.MustCompile(`(?i)\bextended([ ._-](cut|edition))?\b`), "Extended"},
+	{regexp.MustCompile(`(?i)\bfinal[ ._-]cut\b`), "Final Cut"},
+	{regexp.MustCompile(`(?i)\bultimate[ ._-](cut|edition)\b`), "Ultimate Edition"},
+	{regexp.MustCompile(`(?i)\bunrated\b`), "Unrated"},
+	{regexp.MustCompile(`(?i)\buncut\b`), "Uncut"},
+	{regexp.MustCompile(`(?i)\bredux\b`), "Redux"},
+}
+
+// editionConfidence is the confidence that a local copy is safe to delete
+// when it is an alternate cut. Netflix almost always streams the theatrical
+// cut.
+const editionConfidence = 0.5
+
+// detectEdition returns the name of the cut a file name refers to, or "" for
+// a theatrical release.
+func detectEdition(name string) string {
+	for _, e := range editionPatterns {
+		m := e.pattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		if e.name == "" {
+			return strings.TrimSpace(m[1])
+		}
+		return e.name
+	}
+	return ""
+}
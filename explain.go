@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// explanation records how a provider reached its decision for one item, for
+// -explain. All methods are no-ops on a nil explanation so providers can call
+// them unconditionally.
+type explanation struct {
+	cleanTitle string
+	queries    []string
+	candidates []candidate
+	countries  []string
+	decision   string
+}
+
+type candidate struct {
+	title     string
+	year      string
+	netflixID string
+	score     float64
+}
+
+func (e *explanation) setCleanTitle(title string) {
+	if e != nil {
+		e.cleanTitle = title
+	}
+}
+
+func (e *explanation) addQuery(query string) {
+	if e != nil {
+		e.queries = append(e.queries, query)
+	}
+}
+
+func (e *explanation) addCandidate(c candidate) {
+	if e != nil {
+		e.candidates = append(e.candidates, c)
+	}
+}
+
+func (e *explanation) setCountries(countries []string) {
+	if e != nil {
+		e.countries = countries
+	}
+}
+
+func (e *explanation) decide(format string, args ...interface{}) {
+	if e != nil {
+		e.decision = fmt.Sprintf(format, args...)
+	}
+}
+
+func (e *explanation) log(logger *logrus.Logger, item mediaItem) {
+	entry := logger.WithField("title", item.Title).WithField("year", item.Year)
+	entry.WithField("clean_title", e.cleanTitle).Info("explain: cleaned title")
+	for _, query := range e.queries {
+		entry.WithField("query", query).Info("explain: provider query")
+	}
+	for _, c := range e.candidates {
+		entry.WithField("candidate", c.title).
+			WithField("candidate_year", c.year).
+			WithField("netflix_id", c.netflixID).
+			WithField("score", c.score).
+			Info("explain: candidate")
+	}
+	if e.countries != nil {
+		entry.WithField("available_in", strings.Join(e.countries, ",")).Info("explain: netflix countries")
+	}
+	entry.WithField("decision", e.decision).Info("explain: decision")
+}
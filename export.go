@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// exportRecord is one result with the Plex metadata that's useful for
+// filtering downstream, flattened for spreadsheets.
+type exportRecord struct {
+	Library     string   `json:"library"`
+	Title       string   `json:"title"`
+	Year        int      `json:"year"`
+	Type        string   `json:"type"`
+	OnNetflix   bool     `json:"on_netflix"`
+	NetflixID   string   `json:"netflix_id"`
+	Countries   []string `json:"countries"`
+	Leaving     string   `json:"leaving"`
+	Quality     string   `json:"netflix_quality"`
+	Verdict     string   `json:"quality_verdict"`
+	AudioLangs  []string `json:"audio_languages"`
+	Subtitles   []string `json:"subtitles"`
+	AudioDesc   bool     `json:"audio_description"`
+	Captions    bool     `json:"closed_captions"`
+	Services    []string `json:"services,omitempty"`
+	MatchScore  float64  `json:"match_score"`
+	Confidence  float64  `json:"confidence"`
+	Edition     string   `json:"edition"`
+	Genres      string   `json:"genres"`
+	IMDbRating  float64  `json:"imdb_rating"`
+	TMDBRating  float64  `json:"tmdb_rating"`
+	RTCritic    float64  `json:"rottentomatoes_critic"`
+	RTAudience  float64  `json:"rottentomatoes_audience"`
+	Added       string   `json:"added"`
+	PlayCount   int      `json:"play_count"`
+	LastWatched string   `json:"last_watched"`
+	Resolution  string   `json:"resolution"`
+	HDR         bool     `json:"hdr"`
+	Bitrate     int      `json:"bitrate"`
+	Audio       string   `json:"audio"`
+	Files       string   `json:"files"`
+	Size        int64    `json:"size"`
+	Error       string   `json:"error,omitempty"`
+	// ByCountry is whether the title streams in each country any result
+	// does, with -country-breakdown.
+	ByCountry map[string]countryAvailability `json:"by_country,omitempty"`
+	// Poster is only used by HTML reports.
+	Poster template.URL `json:"-"`
+}
+
+// countryAvailability is whether a title streams in one country, and until
+// when if it's leaving.
+type countryAvailability struct {
+	Available bool   `json:"available"`
+	Leaving   string `json:"leaving,omitempty"`
+}
+
+func (a countryAvailability) String() string {
+	switch {
+	case !a.Available:
+		return "no"
+	case a.Leaving != "":
+		return "until " + a.Leaving
+	default:
+		return "yes"
+	}
+}
+
+var exportColumns = []string{
+	"Library", "Title", "Year", "Type", "On Netflix", "Netflix ID", "Netflix Countries", "Leaving Netflix", "Netflix Quality", "Quality Verdict", "Audio Languages", "Subtitles", "Audio Description", "Closed Captions", "Services", "Match Score", "Confidence", "Edition", "Genres",
+	"IMDb Rating", "TMDB Rating", "RT Critic", "RT Audience",
+	"Added", "Play Count", "Last Watched", "Resolution", "HDR", "Bitrate", "Audio", "Files", "Size", "Error",
+}
+
+func newExportRecord(result checkResult) exportRecord {
+	item := result.Item
+	return exportRecord{
+		Library:     item.Section,
+		Title:       item.Title,
+		Year:        item.Year,
+		Type:        item.Type,
+		OnNetflix:   result.Found,
+		NetflixID:   result.NetflixID,
+		Countries:   result.Countries,
+		Leaving:     exportDate(result.Leaving),
+		Quality:     result.NetflixQuality,
+		Verdict:     qualityVerdictText(result.QualityVerdict),
+		AudioLangs:  result.AudioLanguages,
+		Subtitles:   result.Subtitles,
+		AudioDesc:   result.AudioDescription,
+		Captions:    result.ClosedCaptions,
+		Services:    result.Services,
+		MatchScore:  result.MatchScore,
+		Confidence:  result.Confidence,
+		Edition:     item.Edition,
+		Genres:      strings.Join(item.Genres, "; "),
+		IMDbRating:  item.Ratings["imdb"],
+		TMDBRating:  item.Ratings["tmdb"],
+		RTCritic:    item.Ratings["rottentomatoes_critic"],
+		RTAudience:  item.Ratings["rottentomatoes_audience"],
+		Added:       exportDate(item.AddedAt),
+		PlayCount:   item.PlayCount,
+		LastWatched: exportDate(item.LastWatched),
+		Resolution:  item.Resolution,
+		HDR:         item.HDR,
+		Bitrate:     item.Bitrate,
+		Audio:       item.Audio,
+		Files:       strings.Join(item.Files, "; "),
+		Size:        item.Size,
+		Error:       result.Error,
+		Poster:      template.URL(item.Poster),
+	}
+}
+
+func (r exportRecord) strings() []string {
+	return []string{
+		r.Library, r.Title, exportNumber(float64(r.Year)), r.Type, strconv.FormatBool(r.OnNetflix), r.NetflixID, strings.Join(r.Countries, " "),
+		r.Leaving, r.Quality, r.Verdict, strings.Join(r.AudioLangs, " "), strings.Join(r.Subtitles, " "),
+		strconv.FormatBool(r.AudioDesc), strconv.FormatBool(r.Captions), strings.Join(r.Services, " "), exportNumber(r.MatchScore), exportNumber(r.Confidence), r.Edition, r.Genres,
+		exportNumber(r.IMDbRating), exportNumber(r.TMDBRating), exportNumber(r.RTCritic), exportNumber(r.RTAudience),
+		r.Added, exportNumber(float64(r.PlayCount)), r.LastWatched, r.Resolution, strconv.FormatBool(r.HDR), exportNumber(float64(r.Bitrate)), r.Audio, r.Files, exportNumber(float64(r.Size)), r.Error,
+	}
+}
+
+// exportDate formats dates as ISO 8601 so spreadsheets and scripts parse them
+// regardless of the configured locale.
+func exportDate(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func exportNumber(n float64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// exportResults writes results to path as "csv", "xlsx", "json", "ndjson",
+// "html" or "markdown". breakdown adds every country any title streams in to
+// each record, as a column per country in CSV and XLSX. HTML reports are
+// dated with dates; the other formats use ISO 8601.
+func exportResults(path, format string, results []checkResult, breakdown bool, dates dateFormatter) error {
+	records := make([]exportRecord, 0, len(results))
+	for _, result := range results {
+		records = append(records, newExportRecord(result))
+	}
+	if breakdown {
+		addCountryBreakdown(records, results)
+	}
+
+	if format == "md" {
+		format = "markdown"
+	}
+	switch format {
+	case "csv", "xlsx", "json", "ndjson", "html", "markdown":
+	default:
+		return errors.Errorf("unknown export format %q, use csv, xlsx, json, ndjson, html or markdown", format)
+	}
+
+	if path == "-" {
+		return errors.Wrap(writeExport(os.Stdout, format, records, dates), "writing results")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", path)
+	}
+	defer f.Close()
+	if err := writeExport(f, format, records, dates); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", path)
+}
+
+func writeExport(w io.Writer, format string, records []exportRecord, dates dateFormatter) error {
+	switch format {
+	case "html":
+		return writeHTMLReport(w, records, dates)
+	case "markdown":
+		return writeMarkdownReport(w, records)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Time    time.Time      `json:"time"`
+			Results []exportRecord `json:"results"`
+		}{time.Now(), records})
+	}
+
+	rows := exportRows(records)
+	if format == "xlsx" {
+		return writeXLSX(w, rows)
+	}
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+// exportRows returns the records as spreadsheet rows, header first, with a
+// column per country in their breakdowns after the usual ones.
+func exportRows(records []exportRecord) [][]string {
+	countries := breakdownCountries(records)
+	columns := append([]string{}, exportColumns...)
+	for _, country := range countries {
+		columns = append(columns, "Netflix "+strings.ToUpper(country))
+	}
+	rows := [][]string{columns}
+	for _, record := range records {
+		row := record.strings()
+		for _, country := range countries {
+			cell := ""
+			if record.ByCountry != nil {
+				cell = record.ByCountry[country].String()
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// addCountryBreakdown fills in the availability of each record's title in
+// every country any of the results is in. Results that couldn't be checked
+// are left out.
+func addCountryBreakdown(records []exportRecord, results []checkResult) {
+	var all []string
+	for _, result := range results {
+		all = append(all, result.Countries...)
+	}
+	all = uniqueSorted(all)
+	for i, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		byCountry := make(map[string]countryAvailability, len(all))
+		for _, country := range all {
+			a := countryAvailability{Available: containsAny(result.Countries, []string{country})}
+			if a.Available {
+				a.Leaving = exportDate(result.Expires[country])
+			}
+			byCountry[country] = a
+		}
+		records[i].ByCountry = byCountry
+	}
+}
+
+// breakdownCountries returns the countries in the records' breakdowns, in
+// order.
+func breakdownCountries(records []exportRecord) []string {
+	var countries []string
+	for _, record := range records {
+		for country := range record.ByCountry {
+			countries = append(countries, country)
+		}
+	}
+	if countries == nil {
+		return nil
+	}
+	return uniqueSorted(countries)
+}
+
+// runExport implements the export subcommand, which writes the last saved
+// results to a file.
+func runExport(logger *logrus.Logger, cfg *config, stateDir, path string, breakdown bool) {
+	saved, err := loadLastResults(stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading results, run a scan first")
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if err := exportResults(path, format, saved.Results, breakdown, cfg.dates); err != nil {
+		logger.WithField("error", err).Fatal("exporting results")
+	}
+	logger.WithField("results", len(saved.Results)).WithField("file", path).Info("exported results")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+var exportTestResults = []checkResult{
+	{
+		Item:      mediaItem{Section: "Movies", Title: "Roma", Year: 2018, Type: "movie"},
+		Found:     true,
+		NetflixID: "80240715",
+		Countries: []string{"gb", "us"},
+		Expires:   map[string]time.Time{"gb": time.Date(2026, 11, 30, 0, 0, 0, 0, time.UTC)},
+	},
+	{
+		Item:      mediaItem{Section: "Movies", Title: "Taxi Driver", Year: 1976, Type: "movie"},
+		Found:     true,
+		NetflixID: "60010932",
+		Countries: []string{"us"},
+	},
+	{
+		Item:  mediaItem{Section: "Movies", Title: "Heat", Year: 1995, Type: "movie"},
+		Error: "timed out",
+	},
+}
+
+func exportTestRecords() []exportRecord {
+	var records []exportRecord
+	for _, result := range exportTestResults {
+		records = append(records, newExportRecord(result))
+	}
+	return records
+}
+
+// readCSVExport writes records as CSV and reads the rows back, header first.
+func readCSVExport(t *testing.T, records []exportRecord) [][]string {
+	var b bytes.Buffer
+	if err := writeExport(&b, "csv", records, dateFormatter{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(records)+1 {
+		t.Fatalf("got %d rows, want a header and %d records", len(rows), len(records))
+	}
+	return rows
+}
+
+// csvColumn returns the index of the named column in a CSV export's header.
+func csvColumn(t *testing.T, header []string, name string) int {
+	for i, c := range header {
+		if c == name {
+			return i
+		}
+	}
+	t.Fatalf("no %s column in %q", name, header)
+	return -1
+}
+
+func TestExportCSV(t *testing.T) {
+	rows := readCSVExport(t, exportTestRecords())
+	header := rows[0]
+	if len(header) != len(exportColumns) {
+		t.Errorf("got %d columns, want %d", len(header), len(exportColumns))
+	}
+	roma := rows[1]
+	for column, want := range map[string]string{"Title": "Roma", "Year": "2018", "On Netflix": "true", "Netflix ID": "80240715", "Netflix Countries": "gb us"} {
+		if got := roma[csvColumn(t, header, column)]; got != want {
+			t.Errorf("Roma's %s = %q, want %q", column, got, want)
+		}
+	}
+	heat := rows[3]
+	if got := heat[csvColumn(t, header, "Error")]; got != "timed out" {
+		t.Errorf("Heat's Error = %q, want timed out", got)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeExport(&b, "json", exportTestRecords(), dateFormatter{}); err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Time    time.Time                `json:"time"`
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Time.IsZero() || len(export.Results) != 3 {
+		t.Fatalf("got %d results at %v, want 3 with a time", len(export.Results), export.Time)
+	}
+	roma := export.Results[0]
+	for key, want := range map[string]interface{}{"title": "Roma", "year": 2018.0, "on_netflix": true, "netflix_id": "80240715"} {
+		if roma[key] != want {
+			t.Errorf("%s = %v, want %v", key, roma[key], want)
+		}
+	}
+	if _, ok := roma["by_country"]; ok {
+		t.Error("by_country exported without a breakdown")
+	}
+	if export.Results[2]["error"] != "timed out" {
+		t.Errorf("error = %v, want timed out", export.Results[2]["error"])
+	}
+}
+
+func TestCountryBreakdown(t *testing.T) {
+	records := exportTestRecords()
+	addCountryBreakdown(records, exportTestResults)
+	want := map[string]countryAvailability{
+		"gb": {Available: true, Leaving: "2026-11-30"},
+		"us": {Available: true},
+	}
+	if got := records[0].ByCountry; len(got) != len(want) || got["gb"] != want["gb"] || got["us"] != want["us"] {
+		t.Errorf("Roma's breakdown = %v, want %v", got, want)
+	}
+	if got := records[1].ByCountry; got["gb"].Available || !got["us"].Available {
+		t.Errorf("Taxi Driver's breakdown = %v, want only us", got)
+	}
+	if records[2].ByCountry != nil {
+		t.Errorf("breakdown for a result that couldn't be checked: %v", records[2].ByCountry)
+	}
+
+	// In CSV, each country is a column after the usual ones.
+	rows := readCSVExport(t, records)
+	header := rows[0]
+	if len(header) != len(exportColumns)+2 {
+		t.Fatalf("got %d columns, want %d and one per country", len(header), len(exportColumns))
+	}
+	gb, us := csvColumn(t, header, "Netflix GB"), csvColumn(t, header, "Netflix US")
+	for i, want := range [][2]string{{"until 2026-11-30", "yes"}, {"no", "yes"}, {"", ""}} {
+		if got := [2]string{rows[i+1][gb], rows[i+1][us]}; got != want {
+			t.Errorf("%s in GB and US = %q, want %q", rows[i+1][csvColumn(t, header, "Title")], got, want)
+		}
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeExport(&b, "xlsx", exportTestRecords(), dateFormatter{}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	parts := map[string]bool{}
+	for _, f := range zr.File {
+		parts[f.Name] = true
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.NewDecoder(r).Decode(&sheet); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	for _, part := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if !parts[part] {
+			t.Errorf("no %s in the workbook", part)
+		}
+	}
+	if len(sheet.Rows) != 4 {
+		t.Fatalf("got %d rows, want a header and 3 records", len(sheet.Rows))
+	}
+	header, roma := sheet.Rows[0].Cells, sheet.Rows[1].Cells
+	if len(header) != len(exportColumns) || header[1].Inline != "Title" {
+		t.Errorf("header has %d columns starting %q, want %d", len(header), header[0].Inline, len(exportColumns))
+	}
+	if roma[1].Ref != "B2" || roma[1].Type != "inlineStr" || roma[1].Inline != "Roma" {
+		t.Errorf("Roma's title cell = %+v", roma[1])
+	}
+	if roma[2].Type != "" || roma[2].Value != "2018" {
+		t.Errorf("Roma's year cell = %+v, want the number 2018", roma[2])
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestHTMLReportDate(t *testing.T) {
+	dates, err := newDateFormatter("UTC", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := writeExport(&b, "html", exportTestRecords(), dates); err != nil {
+		t.Fatal(err)
+	}
+	want := "2 of 3 titles on Netflix, " + time.Now().UTC().Format("02.01.2006")
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("the report doesn't say %q", want)
+	}
+}
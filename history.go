@@ -0,0 +1,588 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// availabilityEvent marks the moment a title was first seen on Netflix, or
+// first seen missing from it.
+type availabilityEvent struct {
+	Time      time.Time `json:"time"`
+	Available bool      `json:"available"`
+}
+
+type titleHistory struct {
+	Section     string              `json:"section"`
+	GUID        string              `json:"guid,omitempty"`
+	Type        string              `json:"type,omitempty"`
+	IMDbID      string              `json:"imdb_id,omitempty"`
+	TMDBID      string              `json:"tmdb_id,omitempty"`
+	Title       string              `json:"title"`
+	Year        int                 `json:"year"`
+	Countries   []string            `json:"countries,omitempty"`
+	Available   bool                `json:"available"`
+	LastChecked time.Time           `json:"last_checked"`
+	Events      []availabilityEvent `json:"events"`
+
+	// saved is how many of the events are in the history database.
+	saved int
+}
+
+// since returns when the title's current availability started.
+func (h *titleHistory) since() time.Time {
+	if len(h.Events) == 0 {
+		return time.Time{}
+	}
+	return h.Events[len(h.Events)-1].Time
+}
+
+// historySchema is the history database's schema. titles has each title's
+// latest state, events the changes in its availability, and runs how many
+// titles each run checked and found.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS titles (
+	key          TEXT PRIMARY KEY,
+	section      TEXT NOT NULL,
+	guid         TEXT NOT NULL,
+	type         TEXT NOT NULL,
+	imdb_id      TEXT NOT NULL,
+	tmdb_id      TEXT NOT NULL,
+	title        TEXT NOT NULL,
+	year         INTEGER NOT NULL,
+	countries    TEXT NOT NULL,
+	available    BOOLEAN NOT NULL,
+	last_checked TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS events (
+	title_key TEXT NOT NULL REFERENCES titles (key),
+	time      TIMESTAMP NOT NULL,
+	available BOOLEAN NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_title_key ON events (title_key, time);
+CREATE TABLE IF NOT EXISTS runs (
+	time     TIMESTAMP NOT NULL,
+	items    INTEGER NOT NULL,
+	found    INTEGER NOT NULL,
+	requests INTEGER NOT NULL
+);
+`
+
+// historyDriver is the database/sql driver history.db is opened with. It's
+// only set in builds with the sqlite tag, as the driver needs cgo; other
+// builds keep history in history.json.
+var historyDriver string
+
+// historyStore keeps each title's availability timeline across runs, in
+// history.json in the state directory or, in builds with SQLite, in
+// history.db. The timelines are also held in memory while running, and save
+// writes them out.
+type historyStore struct {
+	mu     sync.Mutex
+	Titles map[string]*titleHistory `json:"titles"`
+	// path is history.json, when the history isn't kept in a database.
+	path string
+	// activity has the runs when the history isn't kept in a database.
+	activity *activityLog
+	db       *sql.DB
+	// dirty has the keys of the titles recorded since the last save.
+	dirty map[string]bool
+}
+
+// loadHistory reads the history in stateDir. Builds with SQLite open the
+// history database instead, creating it if need be, and a history.json from
+// a build without it is imported into a new database and renamed to
+// history.json.migrated, along with the runs in the activity log.
+func loadHistory(stateDir string) (*historyStore, error) {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating %s", stateDir)
+	}
+	if historyDriver == "" {
+		return loadHistoryFile(stateDir)
+	}
+	path := filepath.Join(stateDir, "history.db")
+	db, err := sql.Open(historyDriver, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "creating tables in %s", path)
+	}
+	h := &historyStore{db: db, Titles: map[string]*titleHistory{}, dirty: map[string]bool{}}
+	if err := h.load(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	if err := h.migrate(stateDir); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// loadHistoryFile reads history.json in stateDir, if there is one yet.
+func loadHistoryFile(stateDir string) (*historyStore, error) {
+	h := &historyStore{
+		Titles:   map[string]*titleHistory{},
+		path:     filepath.Join(stateDir, "history.json"),
+		activity: newActivityLog(nil, stateDir),
+		dirty:    map[string]bool{},
+	}
+	bytes, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", h.path)
+	}
+	if err := json.Unmarshal(bytes, h); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", h.path)
+	}
+	return h, nil
+}
+
+func (h *historyStore) load() error {
+	rows, err := h.db.Query("SELECT key, section, guid, type, imdb_id, tmdb_id, title, year, countries, available, last_checked FROM titles")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, countries string
+		th := &titleHistory{}
+		if err := rows.Scan(&key, &th.Section, &th.GUID, &th.Type, &th.IMDbID, &th.TMDBID, &th.Title, &th.Year, &countries, &th.Available, &th.LastChecked); err != nil {
+			return err
+		}
+		th.Countries = strings.Fields(countries)
+		th.LastChecked = th.LastChecked.Local()
+		h.Titles[key] = th
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	events, err := h.db.Query("SELECT title_key, time, available FROM events ORDER BY time, rowid")
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	for events.Next() {
+		var key string
+		var event availabilityEvent
+		if err := events.Scan(&key, &event.Time, &event.Available); err != nil {
+			return err
+		}
+		if th, ok := h.Titles[key]; ok {
+			event.Time = event.Time.Local()
+			th.Events = append(th.Events, event)
+			th.saved++
+		}
+	}
+	return events.Err()
+}
+
+// migrate imports history.json and the runs in the activity log into a new
+// database.
+func (h *historyStore) migrate(stateDir string) error {
+	var runs int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM runs").Scan(&runs); err != nil {
+		return errors.Wrap(err, "counting runs")
+	}
+	if len(h.Titles) > 0 || runs > 0 {
+		return nil
+	}
+
+	path := filepath.Join(stateDir, "history.json")
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading %s", path)
+	}
+	if err == nil {
+		var old struct {
+			Titles map[string]*titleHistory `json:"titles"`
+		}
+		if err := json.Unmarshal(bytes, &old); err != nil {
+			return errors.Wrapf(err, "unmarshaling %s", path)
+		}
+		for key, th := range old.Titles {
+			h.Titles[key] = th
+			h.dirty[key] = true
+		}
+		if err := h.save(); err != nil {
+			return errors.Wrapf(err, "importing %s", path)
+		}
+		if err := os.Rename(path, path+".migrated"); err != nil {
+			return errors.Wrapf(err, "renaming %s", path)
+		}
+	}
+
+	events, err := newActivityLog(nil, stateDir).since(time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if event.Kind == "run" {
+			if err := h.recordRun(event); err != nil {
+				return errors.Wrap(err, "importing runs")
+			}
+		}
+	}
+	return nil
+}
+
+// historyKey is the key of an item's history when checked in countries. A
+// title in two libraries checked in different countries has a history for
+// each, as it can be on Netflix in one set of countries and not the other.
+func historyKey(item mediaItem, countries []string) string {
+	return item.key() + "|" + strings.Join(uniqueSorted(lowerAll(countries)), ",")
+}
+
+// record notes an item's availability in countries at t. It returns the
+// title's history and whether the availability changed since the last run;
+// the first observation of a title doesn't count as a change.
+func (h *historyStore) record(item mediaItem, countries []string, available bool, t time.Time) (*titleHistory, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := historyKey(item, countries)
+	th, ok := h.Titles[key]
+	if legacy, found := h.Titles[item.key()]; !ok && found && legacy.Countries == nil {
+		// Histories recorded before they were kept per country carry on
+		// under the countries the title is checked in now.
+		delete(h.Titles, item.key())
+		h.dirty[item.key()] = true
+		th, ok = legacy, true
+		th.saved = 0
+		h.Titles[key] = th
+	}
+	if !ok {
+		th = &titleHistory{Available: available}
+		th.Events = append(th.Events, availabilityEvent{Time: t, Available: available})
+		h.Titles[key] = th
+	}
+	th.Section, th.GUID, th.Type, th.IMDbID, th.TMDBID = item.Section, item.GUID, item.Type, item.IMDbID, item.TMDBID
+	th.Title, th.Year, th.Countries = item.Title, item.Year, uniqueSorted(lowerAll(countries))
+	changed := ok && th.Available != available
+	if changed {
+		th.Events = append(th.Events, availabilityEvent{Time: t, Available: available})
+	}
+	th.Available = available
+	th.LastChecked = t
+	h.dirty[key] = true
+	return th, changed
+}
+
+// recordRun adds a finished run to the history database. Without one, the
+// runs are read from the activity log, which already has them.
+func (h *historyStore) recordRun(run activityEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		return nil
+	}
+	_, err := h.db.Exec("INSERT INTO runs (time, items, found, requests) VALUES (?, ?, ?, ?)", run.Time.UTC(), run.Items, run.Found, run.Requests)
+	return errors.Wrap(err, "recording run")
+}
+
+// availableItems returns the titles that were on Netflix when last checked.
+func (h *historyStore) availableItems() []mediaItem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var items []mediaItem
+	for _, th := range h.Titles {
+		if th.Available {
+			items = append(items, mediaItem{
+				Section: th.Section,
+				GUID:    th.GUID,
+				Type:    th.Type,
+				IMDbID:  th.IMDbID,
+				TMDBID:  th.TMDBID,
+				Title:   th.Title,
+				Year:    th.Year,
+			})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Title < items[j].Title })
+	return items
+}
+
+// save writes the titles recorded since the last save, and their new
+// events, to the database in one transaction, or rewrites history.json.
+func (h *historyStore) save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.dirty) == 0 {
+		return nil
+	}
+	if h.db == nil {
+		bytes, err := json.MarshalIndent(h, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshaling history")
+		}
+		if err := ioutil.WriteFile(h.path, bytes, 0644); err != nil {
+			return errors.Wrapf(err, "writing %s", h.path)
+		}
+		h.dirty = map[string]bool{}
+		return nil
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	for key := range h.dirty {
+		th, ok := h.Titles[key]
+		if !ok {
+			// The title moved to another key.
+			if _, err := tx.Exec("DELETE FROM events WHERE title_key = ?", key); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "removing %s", key)
+			}
+			if _, err := tx.Exec("DELETE FROM titles WHERE key = ?", key); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "removing %s", key)
+			}
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO titles (key, section, guid, type, imdb_id, tmdb_id, title, year, countries, available, last_checked) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			key, th.Section, th.GUID, th.Type, th.IMDbID, th.TMDBID, th.Title, th.Year, strings.Join(th.Countries, " "), th.Available, th.LastChecked.UTC()); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "saving %s", th.Title)
+		}
+		for _, event := range th.Events[th.saved:] {
+			if _, err := tx.Exec("INSERT INTO events (title_key, time, available) VALUES (?, ?, ?)", key, event.Time.UTC(), event.Available); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "saving %s", th.Title)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "saving history")
+	}
+	for key := range h.dirty {
+		if th, ok := h.Titles[key]; ok {
+			th.saved = len(th.Events)
+		}
+	}
+	h.dirty = map[string]bool{}
+	return nil
+}
+
+// search returns the histories whose title contains query, ignoring case,
+// sorted by title.
+func (h *historyStore) search(query string) []*titleHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var matches []*titleHistory
+	for _, th := range h.Titles {
+		if strings.Contains(strings.ToLower(th.Title), strings.ToLower(query)) {
+			matches = append(matches, th)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Title != matches[j].Title {
+			return matches[i].Title < matches[j].Title
+		}
+		return matches[i].Year < matches[j].Year
+	})
+	return matches
+}
+
+// firstAvailable returns when the title was first seen on Netflix, or the
+// zero time if it never has been.
+func (h *titleHistory) firstAvailable() time.Time {
+	for _, event := range h.Events {
+		if event.Available {
+			return event.Time
+		}
+	}
+	return time.Time{}
+}
+
+// timeAvailable returns how long, in all, the title has been on Netflix up
+// to now.
+func (h *titleHistory) timeAvailable(now time.Time) time.Duration {
+	var total time.Duration
+	for i, event := range h.Events {
+		if !event.Available {
+			continue
+		}
+		end := now
+		if i+1 < len(h.Events) {
+			end = h.Events[i+1].Time
+		}
+		total += end.Sub(event.Time)
+	}
+	return total
+}
+
+func days(d time.Duration) string {
+	if n := int(d / (24 * time.Hour)); n != 1 {
+		return fmt.Sprintf("%d days", n)
+	}
+	return "1 day"
+}
+
+// showHistory implements the history subcommand. It prints the availability
+// timeline of every title matching a search, or with -on-netflix the titles
+// on Netflix now and for how long, or with -trend how many titles each run
+// found.
+func showHistory(logger *logrus.Logger, cfg *config, stateDir string, args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var period time.Duration
+	fs.Var((*ageValue)(&period), "since", "only show runs and changes this recent, e.g. 90d")
+	trend := fs.Bool("trend", false, "show how many titles each run found on Netflix")
+	onNetflix := fs.Bool("on-netflix", false, "list the titles on Netflix now, the longest there first")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+	var since time.Time
+	if period > 0 {
+		since = time.Now().Add(-period)
+	}
+
+	history, err := loadHistory(stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading history")
+	}
+	if *trend {
+		showTrend(logger, cfg, history, since)
+		return
+	}
+	now := time.Now()
+
+	if *onNetflix {
+		var available []*titleHistory
+		for _, th := range history.search(query) {
+			if th.Available {
+				available = append(available, th)
+			}
+		}
+		sort.SliceStable(available, func(i, j int) bool { return available[i].since().Before(available[j].since()) })
+		for _, th := range available {
+			fmt.Printf("%s: on netflix since %s, %s\n", th.label(), cfg.dates.date(th.since()), days(now.Sub(th.since())))
+		}
+		return
+	}
+
+	for _, th := range history.search(query) {
+		status := "not on netflix"
+		if th.Available {
+			status = "on netflix"
+		}
+		fmt.Printf("%s: %s since %s\n", th.label(), status, cfg.dates.date(th.since()))
+		if first := th.firstAvailable(); !first.IsZero() {
+			fmt.Printf("  first matched %s, on netflix for %s in all\n", cfg.dates.date(first), days(th.timeAvailable(now)))
+		}
+		for _, event := range th.Events {
+			if event.Time.Before(since) {
+				continue
+			}
+			change := "left netflix"
+			if event.Available {
+				change = "on netflix"
+			}
+			if event.Time.Equal(th.Events[0].Time) {
+				change = "first checked, on netflix"
+				if !event.Available {
+					change = "first checked, not on netflix"
+				}
+			}
+			fmt.Printf("  %s  %s\n", cfg.dates.dateTime(event.Time), change)
+		}
+	}
+}
+
+// runs returns the runs recorded after t, oldest first.
+func (h *historyStore) runs(t time.Time) ([]activityEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		events, err := h.activity.since(t)
+		if err != nil {
+			return nil, err
+		}
+		var runs []activityEvent
+		for _, event := range events {
+			if event.Kind == "run" {
+				runs = append(runs, event)
+			}
+		}
+		return runs, nil
+	}
+	rows, err := h.db.Query("SELECT time, items, found, requests FROM runs WHERE time > ? ORDER BY time", t.UTC())
+	if err != nil {
+		return nil, errors.Wrap(err, "querying runs")
+	}
+	defer rows.Close()
+	var runs []activityEvent
+	for rows.Next() {
+		run := activityEvent{Kind: "run"}
+		if err := rows.Scan(&run.Time, &run.Items, &run.Found, &run.Requests); err != nil {
+			return nil, errors.Wrap(err, "reading runs")
+		}
+		run.Time = run.Time.Local()
+		runs = append(runs, run)
+	}
+	return runs, errors.Wrap(rows.Err(), "reading runs")
+}
+
+// showTrend prints the number of titles each run since the given time found
+// on Netflix, with a bar for each.
+func showTrend(logger *logrus.Logger, cfg *config, history *historyStore, since time.Time) {
+	runs, err := history.runs(since)
+	if err != nil {
+		logger.WithField("error", err).Fatal("reading runs")
+	}
+	most := 0
+	for _, run := range runs {
+		if run.Found > most {
+			most = run.Found
+		}
+	}
+	if len(runs) == 0 {
+		logger.Info("no runs recorded yet")
+		return
+	}
+	const width = 40
+	for _, run := range runs {
+		bar := 0
+		if most > 0 {
+			bar = width * run.Found / most
+		}
+		fmt.Printf("%s  %5d of %-6d %s\n", cfg.dates.dateTime(run.Time), run.Found, run.Items, strings.Repeat("#", bar))
+	}
+}
+
+// label names the title and the countries it's checked in.
+func (th *titleHistory) label() string {
+	if len(th.Countries) == 0 {
+		return fmt.Sprintf("%s (%d)", th.Title, th.Year)
+	}
+	return fmt.Sprintf("%s (%d) in %s", th.Title, th.Year, strings.Join(th.Countries, ","))
+}
+
+// has reports whether the item has been checked in countries before.
+func (h *historyStore) has(item mediaItem, countries []string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.Titles[historyKey(item, countries)]
+	if !ok {
+		_, ok = h.Titles[item.key()]
+	}
+	return ok
+}
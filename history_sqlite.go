@@ -0,0 +1,10 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import _ "github.com/mattn/go-sqlite3"
+
+func init() {
+	historyDriver = "sqlite3"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryRecord(t *testing.T) {
+	h := &historyStore{Titles: map[string]*titleHistory{}, dirty: map[string]bool{}}
+	roma := mediaItem{Section: "Movies", Title: "Roma", Year: 2018}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, changed := h.record(roma, []string{"us"}, true, start); changed {
+		t.Error("the first check counted as a change")
+	}
+	if _, changed := h.record(roma, []string{"US"}, true, start.Add(24*time.Hour)); changed {
+		t.Error("a title still on netflix counted as a change")
+	}
+	// Another library checks the title in other countries.
+	if _, changed := h.record(roma, []string{"gb"}, false, start.Add(24*time.Hour)); changed {
+		t.Error("checking in other countries counted as a change")
+	}
+	th, changed := h.record(roma, []string{"us"}, false, start.Add(48*time.Hour))
+	if !changed {
+		t.Error("leaving netflix didn't count as a change")
+	}
+	if len(th.Events) != 2 || th.Available || !th.since().Equal(start.Add(48*time.Hour)) {
+		t.Errorf("got %d events, available %v since %v, want 2, left on day 3", len(th.Events), th.Available, th.since())
+	}
+	if !h.has(roma, []string{"gb"}) || h.has(roma, []string{"fr"}) {
+		t.Error("has doesn't go by countries")
+	}
+}
+
+func TestHistoryRecordLegacy(t *testing.T) {
+	roma := mediaItem{Section: "Movies", Title: "Roma", Year: 2018}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	legacy := &titleHistory{Title: "Roma", Year: 2018, Available: true, Events: []availabilityEvent{{Time: start, Available: true}}, saved: 1}
+	h := &historyStore{Titles: map[string]*titleHistory{roma.key(): legacy}, dirty: map[string]bool{}}
+
+	if !h.has(roma, []string{"us"}) {
+		t.Error("a title checked before histories were kept per country hasn't been checked")
+	}
+	th, changed := h.record(roma, []string{"us"}, false, start.Add(24*time.Hour))
+	if !changed || len(th.Events) != 2 || th.saved != 0 {
+		t.Errorf("changed %v with %d events, %d saved, want the legacy history carried on and saved again", changed, len(th.Events), th.saved)
+	}
+	if _, ok := h.Titles[roma.key()]; ok || !h.dirty[roma.key()] {
+		t.Error("the legacy history wasn't moved")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	if historyDriver != "" {
+		t.Skip("history is kept in a database")
+	}
+	dir := t.TempDir()
+	roma := mediaItem{Section: "Movies", Title: "Roma", Year: 2018}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h, err := loadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.record(roma, []string{"us"}, true, start)
+	h.record(roma, []string{"us"}, false, start.Add(24*time.Hour))
+	if err := h.save(); err != nil {
+		t.Fatal(err)
+	}
+	newActivityLog(nil, dir).append(activityEvent{Time: start, Kind: "run", Items: 10, Found: 4})
+
+	h, err = loadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	th := h.Titles[historyKey(roma, []string{"us"})]
+	if th == nil || len(th.Events) != 2 || th.Available {
+		t.Fatalf("reloaded %+v, want Roma with 2 events, off netflix", th)
+	}
+	runs, err := h.runs(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Found != 4 {
+		t.Errorf("runs = %+v, want the one in the activity log", runs)
+	}
+}
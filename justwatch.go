@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const justwatchURL = "https://apis.justwatch.com/graphql"
+
+// justwatchSearch finds titles and their streaming offers in one country.
+const justwatchSearch = `query Search($country: Country!, $language: Language!, $query: String!, $types: [ObjectType!]) {
+  popularTitles(country: $country, first: 10, filter: {searchQuery: $query, objectTypes: $types}) {
+    edges { node {
+      objectType
+      content(country: $country, language: $language) { title originalReleaseYear externalIds { imdbId } }
+      offers(country: $country, platform: WEB) { monetizationType standardWebURL package { technicalName } }
+    } }
+  }
+}`
+
+type justwatchResponse struct {
+	Data struct {
+		PopularTitles struct {
+			Edges []struct {
+				Node justwatchTitle `json:"node"`
+			} `json:"edges"`
+		} `json:"popularTitles"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type justwatchTitle struct {
+	ObjectType string `json:"objectType"`
+	Content    struct {
+		Title               string `json:"title"`
+		OriginalReleaseYear int    `json:"originalReleaseYear"`
+		ExternalIDs         struct {
+			IMDbID string `json:"imdbId"`
+		} `json:"externalIds"`
+	} `json:"content"`
+	Offers []justwatchOffer `json:"offers"`
+}
+
+type justwatchOffer struct {
+	MonetizationType string `json:"monetizationType"`
+	StandardWebURL   string `json:"standardWebURL"`
+	Package          struct {
+		TechnicalName string `json:"technicalName"`
+	} `json:"package"`
+}
+
+// netflixTitleID pulls the Netflix ID out of a Netflix title URL.
+var netflixTitleID = regexp.MustCompile(`netflix\.com/(?:[a-z-]+/)?title/(\d+)`)
+
+// justwatchProvider looks titles up with JustWatch's public API, which needs
+// no key. JustWatch answers per country, so each country asked about costs a
+// request, and only those countries are known to have the title.
+type justwatchProvider struct {
+	logger *logrus.Logger
+	cache  *lookupCache
+	calls  int64
+	// matcher scores search results against items.
+	matcher titleMatcher
+}
+
+func (p *justwatchProvider) requests() int {
+	return int(atomic.LoadInt64(&p.calls))
+}
+
+func (p *justwatchProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	return p.findOnService(item, countries, "netflix", ex)
+}
+
+func (p *justwatchProvider) findOnService(item mediaItem, countries []string, service string, ex *explanation) (netflixMatch, error) {
+	ex.setCleanTitle(item.Title)
+	var m netflixMatch
+	for _, country := range countries {
+		netflixID, score, found, err := p.offer(item, country, service, ex)
+		if err != nil {
+			return netflixMatch{}, errors.Wrapf(err, "searching JustWatch in %s", country)
+		}
+		if found {
+			m.Found = true
+			m.NetflixID = netflixID
+			m.Countries = append(m.Countries, country)
+			m.Score = score
+		}
+	}
+	ex.setCountries(m.Countries)
+	if m.Found {
+		ex.decide("justwatch lists a %s offer in %s", service, strings.Join(m.Countries, ","))
+	} else {
+		ex.decide("justwatch lists no %s offer in %s", service, strings.Join(countries, " or "))
+	}
+	return m, nil
+}
+
+// offer reports whether JustWatch lists a subscription offer on service for
+// the item in country, with the offer's Netflix ID when it's a Netflix offer
+// whose URL has one, and the match's score. One search answers for every
+// service, and the answers for the other services are cached for when
+// they're asked about.
+func (p *justwatchProvider) offer(item mediaItem, country, service string, ex *explanation) (string, float64, bool, error) {
+	// The cached values are the Netflix ID and the score, which depends on
+	// the year tolerance.
+	cacheKey := func(service string) string {
+		return fmt.Sprintf("justwatch:%s:%s:%s|%d|%d|%s|%s", service, country, item.Title, item.Year, p.matcher.yearTolerance, item.IMDbID, item.Type)
+	}
+	if ids, ok := p.cache.get(cacheKey(service)); ok {
+		ex.addQuery("cached " + cacheKey(service))
+		if len(ids) == 0 {
+			return "", 0, false, nil
+		}
+		score := 1.0
+		if len(ids) > 1 {
+			score, _ = strconv.ParseFloat(ids[1], 64)
+		}
+		return ids[0], score, true, nil
+	}
+
+	types := []string{"MOVIE", "SHOW"}
+	switch item.Type {
+	case "movie":
+		types = []string{"MOVIE"}
+	case "show":
+		types = []string{"SHOW"}
+	}
+	variables := map[string]interface{}{
+		"country":  strings.ToUpper(country),
+		"language": "en",
+		"query":    item.Title,
+		"types":    types,
+	}
+	ex.addQuery(fmt.Sprintf("justwatch %s %q", country, item.Title))
+	resp, err := p.query(justwatchSearch, variables)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	var match *justwatchTitle
+	best := 0.0
+	for i, edge := range resp.Data.PopularTitles.Edges {
+		title := edge.Node
+		score := justwatchScore(p.matcher, item, title)
+		id, _ := title.offer("netflix")
+		ex.addCandidate(candidate{title: title.Content.Title, year: strconv.Itoa(title.Content.OriginalReleaseYear), netflixID: id, score: score})
+		if score > best && score >= p.matcher.minConfidence {
+			match, best = &resp.Data.PopularTitles.Edges[i].Node, score
+		}
+	}
+
+	for name := range streamingServices {
+		var id string
+		var found bool
+		if match != nil {
+			id, found = match.offer(name)
+		}
+		if found {
+			p.cache.put(cacheKey(name), []string{id, strconv.FormatFloat(best, 'f', -1, 64)})
+		} else {
+			p.cache.put(cacheKey(name), []string{})
+		}
+	}
+	if match == nil {
+		return "", 0, false, nil
+	}
+	id, found := match.offer(service)
+	return id, best, found, nil
+}
+
+// justwatchScore scores a JustWatch title against the item: 1 or 0 by IMDb
+// ID when both have one, and by title and year otherwise.
+func justwatchScore(matcher titleMatcher, item mediaItem, title justwatchTitle) float64 {
+	if item.IMDbID != "" && title.Content.ExternalIDs.IMDbID != "" {
+		if strings.EqualFold(item.IMDbID, title.Content.ExternalIDs.IMDbID) {
+			return 1
+		}
+		return 0
+	}
+	return matcher.score(item.Title, item.Year, title.Content.Title, title.Content.OriginalReleaseYear)
+}
+
+// offer reports whether the title has a subscription offer on service,
+// with its Netflix ID when it's a Netflix offer whose URL has one.
+func (t justwatchTitle) offer(service string) (string, bool) {
+	for _, offer := range t.Offers {
+		if !containsAny(streamingServices[service].justwatch, []string{offer.Package.TechnicalName}) || offer.MonetizationType != "FLATRATE" {
+			continue
+		}
+		if m := netflixTitleID.FindStringSubmatch(offer.StandardWebURL); m != nil {
+			return m[1], true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+func (p *justwatchProvider) query(query string, variables map[string]interface{}) (justwatchResponse, error) {
+	var result justwatchResponse
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return result, errors.Wrap(err, "marshaling JustWatch query")
+	}
+	req, err := http.NewRequest("POST", justwatchURL, bytes.NewReader(body))
+	if err != nil {
+		return result, errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	atomic.AddInt64(&p.calls, 1)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return result, errors.Wrap(err, "calling JustWatch")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, errors.Errorf("JustWatch returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, errors.Wrap(err, "decoding JustWatch response")
+	}
+	if len(result.Errors) > 0 {
+		return result, errors.Errorf("JustWatch: %s", result.Errors[0].Message)
+	}
+	return result, nil
+}
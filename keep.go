@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// keepList holds titles that are never checked, e.g. favorites that stay in
+// the library whether or not they're on Netflix.
+type keepList map[string]bool
+
+// loadKeepList reads a keep list: one Plex GUID, "imdb://" or "tmdb://" ID,
+// "title (year)" or bare title per line. Blank lines and lines starting with
+// "#" are ignored.
+func loadKeepList(path string) (keepList, error) {
+	keep := keepList{}
+	if path == "" {
+		return keep, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keep[strings.ToLower(line)] = true
+	}
+	return keep, errors.Wrapf(scanner.Err(), "reading %s", path)
+}
+
+// has reports whether the item is on the keep list. A bare title keeps
+// every year's title of that name.
+func (k keepList) has(item mediaItem) bool {
+	if k[strings.ToLower(item.Title)] {
+		return true
+	}
+	for _, key := range item.pinKeys() {
+		if k[key] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// languageCodes maps the language names uNoGS uses to ISO 639-1 codes, which
+// are what require_audio and require_subtitles take.
+var languageCodes = map[string]string{
+	"arabic":     "ar",
+	"chinese":    "zh",
+	"czech":      "cs",
+	"danish":     "da",
+	"dutch":      "nl",
+	"english":    "en",
+	"filipino":   "tl",
+	"finnish":    "fi",
+	"french":     "fr",
+	"german":     "de",
+	"greek":      "el",
+	"hebrew":     "he",
+	"hindi":      "hi",
+	"hungarian":  "hu",
+	"indonesian": "id",
+	"italian":    "it",
+	"japanese":   "ja",
+	"korean":     "ko",
+	"malay":      "ms",
+	"mandarin":   "zh",
+	"cantonese":  "zh",
+	"norwegian":  "no",
+	"polish":     "pl",
+	"portuguese": "pt",
+	"romanian":   "ro",
+	"russian":    "ru",
+	"spanish":    "es",
+	"swedish":    "sv",
+	"tamil":      "ta",
+	"telugu":     "te",
+	"thai":       "th",
+	"turkish":    "tr",
+	"ukrainian":  "uk",
+	"vietnamese": "vi",
+}
+
+// languageCode returns the ISO 639-1 code for a language name or code, e.g.
+// "Japanese" or "ja". Variants like "Spanish [Original]" or "English - Audio
+// Description" count as the language itself. Names it doesn't know are
+// returned lowercased.
+func languageCode(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if i := strings.IndexAny(name, "[(-"); i > 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	if code, ok := languageCodes[name]; ok {
+		return code
+	}
+	return name
+}
+
+// hasAudioDescription reports whether a comma-separated list of audio
+// tracks, as uNoGS gives them, has an audio description track, e.g.
+// "English - Audio Description".
+func hasAudioDescription(tracks string) bool {
+	return strings.Contains(strings.ToLower(tracks), "audio description")
+}
+
+// hasClosedCaptions reports whether a comma-separated list of subtitles, as
+// uNoGS gives them, has closed captions, e.g. "English [CC]".
+func hasClosedCaptions(subtitles string) bool {
+	s := strings.ToLower(subtitles)
+	return strings.Contains(s, "[cc]") || strings.Contains(s, "closed captions") || strings.Contains(s, "sdh")
+}
+
+// languageCodeList parses a comma-separated list of languages into sorted,
+// unique codes.
+func languageCodeList(s string) []string {
+	var codes []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			codes = append(codes, languageCode(name))
+		}
+	}
+	return uniqueSorted(codes)
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
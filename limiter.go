@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var errQuotaExhausted = errors.New("daily request quota used up")
+
+// rateLimiter is a token bucket with an optional daily request budget. There
+// is one per API key, shared by every provider and lookup using the key, so
+// together they can't exceed the key's limits.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	rate   float64 // tokens added per second, 0 for no limit
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	dailyQuota int // 0 for no limit
+	used       int
+	day        string
+}
+
+func newRateLimiter(perSecond float64, burst, dailyQuota int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:       perSecond,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       time.Now(),
+		dailyQuota: dailyQuota,
+	}
+}
+
+// wait blocks until a request may be made and counts it against the daily
+// quota. It returns errQuotaExhausted once the quota for the day is spent.
+func (l *rateLimiter) wait() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if today := now.Format("2006-01-02"); today != l.day {
+		l.day, l.used = today, 0
+	}
+	if l.dailyQuota > 0 && l.used >= l.dailyQuota {
+		return errQuotaExhausted
+	}
+	l.used++
+
+	if l.rate <= 0 {
+		return nil
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		// Holding the lock while sleeping queues up the other callers behind
+		// this one, in order.
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		time.Sleep(delay)
+		l.tokens = 1
+		l.last = time.Now()
+	}
+	l.tokens--
+	return nil
+}
+
+// count returns the day the limiter last counted requests on, and how many
+// it counted.
+func (l *rateLimiter) count() (string, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.day, l.used
+}
+
+// remaining returns how many requests are left in today's quota, or -1 when
+// there is no quota.
+func (l *rateLimiter) remaining() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dailyQuota <= 0 {
+		return -1
+	}
+	if l.day != time.Now().Format("2006-01-02") {
+		return l.dailyQuota
+	}
+	return l.dailyQuota - l.used
+}
+
+// limiterPool hands out the rate limiter of each RapidAPI key, and keeps the
+// day's request counts in quota.json in the state directory so the daily
+// quota holds across runs. Keys are stored hashed.
+type limiterPool struct {
+	logger *logrus.Logger
+	cfg    unogsConfig
+	path   string
+	// saving serializes writes to path.
+	saving sync.Mutex
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+	keys     []string // in the order they were first used
+	usage    quotaUsage
+}
+
+type quotaUsage struct {
+	Day  string         `json:"day"`
+	Used map[string]int `json:"used"`
+}
+
+// newLimiterPool loads the day's request counts from stateDir. Counts that
+// can't be read are logged and start from zero.
+func newLimiterPool(logger *logrus.Logger, cfg unogsConfig, stateDir string) *limiterPool {
+	pool := &limiterPool{logger: logger, cfg: cfg, path: filepath.Join(stateDir, "quota.json"), limiters: map[string]*rateLimiter{}}
+	bytes, err := ioutil.ReadFile(pool.path)
+	if err != nil && !os.IsNotExist(err) {
+		logger.WithField("error", err).Warn("reading request counts")
+	} else if err == nil {
+		if err := json.Unmarshal(bytes, &pool.usage); err != nil {
+			logger.WithField("error", errors.Wrapf(err, "unmarshaling %s", pool.path)).Warn("reading request counts")
+		}
+	}
+	return pool
+}
+
+// limiter returns the rate limiter of an API key.
+func (p *limiterPool) limiter(key string) *rateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l, ok := p.limiters[key]; ok {
+		return l
+	}
+	l := newRateLimiter(p.cfg.RequestsPerSecond, p.cfg.Burst, p.cfg.DailyQuota)
+	if p.usage.Day == time.Now().Format("2006-01-02") {
+		l.day, l.used = p.usage.Day, p.usage.Used[hashToken(key)]
+	}
+	p.limiters[key] = l
+	p.keys = append(p.keys, key)
+	return l
+}
+
+// save writes today's request counts to quota.json. It's called when a run's
+// results are saved rather than after every request, so that requests don't
+// wait on the disk.
+func (p *limiterPool) save() error {
+	if p == nil {
+		return nil
+	}
+	today := time.Now().Format("2006-01-02")
+	usage := quotaUsage{Day: today, Used: map[string]int{}}
+	p.mu.Lock()
+	if p.usage.Day == today {
+		for id, used := range p.usage.Used {
+			usage.Used[id] = used
+		}
+	}
+	limiters := make(map[string]*rateLimiter, len(p.limiters))
+	for key, l := range p.limiters {
+		limiters[hashToken(key)] = l
+	}
+	p.mu.Unlock()
+	for id, l := range limiters {
+		if day, used := l.count(); day == today {
+			usage.Used[id] = used
+		}
+	}
+
+	p.saving.Lock()
+	defer p.saving.Unlock()
+	bytes, err := json.Marshal(usage)
+	if err != nil {
+		return errors.Wrap(err, "marshaling request counts")
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(p.path))
+	}
+	return errors.Wrapf(ioutil.WriteFile(p.path, bytes, 0644), "writing %s", p.path)
+}
+
+// logRemaining logs how much of today's quota is left for each key used.
+func (p *limiterPool) logRemaining() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	limiters := make([]*rateLimiter, 0, len(p.keys))
+	for _, key := range p.keys {
+		limiters = append(limiters, p.limiters[key])
+	}
+	p.mu.Unlock()
+	for i, l := range limiters {
+		if left := l.remaining(); left >= 0 {
+			p.logger.WithField("key", i+1).WithField("remaining", left).Info("requests left in today's RapidAPI quota")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRateLimiterQuota(t *testing.T) {
+	l := newRateLimiter(0, 1, 2)
+	for i := 0; i < 2; i++ {
+		if err := l.wait(); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if err := l.wait(); err != errQuotaExhausted {
+		t.Errorf("third request: %v, want %v", err, errQuotaExhausted)
+	}
+	if got := l.remaining(); got != 0 {
+		t.Errorf("remaining = %d, want 0", got)
+	}
+	if got := newRateLimiter(0, 1, 0).remaining(); got != -1 {
+		t.Errorf("remaining without a quota = %d, want -1", got)
+	}
+}
+
+func TestRateLimiterRate(t *testing.T) {
+	l := newRateLimiter(20, 2, 0)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst of 2 goes at once and the other 2 wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 requests took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestLimiterPool(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	dir := t.TempDir()
+	cfg := unogsConfig{DailyQuota: 3}
+
+	pool := newLimiterPool(logger, cfg, dir)
+	l := pool.limiter("key-a")
+	if pool.limiter("key-a") != l {
+		t.Error("a key got two limiters")
+	}
+	if pool.limiter("key-b") == l {
+		t.Error("two keys share a limiter")
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pool.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new run picks up where the last left off.
+	pool = newLimiterPool(logger, cfg, dir)
+	if got := pool.limiter("key-a").remaining(); got != 1 {
+		t.Errorf("key-a remaining after reloading = %d, want 1", got)
+	}
+	if got := pool.limiter("key-b").remaining(); got != 3 {
+		t.Errorf("key-b remaining after reloading = %d, want 3", got)
+	}
+}
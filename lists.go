@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// readCSV reads a CSV file with a header row and returns each record keyed
+// by column name.
+func readCSV(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+	return parseCSV(f, path)
+}
+
+func parseCSV(in io.Reader, name string) ([]map[string]string, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		for i, value := range row {
+			if i < len(header) {
+				record[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readLetterboxdExport reads the watchlist.csv (or watched.csv) file from a
+// Letterboxd data export. Letterboxd has no public API, so a username alone
+// isn't enough to fetch a watchlist.
+func readLetterboxdExport(path string) ([]mediaItem, error) {
+	records, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]mediaItem, 0, len(records))
+	for _, record := range records {
+		if record["Name"] == "" {
+			continue
+		}
+		year, _ := strconv.Atoi(record["Year"])
+		items = append(items, mediaItem{Section: "Letterboxd", Type: "movie", Title: record["Name"], Year: year})
+	}
+	return items, nil
+}
+
+// readIMDbExport reads a watchlist, ratings or list CSV exported from IMDb.
+// Episodes are skipped since availability is checked per title.
+func readIMDbExport(path string) ([]mediaItem, error) {
+	records, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]mediaItem, 0, len(records))
+	for _, record := range records {
+		if record["Title"] == "" || record["Title Type"] == "tvEpisode" {
+			continue
+		}
+		year, _ := strconv.Atoi(record["Year"])
+		kind := "movie"
+		if strings.HasPrefix(record["Title Type"], "tv") && record["Title Type"] != "tvMovie" {
+			kind = "show"
+		}
+		items = append(items, mediaItem{
+			Section: "IMDb",
+			Type:    kind,
+			IMDbID:  record["Const"],
+			Title:   record["Title"],
+			Year:    year,
+		})
+	}
+	return items, nil
+}
+
+// readTitleList reads a list of titles to check from a file, or stdin for
+// "-". It's either a CSV file with a title (or name) column and optional
+// year, type, imdb_id, tmdb_id and library columns, e.g. an exported library
+// list, or plain text with a title per line, like "The Matrix (1999)".
+func readTitleList(path string) ([]mediaItem, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+
+	firstLine := strings.SplitN(string(data), "\n", 2)[0]
+	header := map[string]bool{}
+	for _, column := range strings.Split(strings.TrimPrefix(firstLine, "\ufeff"), ",") {
+		header[strings.ToLower(strings.Trim(strings.TrimSpace(column), `"`))] = true
+	}
+	if !header["title"] && !header["name"] {
+		return readTitleLines(bytes.NewReader(data), path)
+	}
+
+	records, err := parseCSV(bytes.NewReader(data), path)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]mediaItem, 0, len(records))
+	for _, record := range records {
+		lower := make(map[string]string, len(record))
+		for column, value := range record {
+			lower[strings.ToLower(column)] = value
+		}
+		item := mediaItem{Section: "Input", Type: "movie", Title: lower["title"], IMDbID: lower["imdb_id"], TMDBID: lower["tmdb_id"]}
+		if item.Title == "" {
+			item.Title = lower["name"]
+		}
+		if item.Title == "" {
+			continue
+		}
+		item.Year, _ = strconv.Atoi(lower["year"])
+		if lower["type"] == "show" || lower["type"] == "tv" {
+			item.Type = "show"
+		}
+		if lower["library"] != "" {
+			item.Section = lower["library"]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func readTitleLines(in io.Reader, name string) ([]mediaItem, error) {
+	var items []mediaItem
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		title, year := parseReleaseName(line)
+		items = append(items, mediaItem{Section: "Input", Type: "movie", Title: title, Year: year})
+	}
+	return items, errors.Wrapf(scanner.Err(), "reading %s", name)
+}
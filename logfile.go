@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type logConfig struct {
+	// Level is the lowest level logged: debug, info, warn or error. It
+	// defaults to info.
+	Level string `json:"level"`
+	// Format is text, the default, or json for one JSON object per line.
+	Format string `json:"format"`
+	// MaxSizeMB rotates the -log-file once it reaches this size. It defaults
+	// to 10.
+	MaxSizeMB int `json:"max_size_mb"`
+	// MaxAgeDays rotates the -log-file once it has been written to for this
+	// many days. It defaults to 7.
+	MaxAgeDays int `json:"max_age_days"`
+	// MaxBackups is how many rotated files are kept, as <file>.1 (the newest)
+	// to <file>.N. It defaults to 5.
+	MaxBackups int `json:"max_backups"`
+}
+
+// rotatingFile is an io.Writer for log output that rotates the file it writes
+// to by size and age, so a long-running process doesn't fill the disk.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, cfg logConfig) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    int64(cfg.MaxSizeMB) << 20,
+		maxAge:     time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+		maxBackups: cfg.MaxBackups,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = 10 << 20
+	}
+	if f.maxAge <= 0 {
+		f.maxAge = 7 * 24 * time.Hour
+	}
+	if f.maxBackups <= 0 {
+		f.maxBackups = 5
+	}
+	return f, f.open()
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", f.path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "reading %s", f.path)
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || time.Since(f.opened) > f.maxAge) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file to <path>.1, shifting older backups up and
+// dropping the oldest, and starts a new file.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", f.path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return errors.Wrapf(err, "rotating %s", f.path)
+	}
+	return f.open()
+}
+
+// journaldFormatter prefixes each line with its sd-daemon priority, e.g.
+// "<4>" for warnings, so journald files entries at the right level when
+// plex2netflix runs as a systemd service.
+type journaldFormatter struct {
+	next logrus.Formatter
+}
+
+func (f journaldFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	bytes, err := f.next.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	priority := 7
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		priority = 2
+	case logrus.ErrorLevel:
+		priority = 3
+	case logrus.WarnLevel:
+		priority = 4
+	case logrus.InfoLevel:
+		priority = 6
+	}
+	return append([]byte(fmt.Sprintf("<%d>", priority)), bytes...), nil
+}
+
+// setLogOutput sends the logs to stdout, syslog or journald-friendly stdout.
+func setLogOutput(logger *logrus.Logger, output, format string) error {
+	switch output {
+	case "", "stdout":
+	case "syslog":
+		hook, err := newSyslogHook()
+		if err != nil {
+			return err
+		}
+		logger.Hooks.Add(hook)
+		logger.Out = ioutil.Discard
+	case "journald":
+		// journald adds its own timestamps.
+		var next logrus.Formatter = &logrus.TextFormatter{DisableTimestamp: true, DisableColors: true}
+		if format == "json" {
+			next = &logrus.JSONFormatter{DisableTimestamp: true}
+		}
+		logger.Formatter = journaldFormatter{next: next}
+	default:
+		return errors.Errorf("unknown log output %q, use stdout, syslog or journald", output)
+	}
+	return nil
+}
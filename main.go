@@ -1,182 +1,1054 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
-	"regexp"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/Shopify/ejson"
 	"github.com/jrudio/go-plex-client"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-type unogsResponse struct {
-	Count string              `json:"COUNT"`
-	Items []map[string]string `json:"ITEMS"`
-}
+type mediaItem struct {
+	Section     string    `json:"section"`
+	RatingKey   string    `json:"rating_key,omitempty"`
+	GUID        string    `json:"guid,omitempty"`
+	Type        string    `json:"type"` // "movie" or "show"
+	IMDbID      string    `json:"imdb_id,omitempty"`
+	TMDBID      string    `json:"tmdb_id,omitempty"`
+	TVDBID      string    `json:"tvdb_id,omitempty"`
+	Title       string    `json:"title"`
+	Year        int       `json:"year"`
+	Edition     string    `json:"edition,omitempty"`
+	Genres      []string  `json:"genres,omitempty"`
+	Resolution  string    `json:"resolution,omitempty"`
+	Audio       string    `json:"audio,omitempty"` // "stereo", "5.1" or "7.1"
+	HDR         bool      `json:"hdr,omitempty"`
+	Bitrate     int       `json:"bitrate,omitempty"` // kbps
+	AddedAt     time.Time `json:"added_at,omitempty"`
+	PlayCount   int       `json:"play_count,omitempty"`
+	LastWatched time.Time `json:"last_watched,omitempty"`
 
-type netflixLookup struct {
-	Result netflixLookupResult `json:"RESULT"`
+	// Ratings are keyed by source, e.g. "imdb", "tmdb",
+	// "rottentomatoes_critic" or "rottentomatoes_audience", on a 0-10 scale.
+	Ratings map[string]float64 `json:"ratings,omitempty"`
+	// Files are the local media files for the item. Plex may have several
+	// for one item.
+	Files []string `json:"files,omitempty"`
+	// Seasons are the season numbers of a show that are in the library.
+	Seasons []int `json:"seasons,omitempty"`
+	// Size is the total size in bytes of the item's media files, or of a
+	// show's episodes, when Plex reported it.
+	Size int64 `json:"size,omitempty"`
+	// Thumb is the Plex path of the item's poster.
+	Thumb string `json:"thumb,omitempty"`
+	// Poster is the poster as a data URL, fetched for HTML reports only.
+	Poster string `json:"-"`
 }
 
-type netflixLookupResult struct {
-	Country []netflixCountry `json:"country"`
+// key identifies the same movie or show across libraries and sources.
+func (m mediaItem) key() string {
+	switch {
+	case m.GUID != "" && !strings.HasPrefix(m.GUID, "local://"):
+		return m.GUID
+	case m.IMDbID != "":
+		return "imdb://" + m.IMDbID
+	default:
+		return fmt.Sprintf("%s (%d)", strings.ToLower(m.Title), m.Year)
+	}
 }
 
-type netflixCountry struct {
-	Code string `json:"ccode"`
+type options struct {
+	plexHost       string
+	plexPort       int
+	plexScheme     string
+	plexCACert     string
+	plexInsecure   bool
+	plexServer     string
+	excludeLabel   string
+	plexCollection string
+	plexLabel      string
+	playlist       string
+	discover       bool
+	tautulliURL    string
+	unwatchedFor   time.Duration
+	traktToken     string
+	simklToken     string
+	plexToken      string
+	radarrURL      string
+	sonarrURL      string
+	recordDir      string
+	replayDir      string
+	provider       string
+	configFile     string
+	olderThan      time.Duration
+	explain        bool
+	tokensFile     string
+	stateDir       string
+	followRemove   bool
+	unwatchlist    bool
+	radarrExcl     bool
+	radarrUnmon    bool
+	radarrTag      string
+	radarrDelete   bool
+	sonarrUnmon    string
+	dryRun         bool
+	delete         bool
+	review         bool
+	noColor        bool
+	logLevel       string
+	logFormat      string
+	quiet          bool
+	quarantineDir  string
+	retention      time.Duration
+	logFile        string
+	logOutput      string
+	country        string
+	output         string
+	out            string
+	concurrency    int
+	failFast       bool
+	year           int
+	input          string
+	source         string
+	interval       string
+	listen         string
+	diff           bool
+	leavingWithin  time.Duration
+	requireQuality string
+	requireAudio   string
+	requireSubs    string
+	requireAD      bool
+	breakdown      bool
+	minConfidence  float64
+	yearTolerance  int
+	overrides      string
+	keep           string
+	services       string
+	secretsFile    string
+	ejsonKeyDir    string
+	include        string
+	exclude        string
+	failOnFound    bool
 }
 
 func main() {
-	host := flag.String("plex-host", "localhost", "the hostname of the plex server")
+	var opts options
+	flag.StringVar(&opts.plexHost, "plex-host", "localhost", "the hostname of the plex server, overriding plex.host in the config")
+	flag.IntVar(&opts.plexPort, "plex-port", 32400, "the port of the plex server")
+	flag.StringVar(&opts.plexScheme, "plex-scheme", "http", "http, or https for servers that require secure connections")
+	flag.StringVar(&opts.plexCACert, "plex-ca-cert", "", "a PEM file of CA certificates to trust for the plex server")
+	flag.BoolVar(&opts.plexInsecure, "plex-insecure", false, "don't verify the plex server's TLS certificate")
+	flag.BoolVar(&opts.discover, "plex-discover", false, "find the plex server through the plex.tv account that owns PLEX_TOKEN instead of -plex-host")
+	flag.StringVar(&opts.excludeLabel, "exclude-label", "", "skip Plex items that have this label, e.g. p2n:keep")
+	flag.StringVar(&opts.plexCollection, "plex-collection", "", "put items found on Netflix into this Plex collection, e.g. \"Available on Netflix\"")
+	flag.StringVar(&opts.plexLabel, "plex-label", "", "give items found on Netflix this Plex label")
+	flag.StringVar(&opts.playlist, "create-playlist", "", "create or update a Plex playlist of the items found on Netflix, e.g. \"On Netflix\"")
+	flag.StringVar(&opts.plexServer, "plex-server", "", "the name of the server to use with -plex-discover, if the account has several")
+	flag.StringVar(&opts.tautulliURL, "tautulli-url", "", "the base URL of a Tautulli instance to read watch history from")
+	flag.Var((*ageValue)(&opts.unwatchedFor), "unwatched-for", "only flag items nobody has watched within this age, e.g. 365d (requires -tautulli-url)")
+	flag.Var((*ageValue)(&opts.olderThan), "older-than", "only flag items added at least this long ago, e.g. 180d")
+	flag.StringVar(&opts.traktToken, "trakt-token-file", "trakt_token.json", "where to store the Trakt OAuth token")
+	flag.StringVar(&opts.plexToken, "plex-token-file", "plex_token", "where plex2netflix login stores the Plex token")
+	flag.StringVar(&opts.simklToken, "simkl-token-file", "simkl_token", "where to store the Simkl OAuth token")
+	flag.StringVar(&opts.radarrURL, "radarr-url", "http://localhost:7878", "the base URL of the Radarr server")
+	flag.StringVar(&opts.sonarrURL, "sonarr-url", "http://localhost:8989", "the base URL of the Sonarr server")
+	flag.StringVar(&opts.configFile, "config", os.Getenv("PLEX2NETFLIX_CONFIG"), "path to a JSON or YAML config file")
+	flag.StringVar(&opts.provider, "provider", "unogs", "where to look up Netflix availability: unogs, streaming-availability, tmdb, justwatch, or mock for a small built-in demo catalog")
+	flag.BoolVar(&opts.explain, "explain", false, "log the cleaned title, provider queries, candidates and decision for every item")
+	flag.StringVar(&opts.stateDir, "state-dir", ".plex2netflix", "where results are kept between runs")
+	flag.BoolVar(&opts.followRemove, "follow-removed", false, "keep checking titles that were on Netflix after they leave the library, to be notified when they leave Netflix")
+	flag.BoolVar(&opts.unwatchlist, "watchlist-remove", false, "remove titles found on Netflix from the Plex watchlist")
+	flag.BoolVar(&opts.radarrExcl, "radarr-exclude", false, "add movies found on Netflix to Radarr's import exclusion list")
+	flag.BoolVar(&opts.radarrUnmon, "radarr-unmonitor", false, "unmonitor movies found on Netflix in Radarr")
+	flag.StringVar(&opts.radarrTag, "radarr-tag", "", "add this tag to movies found on Netflix in Radarr")
+	flag.BoolVar(&opts.radarrDelete, "radarr-delete", false, "delete movies found on Netflix from Radarr, with their files")
+	flag.StringVar(&opts.sonarrUnmon, "sonarr-unmonitor", "", "unmonitor seasons of shows found on Netflix in Sonarr: all to unmonitor a series once Netflix has every season, any to unmonitor each season Netflix has")
+	flag.BoolVar(&opts.delete, "delete", false, "delete items found on Netflix from Plex with their files, after listing them and asking for confirmation")
+	flag.BoolVar(&opts.review, "tui", false, "review the results at the terminal after a Plex scan: filter them, keep titles, open them on Netflix and queue them for deletion")
+	flag.StringVar(&opts.quarantineDir, "quarantine-dir", "", "move the files of items found on Netflix into this directory instead of deleting them, to be restored with undo")
+	opts.retention = defaultQuarantineRetention
+	flag.Var((*ageValue)(&opts.retention), "quarantine-retention", "how long files stay in -quarantine-dir before they're deleted, e.g. 30d")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "list what -delete would delete and what -quarantine-dir would move, and log the Radarr and Sonarr changes that would be made, without making them")
+	flag.StringVar(&opts.tokensFile, "tokens-file", "api_tokens.json", "where REST API tokens are stored")
+	flag.StringVar(&opts.recordDir, "record", "", "record every HTTP response to this directory")
+	flag.StringVar(&opts.replayDir, "replay", "", "serve HTTP responses recorded with -record from this directory instead of the network")
+	flag.BoolVar(&opts.noColor, "no-color", false, "don't color the results table")
+	flag.StringVar(&opts.logLevel, "log-level", "", "the lowest level to log: debug, info, warn or error, overriding log.level in the config")
+	flag.StringVar(&opts.logFormat, "log-format", "", "text or json, overriding log.format in the config")
+	flag.BoolVar(&opts.quiet, "quiet", false, "only log errors and print the report, for cron jobs and scripts")
+	flag.StringVar(&opts.logFile, "log-file", "", "write logs to this file instead of stdout, rotating it by size and age")
+	flag.StringVar(&opts.logOutput, "log-output", "stdout", "where logs go: stdout, syslog, or journald for stdout with priority prefixes")
+	flag.StringVar(&opts.country, "country", "", "comma-separated Netflix countries to check, overriding the config, or auto to detect the region")
+	flag.StringVar(&opts.country, "region", "", "the same as -country")
+	matchAll := flag.Bool("all-countries", false, "only count a title as found if it's on Netflix in every country, not just one")
+	flag.StringVar(&opts.output, "output", "", "also write every checked title to -out, as csv, json, ndjson, markdown or an html report")
+	flag.StringVar(&opts.output, "format", "", "the same as -output")
+	flag.StringVar(&opts.out, "out", "", "the file -output writes to, or - for stdout; defaults to plex2netflix.csv for csv, plex2netflix.html for html and stdout otherwise")
+	flag.IntVar(&opts.concurrency, "concurrency", 1, "how many items to look up at once; set unogs.requests_per_second to stay within the plan's rate limit")
+	flag.StringVar(&opts.include, "include-section", "", "comma-separated Plex library names or keys to scan, skipping every other library")
+	flag.StringVar(&opts.exclude, "exclude-section", "", "comma-separated Plex library names or keys to skip")
+	flag.StringVar(&opts.secretsFile, "secrets-file", os.Getenv("PLEX2NETFLIX_SECRETS_FILE"), "the secrets file to read (default secrets.json, or secrets.env)")
+	flag.StringVar(&opts.ejsonKeyDir, "ejson-keydir", envOr("EJSON_KEYDIR", defaultEJSONKeyDir), "where ejson's private keys are")
+	flag.StringVar(&opts.services, "services", "", "comma-separated streaming services to check: netflix, prime, disney+, hulu, max")
+	flag.Float64Var(&opts.minConfidence, "min-confidence", 0, "the lowest score, from 0 to 1, a title search result is taken at (default 0.85)")
+	flag.IntVar(&opts.yearTolerance, "year-tolerance", defaultYearTolerance, "how many years a search result's year can differ from the library's by")
+	flag.StringVar(&opts.overrides, "overrides", "", "a JSON file pinning titles to Netflix IDs, or to none, overriding overrides_file in the config")
+	flag.StringVar(&opts.keep, "keep", "", "a file listing titles to skip entirely, overriding keep_file in the config")
+	flag.BoolVar(&opts.failOnFound, "fail-on-found", false, "exit with status 3 if any title is found on Netflix, for alerting")
+	flag.BoolVar(&opts.failFast, "fail-fast", false, "stop at the first item that can't be looked up instead of skipping it")
+	flag.StringVar(&opts.interval, "interval", "", "how often serve scans, as a duration like 24h or a cron expression like \"0 3 * * *\", overriding serve.interval in the config (default 24h)")
+	flag.Var((*ageValue)(&opts.leavingWithin), "leaving-within", "don't act on titles leaving Netflix within this long, e.g. 30d, overriding leaving_within in the config")
+	flag.StringVar(&opts.requireQuality, "require-quality", "", "don't act on titles Netflix streams below this video quality: sd, hd or uhd, overriding require_quality in the config")
+	flag.StringVar(&opts.requireAudio, "require-audio", "", "comma-separated audio languages, e.g. ja, Netflix must offer for a title to count as found, overriding require_audio in the config")
+	flag.StringVar(&opts.requireSubs, "require-subs", "", "comma-separated subtitle languages, e.g. en, Netflix must offer for a title to count as found, overriding require_subtitles in the config")
+	flag.BoolVar(&opts.requireAD, "require-audio-description", false, "only count titles as found where Netflix has them with audio description, overriding require_audio_description in the config")
+	flag.BoolVar(&opts.breakdown, "country-breakdown", false, "add every country a title streams in to CSV and JSON output, with a column per country in CSV")
+	flag.BoolVar(&opts.diff, "diff", false, "show the titles that arrived on or left Netflix since the last run instead of every result")
+	flag.StringVar(&opts.listen, "listen", "", "the address serve takes Plex webhooks on, e.g. :8080, overriding serve.listen in the config")
+	flag.StringVar(&opts.source, "source", "library", "what the scan command checks: library, the Plex libraries, or watchlist, the plex.tv watchlist")
+	flag.StringVar(&opts.input, "input", "", "check the titles in this CSV or text file, or - for stdin, instead of scanning Plex")
+	flag.IntVar(&opts.year, "year", 0, "the release year of the title given to check")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Usage = usage
+	flag.Parse()
+	command, args := parseCommand()
+	switch opts.source {
+	case "library", "watchlist":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -source %q, use library or watchlist\n", opts.source)
+		os.Exit(2)
+	}
+	if command == "watchlist" {
+		opts.source, command = "watchlist", "scan"
+	}
+
+	if *showVersion || command == "version" {
+		fmt.Println(versionString())
+		return
+	}
 
 	logger := logrus.New()
 	logger.Formatter = &logrus.TextFormatter{}
 	logger.Out = os.Stdout
 
-	secrets, err := getSecrets()
+	if command == "token" {
+		manageTokens(logger, opts.tokensFile, args)
+		return
+	}
+
+	cfg, err := loadConfig(opts.configFile)
 	if err != nil {
-		logger.WithField("error", err).Fatal("getting secrets")
-		os.Exit(1)
+		logger.WithField("error", err).Fatal("loading config")
+	}
+	if opts.logFormat != "" {
+		cfg.Log.Format = opts.logFormat
+	}
+	switch cfg.Log.Format {
+	case "", "text":
+		if cfg.Timezone != "" || cfg.Locale != "" {
+			logger.Formatter = cfg.dates.logFormatter("text")
+		}
+	case "json":
+		logger.Formatter = cfg.dates.logFormatter("json")
+	default:
+		logger.Fatalf("unknown log format %q, use text or json", cfg.Log.Format)
+	}
+	opts.applyConfig(cfg)
+	if cfg.Plex.Scheme != "http" && cfg.Plex.Scheme != "https" {
+		logger.Fatalf("unknown plex scheme %q, use http or https", cfg.Plex.Scheme)
+	}
+	switch opts.output {
+	case "":
+	case "csv":
+		if opts.out == "" {
+			opts.out = "plex2netflix.csv"
+		}
+	case "json", "markdown", "ndjson":
+		if opts.out == "" {
+			opts.out = "-"
+		}
+	case "html":
+		if opts.out == "" {
+			opts.out = "plex2netflix.html"
+		}
+	default:
+		logger.Fatalf("unknown -output %q, use csv, json, ndjson, html or markdown", opts.output)
+	}
+	if opts.out == "-" {
+		// Keep stdout for the report, so it can be piped.
+		logger.Out = os.Stderr
+	}
+	if opts.country != "" {
+		cfg.Countries = lowerAll(strings.Split(opts.country, ","))
+	}
+	if opts.services != "" {
+		if err := cfg.setServices(strings.Split(opts.services, ",")); err != nil {
+			logger.WithField("error", err).Fatal("parsing -services")
+		}
+	}
+	if *matchAll {
+		cfg.CountryMatch = "all"
+	}
+	if opts.requireQuality != "" {
+		if cfg.RequireQuality, err = parseQuality(opts.requireQuality); err != nil {
+			logger.WithField("error", err).Fatal("parsing -require-quality")
+		}
+	}
+	if opts.delete && opts.quarantineDir != "" {
+		logger.Fatal("-delete and -quarantine-dir can't be used together")
+	}
+	if stat, err := os.Stdin.Stat(); opts.review && (err != nil || stat.Mode()&os.ModeCharDevice == 0) {
+		logger.Fatal("-tui needs a terminal")
+	}
+	switch opts.sonarrUnmon {
+	case "", "all", "any":
+	default:
+		logger.Fatalf("unknown -sonarr-unmonitor %q, use all or any", opts.sonarrUnmon)
+	}
+	if opts.logFile != "" {
+		out, err := openRotatingFile(opts.logFile, cfg.Log)
+		if err != nil {
+			logger.WithField("error", err).Fatal("opening log file")
+		}
+		logger.Out = out
+	}
+	if err := setLogOutput(logger, opts.logOutput, cfg.Log.Format); err != nil {
+		logger.WithField("error", err).Fatal("setting log output")
+	}
+	if opts.logLevel != "" {
+		cfg.Log.Level = opts.logLevel
+	}
+	if opts.quiet {
+		cfg.Log.Level = "error"
+	}
+	if cfg.Log.Level != "" {
+		level, err := logrus.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			logger.WithField("error", err).Fatal("parsing log level")
+		}
+		logger.SetLevel(level)
 	}
 
-	plexConn, err := plex.New(fmt.Sprintf("http://%s:32400", *host), secrets["PLEX_TOKEN"])
+	switch command {
+	case "history":
+		showHistory(logger, cfg, opts.stateDir, args)
+		return
+	case "stats":
+		showStats(logger, cfg, opts.stateDir)
+		return
+	case "undo":
+		if opts.quarantineDir == "" {
+			logger.Fatal("usage: plex2netflix -quarantine-dir <dir> undo [title]")
+		}
+		q := &quarantine{logger: logger, dir: opts.quarantineDir, retention: opts.retention}
+		q.undo(strings.Join(args, " "))
+		return
+	case "cache":
+		manageCache(logger, cfg, opts.stateDir, args)
+		return
+	case "export":
+		if len(args) != 1 {
+			logger.Fatal("usage: plex2netflix export <results.csv|results.json>")
+		}
+		runExport(logger, cfg, opts.stateDir, args[0], opts.breakdown)
+		return
+	case "report":
+		switch {
+		case len(args) == 0:
+			runReport(logger, cfg, opts)
+		case len(args) == 1 && args[0] == "diff":
+			showChanges(logger, cfg, opts.stateDir)
+		default:
+			logger.Fatal("usage: plex2netflix report [diff]")
+		}
+		return
+	case "diff":
+		if len(args) != 2 {
+			logger.Fatal("usage: plex2netflix diff old.json new.json")
+		}
+		showDiff(logger, cfg, args[0], args[1])
+		return
+	}
+
+	transport, err := newPlexTransport(cfg.Plex, http.DefaultTransport)
 	if err != nil {
-		logger.WithField("error", err).Fatal("creating plex client")
-		os.Exit(1)
+		logger.WithField("error", err).Fatal("setting up TLS for plex")
+	}
+	switch {
+	case opts.recordDir != "" && opts.replayDir != "":
+		logger.Fatal("-record and -replay can't be used together")
+	case opts.recordDir != "":
+		transport = fixtureTransport{dir: opts.recordDir, next: transport}
+	case opts.replayDir != "":
+		transport = fixtureTransport{dir: opts.replayDir, replay: true}
 	}
+	tracer := newTracer(cfg.Tracing, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	if tracer != nil {
+		transport = tracingTransport{tracer: tracer, next: transport}
+	}
+	httpClient.Transport = userAgentTransport{cfg.UserAgent, transport}
 
-	sections, err := plexConn.GetLibraries()
+	if command == "login" {
+		if err := plexLogin(logger, opts.plexToken); err != nil {
+			logger.WithField("error", err).Fatal("signing in to plex.tv")
+		}
+		logger.WithField("file", opts.plexToken).Info("saved Plex token")
+		return
+	}
+
+	secrets, err := getSecrets(opts.secretsFile, opts.ejsonKeyDir)
 	if err != nil {
-		logger.WithField("error", err).Fatal("getting libraries")
+		logger.WithField("error", err).Fatal("getting secrets")
 		os.Exit(1)
 	}
+	if secrets["PLEX_TOKEN"] == "" {
+		if secrets["PLEX_TOKEN"], err = readPlexToken(opts.plexToken); err != nil {
+			logger.WithField("error", err).Fatal("reading Plex token")
+		}
+	}
 
-	for _, dir := range sections.MediaContainer.Directory {
-		logger.WithField("section", dir.Title).Info("searching section")
-		results, err := plexConn.GetLibraryContent(dir.Key, "")
+	if err := resolveAutoCountries(logger, cfg, secrets["PLEX_TOKEN"]); err != nil {
+		logger.WithField("error", err).Fatal("detecting Netflix region")
+	}
+
+	switch command {
+	case "benchmark":
+		if len(args) > 1 {
+			logger.Fatal("usage: plex2netflix benchmark [titles.csv]")
+		}
+		runBenchmark(logger, cfg, secrets, opts.stateDir, strings.Join(args, ""))
+		return
+	case "digest":
+		runDigest(logger, cfg, secrets, opts.stateDir, args)
+		return
+	}
+
+	var cache *lookupCache
+	if cfg.Cache.ttl > 0 {
+		cache, err = loadCache(cfg.Cache, opts.stateDir)
 		if err != nil {
-			logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting library")
+			logger.WithField("error", err).Fatal("loading cache")
 		}
+	}
 
-		for _, metadata := range results.MediaContainer.Metadata {
-			found, err := findOnNetflix(metadata.Title, metadata.Year, secrets["RAPID_API_KEY"])
+	limiters := newLimiterPool(logger, cfg.Unogs, opts.stateDir)
+	p, err := newProvider(logger, opts.provider, cfg, secrets, cache, limiters)
+	if err != nil {
+		logger.WithField("error", err).Fatal("creating provider")
+	}
+	if _, ok := p.(serviceProvider); !ok && !cfg.netflixOnly() {
+		logger.WithField("provider", opts.provider).Fatal("this provider only knows about netflix, use tmdb, justwatch or streaming-availability to check other services")
+	}
+	if err := checkRequireQuality(cfg, p); err != nil {
+		logger.WithField("provider", opts.provider).WithField("error", err).Fatal("checking -require-quality")
+	}
+
+	history, err := loadHistory(opts.stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading history")
+	}
+	pinned, err := loadOverrides(cfg.OverridesFile)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading overrides")
+	}
+	keep, err := loadKeepList(cfg.KeepFile)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading keep list")
+	}
+
+	chk := &checker{
+		logger:        logger,
+		provider:      p,
+		cfg:           cfg,
+		olderThan:     opts.olderThan,
+		explain:       opts.explain,
+		history:       history,
+		cache:         cache,
+		limiters:      limiters,
+		tracer:        tracer,
+		activity:      newActivityLog(logger, opts.stateDir),
+		stateDir:      opts.stateDir,
+		notifier:      &notifier{logger: logger, cfg: cfg.Notify},
+		followRemoved: opts.followRemove,
+		concurrency:   opts.concurrency,
+		failFast:      opts.failFast,
+		overrides:     pinned,
+		keep:          keep,
+		table:         useTable(opts),
+		changesOnly:   opts.diff,
+	}
+	if secrets["TMDB_API_KEY"] != "" {
+		chk.tmdb = &tmdbClient{apiKey: secrets["TMDB_API_KEY"]}
+	}
+	if opts.output == "ndjson" {
+		chk.stream = os.Stdout
+		if opts.out != "-" {
+			f, err := os.Create(opts.out)
 			if err != nil {
-				logger.WithField("error", err).WithField("title", metadata.Title).Fatal("finding on Netflix")
+				logger.WithField("error", err).Fatal("creating output file")
 			}
+			chk.stream = f
+		}
+	}
 
-			if found {
-				logger.WithField("title", metadata.Title).Info("found on netflix")
+	// Save what has been checked so far if the run is cut short.
+	logrus.RegisterExitHandler(chk.flush)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		logger.WithField("signal", sig).Warn("interrupted, saving the results checked so far")
+		chk.flush()
+		os.Exit(1)
+	}()
+
+	var results []checkResult
+	switch command {
+	case "check":
+		if len(args) == 0 {
+			logger.Fatal("usage: plex2netflix check <title> [-year <year>]")
+		}
+		title, year := strings.Join(args, " "), opts.year
+		if year == 0 {
+			title, year = parseReleaseName(title)
+		}
+		// A one-off check leaves the last scan's results and the history
+		// alone.
+		chk.history = nil
+		results = chk.check([]mediaItem{{Section: "check", Type: "movie", Title: title, Year: year}})
+		if len(results) == 1 && !results[0].Found && results[0].Error == "" && !chk.table {
+			logger.WithField("title", title).WithField("year", year).Info("not on netflix")
+		}
+	case "scan-dir":
+		if len(args) != 1 {
+			logger.Fatal("usage: plex2netflix scan-dir <directory>")
+		}
+		items, err := scanDir(args[0])
+		if err != nil {
+			logger.WithField("error", err).Fatal("scanning directory")
+		}
+		results = chk.check(items)
+	case "letterboxd":
+		if len(args) != 1 {
+			logger.Fatal("usage: plex2netflix letterboxd <watchlist.csv>")
+		}
+		items, err := readLetterboxdExport(args[0])
+		if err != nil {
+			logger.WithField("error", err).Fatal("reading Letterboxd export")
+		}
+		results = chk.check(items)
+		reportToSource(logger, results)
+	case "imdb":
+		if len(args) != 1 {
+			logger.Fatal("usage: plex2netflix imdb <export.csv>")
+		}
+		items, err := readIMDbExport(args[0])
+		if err != nil {
+			logger.WithField("error", err).Fatal("reading IMDb export")
+		}
+		results = chk.check(items)
+		reportToSource(logger, results)
+	case "trakt":
+		if len(args) != 1 {
+			logger.Fatal("usage: plex2netflix trakt watchlist|collection")
+		}
+		trakt := &traktClient{
+			clientID:     secrets["TRAKT_CLIENT_ID"],
+			clientSecret: secrets["TRAKT_CLIENT_SECRET"],
+			tokenFile:    opts.traktToken,
+		}
+		if err := trakt.authorize(logger); err != nil {
+			logger.WithField("error", err).Fatal("authorizing with Trakt")
+		}
+		items, err := trakt.list(args[0])
+		if err != nil {
+			logger.WithField("error", err).Fatal("getting Trakt list")
+		}
+		results = chk.check(items)
+		reportToSource(logger, results)
+	case "simkl":
+		list := "plantowatch"
+		if len(args) == 1 {
+			list = args[0]
+		} else if len(args) > 1 {
+			logger.Fatal("usage: plex2netflix simkl [plantowatch|watching|completed|hold|dropped]")
+		}
+		simkl := &simklClient{clientID: secrets["SIMKL_CLIENT_ID"], tokenFile: opts.simklToken}
+		if err := simkl.authorize(logger); err != nil {
+			logger.WithField("error", err).Fatal("authorizing with Simkl")
+		}
+		items, err := simkl.list(list)
+		if err != nil {
+			logger.WithField("error", err).Fatal("getting Simkl list")
+		}
+		results = chk.check(items)
+		reportToSource(logger, results)
+	case "radarr", "sonarr":
+		arr := &arrClient{name: "Radarr", baseURL: opts.radarrURL, apiKey: secrets["RADARR_API_KEY"]}
+		if command == "sonarr" {
+			arr = &arrClient{name: "Sonarr", baseURL: opts.sonarrURL, apiKey: secrets["SONARR_API_KEY"]}
+		}
+		items, err := arr.media()
+		if err != nil {
+			logger.WithField("error", err).Fatalf("getting %s library", arr.name)
+		}
+		results = chk.check(items)
+		applyActions(logger, opts, cfg, secrets, results)
+	case "scan":
+		if len(args) != 0 {
+			logger.Fatal("usage: plex2netflix scan")
+		}
+		results = scanSource(chk, opts, secrets, nil)
+	case "serve":
+		if len(args) != 0 {
+			logger.Fatal("usage: plex2netflix serve [-interval <interval|cron expression>]")
+		}
+		if opts.delete || opts.review || opts.failFast {
+			logger.Fatal("-delete, -tui and -fail-fast can't be used with serve, try -quarantine-dir instead of -delete")
+		}
+		if cfg.Serve.Interval == "" {
+			cfg.Serve.Interval = "24h"
+		}
+		sched, err := parseSchedule(cfg.Serve.Interval)
+		if err != nil {
+			logger.WithField("error", err).Fatal("parsing -interval")
+		}
+		s := &server{
+			logger:   logger,
+			cfg:      cfg,
+			schedule: sched,
+			notifier: chk.notifier,
+			scan: func(previous []checkResult) []checkResult {
+				return scanSource(chk, opts, secrets, previous)
+			},
+			apply: func(results []checkResult) {
+				applyActions(logger, opts, cfg, secrets, results)
+			},
+			checker: chk,
+			include: sectionSet(opts.include),
+			exclude: sectionSet(opts.exclude),
+		}
+		s.catchFatal()
+		if cfg.Serve.Listen != "" {
+			verifier, err := newWebhookVerifier(logger, cfg.Webhook, secrets["WEBHOOK_SECRET"])
+			if err != nil {
+				logger.WithField("error", err).Fatal("setting up webhooks")
+			}
+			if secrets["WEBHOOK_SECRET"] == "" && len(cfg.Webhook.AllowedSources) == 0 {
+				logger.Warn("taking webhooks from anyone, set WEBHOOK_SECRET in secrets.json or webhook.allowed_sources in the config")
+			}
+			tokens, err := loadTokenStore(opts.tokensFile)
+			if err != nil {
+				logger.WithField("error", err).Fatal("loading API tokens")
+			}
+			auth, err := newAuthenticator(logger, cfg.Auth, secrets["HTTP_PASSWORD"], tokens)
+			if err != nil {
+				logger.WithField("error", err).Fatal("setting up authentication")
+			}
+			if cfg.Auth.Mode == "" || cfg.Auth.Mode == "none" {
+				logger.Warn("anyone who can reach -listen can see results, scan and apply actions without a token, set auth in the config")
+			}
+			if err := s.listen(cfg.Serve.Listen, verifier, auth); err != nil {
+				logger.WithField("error", err).Fatal("listening")
 			}
 		}
+		if saved, err := loadLastResults(opts.stateDir); err == nil {
+			s.results = saved.Results
+		}
+		chk.table, chk.changesOnly = false, true
+		s.run()
 	}
-}
 
-func findOnNetflix(title string, year int, apiKey string) (bool, error) {
-	netflixID, err := findNetflixID(title, year, apiKey)
-	if err != nil {
-		return false, errors.Wrap(err, "finding Netflix ID")
+	if opts.diff && results != nil {
+		showChanges(logger, cfg, opts.stateDir)
+	} else if chk.table && results != nil {
+		printResultsTable(os.Stdout, results, cfg.dates, !opts.noColor && os.Getenv("NO_COLOR") == "")
+	}
+	if opts.output != "" && opts.output != "ndjson" {
+		if err := exportResults(opts.out, opts.output, results, opts.breakdown, cfg.dates); err != nil {
+			logger.WithField("error", err).Fatal("writing output")
+		}
+		if opts.out != "-" {
+			logger.WithField("file", opts.out).Info("wrote results")
+		}
 	}
+	if f, ok := chk.stream.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			logger.WithField("error", err).Fatal("writing output")
+		}
+	}
+	os.Exit(exitCode(results, opts.failOnFound))
+}
 
-	if netflixID == "" {
-		return false, nil
+// Exit codes. Fatal errors, e.g. in the configuration, exit with 1 through
+// logrus.
+const (
+	exitErrors = 2
+	exitFound  = 3
+)
+
+// exitCode returns 0 for a scan that completed, exitErrors when some titles
+// couldn't be checked, and exitFound when failOnFound is set and titles were
+// found on Netflix.
+func exitCode(results []checkResult, failOnFound bool) int {
+	for _, result := range results {
+		if result.Error != "" {
+			return exitErrors
+		}
+	}
+	if failOnFound && countFound(results) > 0 {
+		return exitFound
 	}
+	return 0
+}
+
+// applyConfig fills in the options that weren't given on the command line
+// from the config, and the settings that were given into the config.
+func (opts *options) applyConfig(cfg *config) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-	return findOnNetflixUSA(netflixID, apiKey)
+	if set["plex-host"] {
+		cfg.Plex.Host = opts.plexHost
+	}
+	if set["plex-port"] {
+		cfg.Plex.Port = opts.plexPort
+	}
+	if set["plex-scheme"] {
+		cfg.Plex.Scheme = opts.plexScheme
+	}
+	if set["plex-ca-cert"] {
+		cfg.Plex.CACert = opts.plexCACert
+	}
+	if set["plex-insecure"] {
+		cfg.Plex.InsecureSkipVerify = opts.plexInsecure
+	}
+	if set["plex-discover"] {
+		cfg.Plex.Discover = opts.discover
+	}
+	if set["plex-server"] {
+		cfg.Plex.Server = opts.plexServer
+		cfg.Plex.Discover = true
+	}
+	if set["exclude-label"] {
+		cfg.Plex.ExcludeLabel = opts.excludeLabel
+	}
+	if set["plex-collection"] {
+		cfg.Plex.Collection = opts.plexCollection
+	}
+	if set["leaving-within"] {
+		cfg.leavingWithin = opts.leavingWithin
+	}
+	if set["require-audio"] {
+		cfg.RequireAudio = languageCodeList(opts.requireAudio)
+	}
+	if set["require-subs"] {
+		cfg.RequireSubtitles = languageCodeList(opts.requireSubs)
+	}
+	if set["require-audio-description"] {
+		cfg.RequireAudioDescription = opts.requireAD
+	}
+	if set["interval"] {
+		cfg.Serve.Interval = opts.interval
+	}
+	if set["listen"] {
+		cfg.Serve.Listen = opts.listen
+	}
+	if set["plex-label"] {
+		cfg.Plex.Label = opts.plexLabel
+	}
+	if set["create-playlist"] {
+		cfg.Plex.Playlist = opts.playlist
+	}
+	opts.plexHost = cfg.Plex.Host
+	if !set["state-dir"] {
+		opts.stateDir = cfg.StateDir
+	}
+	if !set["output"] && !set["format"] {
+		opts.output = cfg.Output
+	}
+	if !set["out"] {
+		opts.out = cfg.Out
+	}
+	if !set["concurrency"] {
+		opts.concurrency = cfg.Concurrency
+	}
+	if !set["country-breakdown"] {
+		opts.breakdown = cfg.CountryBreakdown
+	}
+	if set["min-confidence"] {
+		cfg.MinConfidence = opts.minConfidence
+	}
+	if set["overrides"] {
+		cfg.OverridesFile = opts.overrides
+	}
+	if set["keep"] {
+		cfg.KeepFile = opts.keep
+	}
+	if set["year-tolerance"] {
+		cfg.YearTolerance = &opts.yearTolerance
+	}
 }
 
-func findNetflixID(title string, year int, apiKey string) (string, error) {
-	r, err := regexp.Compile(`\(\d{4}\)$`)
-	if err != nil {
-		return "", errors.Wrap(err, "compiling regexp")
-	}
-	title = r.ReplaceAllString(title, "")
-	title = strings.Replace(title, "'", "", -1)
-	title = strings.TrimSpace(title)
-
-	bytes, err := callUnogs(
-		fmt.Sprintf(
-			"https://unogs-unogs-v1.p.rapidapi.com/aaapi.cgi?q=%s-!%d,%d-!0,5-!0,10-!0-!Any-!Any-!Any-!gt100-!{downloadable}&t=ns&cl=all&st=adv&ob=Relevance&p=1&sa=and",
-			url.QueryEscape(title),
-			year,
-			year,
-		),
-		apiKey,
-	)
-	if err != nil {
-		return "", err
+// applyActions acts on the results of a library scan as configured by the
+// command line flags.
+func applyActions(logger *logrus.Logger, opts options, cfg *config, secrets map[string]string, results []checkResult) {
+	radarr := &arrClient{name: "Radarr", baseURL: opts.radarrURL, apiKey: secrets["RADARR_API_KEY"]}
+	if opts.radarrExcl {
+		radarr.excludeStreamable(logger, cfg, newActivityLog(logger, opts.stateDir), results, opts.dryRun)
 	}
-	var result unogsResponse
-	err = json.Unmarshal(bytes, &result)
-	if err != nil {
-		return "", errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+	if opts.sonarrUnmon != "" {
+		sonarr := &arrClient{name: "Sonarr", baseURL: opts.sonarrURL, apiKey: secrets["SONARR_API_KEY"]}
+		sonarr.unmonitorSeasons(logger, cfg, newActivityLog(logger, opts.stateDir), results, opts.sonarrUnmon, opts.dryRun)
 	}
+	cleanup := radarrCleanup{unmonitor: opts.radarrUnmon, tag: opts.radarrTag, delete: opts.radarrDelete, dryRun: opts.dryRun}
+	if cleanup.unmonitor || cleanup.tag != "" || cleanup.delete {
+		radarr.cleanUp(logger, cfg, newActivityLog(logger, opts.stateDir), results, cleanup)
+	}
+}
 
-	for _, item := range result.Items {
-		if item["title"] == title {
-			return item["netflixid"], nil
+// scanSource checks the titles from -input, or else from -source, and
+// applies the actions to those found on Netflix that weren't in previous.
+func scanSource(chk *checker, opts options, secrets map[string]string, previous []checkResult) []checkResult {
+	logger, cfg := chk.logger, chk.cfg
+	var results []checkResult
+	switch {
+	case opts.input != "":
+		items, err := readTitleList(opts.input)
+		if err != nil {
+			logger.WithField("error", err).Fatal("reading title list")
 		}
+		results = chk.check(items)
+	case opts.source == "watchlist":
+		watchlist := &plexWatchlist{token: secrets["PLEX_TOKEN"]}
+		items, err := watchlist.items()
+		if err != nil {
+			logger.WithField("error", err).Fatal("getting Plex watchlist")
+		}
+		results = chk.check(items)
+		reportToSource(logger, results)
+		if opts.unwatchlist {
+			watchlist.removeStreamable(logger, cfg, chk.activity, arrivedOnNetflix(previous, results))
+		}
+		return results
+	default:
+		results = scanPlex(chk, opts, secrets, previous)
 	}
-
-	return "", nil
+	applyActions(logger, opts, cfg, secrets, arrivedOnNetflix(previous, results))
+	return results
 }
 
-func findOnNetflixUSA(id, apiKey string) (bool, error) {
-	bytes, err := callUnogs(fmt.Sprintf("https://unogs-unogs-v1.p.rapidapi.com/aaapi.cgi?t=loadvideo&q=%s", id), apiKey)
+// scanPlex checks the Plex libraries. Collections, labels and the playlist
+// are kept in step with all the results, and the other actions are applied
+// to those found on Netflix that weren't in previous.
+func scanPlex(chk *checker, opts options, secrets map[string]string, previous []checkResult) []checkResult {
+	logger := chk.logger
+	plexURL, token := chk.cfg.Plex.url(), secrets["PLEX_TOKEN"]
+	if chk.cfg.Plex.Discover {
+		var err error
+		plexURL, token, err = discoverPlexServer(token, chk.cfg.Plex.Server)
+		if err != nil {
+			logger.WithField("error", err).Fatal("discovering plex server")
+		}
+		logger.WithField("url", plexURL).Info("found plex server")
+	}
+	span := chk.tracer.start("scan").setString("plex_url", plexURL)
+	plexConn, err := plex.New(plexURL, token)
 	if err != nil {
-		return false, err
+		logger.WithField("error", err).Fatal("creating plex client")
+		os.Exit(1)
 	}
-	var lookup netflixLookup
-	err = json.Unmarshal(bytes, &lookup)
+	plexConn.HTTPClient.Transport = httpClient.Transport
+
+	sections, err := plexConn.GetLibraries()
 	if err != nil {
-		return false, errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+		logger.WithField("error", err).Fatal("getting libraries")
+		os.Exit(1)
 	}
 
-	for _, country := range lookup.Result.Country {
-		if country.Code == "us" {
-			return true, nil
+	var tautulli *tautulliClient
+	var household map[string]bool
+	if opts.tautulliURL != "" {
+		tautulli = &tautulliClient{baseURL: opts.tautulliURL, apiKey: secrets["TAUTULLI_API_KEY"]}
+		if chk.cfg.Household.WatchedBy == "everyone" {
+			household, err = tautulli.householdUsers(chk.cfg.Household.Users)
+			if err != nil {
+				logger.WithField("error", err).Fatal("getting household users from Tautulli")
+			}
 		}
 	}
 
-	return false, nil
-}
+	include, exclude := sectionSet(opts.include), sectionSet(opts.exclude)
+	var items []mediaItem
+	tagged := map[string]plexTagged{}
+	for _, dir := range sections.MediaContainer.Directory {
+		if (len(include) > 0 && !sectionIn(include, dir)) || sectionIn(exclude, dir) {
+			logger.WithField("section", dir.Title).Debug("skipping section")
+			continue
+		}
+		// Music and photo libraries can't be on Netflix, unless they're
+		// holding videos and were asked for by name.
+		if dir.Type != "movie" && dir.Type != "show" && !sectionIn(include, dir) {
+			logger.WithField("section", dir.Title).WithField("type", dir.Type).Info("skipping section that isn't movies or shows")
+			continue
+		}
+		logger.WithField("section", dir.Title).Info("searching section")
+		librarySpan := chk.tracer.start("library").setString("library", dir.Title)
+		results, err := getPlexLibrary(plexConn, dir.Key)
+		librarySpan.setInt("items", len(results))
+		if err != nil {
+			logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting library")
+		}
 
-func getSecrets() (map[string]string, error) {
-	bytes, err := ejson.DecryptFile("secrets.json", "/opt/ejson/keys", "")
-	if err != nil {
-		return nil, errors.Wrap(err, "reading secrets.json")
-	}
-	secrets := map[string]string{}
-	err = json.Unmarshal(bytes, &secrets)
-	if err != nil {
-		return nil, errors.Wrap(err, "unmarshaling secrets")
+		var seasons map[string][]int
+		var showSizes map[string]int64
+		if dir.Type == "show" {
+			seasons, err = getPlexSeasons(plexConn, dir.Key)
+			if err != nil {
+				logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting seasons")
+			}
+			showSizes, err = getPlexShowSizes(plexConn, dir.Key)
+			if err != nil {
+				logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting episode sizes")
+			}
+		}
+
+		sectionItems := make([]mediaItem, 0, len(results))
+		for _, metadata := range results {
+			typ := metadata.mediaType()
+			if typ == "" {
+				logger.WithField("title", metadata.Title).WithField("type", metadata.Type).Debug("skipping item that isn't a movie or show")
+				continue
+			}
+			if label := chk.cfg.Plex.ExcludeLabel; label != "" && metadata.hasLabel(label) {
+				logger.WithField("title", metadata.Title).WithField("label", label).Info("skipping item with the exclude label")
+				continue
+			}
+			title, year := metadata.Title, metadata.Year
+			if metadata.unmatched() && year == 0 {
+				if parsed, parsedYear := parseReleaseName(title); parsed != "" {
+					title, year = parsed, parsedYear
+				}
+			}
+
+			imdbID, tmdbID, tvdbID := metadata.externalIDs()
+			var lastViewed time.Time
+			if metadata.LastViewedAt != 0 {
+				lastViewed = time.Unix(metadata.LastViewedAt, 0)
+			}
+
+			tagged[metadata.RatingKey] = plexTagged{
+				sectionKey:  dir.Key,
+				typ:         typ,
+				labels:      tags(metadata.Label),
+				collections: tags(metadata.Collection),
+			}
+			size := metadata.size()
+			if typ == "show" {
+				size = showSizes[metadata.RatingKey]
+			}
+			edition := metadata.EditionTitle
+			if edition == "" {
+				edition = detectEdition(metadata.file())
+			}
+			sectionItems = append(sectionItems, mediaItem{
+				Section:     dir.Title,
+				RatingKey:   metadata.RatingKey,
+				GUID:        metadata.GUID,
+				IMDbID:      imdbID,
+				TMDBID:      tmdbID,
+				TVDBID:      tvdbID,
+				Type:        typ,
+				Genres:      tags(metadata.Genre),
+				Resolution:  metadata.resolution(),
+				Audio:       metadata.audio(),
+				HDR:         metadata.hdr(),
+				Bitrate:     metadata.bitrate(),
+				Title:       title,
+				Year:        year,
+				Edition:     edition,
+				Ratings:     metadata.ratings(),
+				AddedAt:     time.Unix(metadata.AddedAt, 0),
+				PlayCount:   metadata.ViewCount,
+				LastWatched: lastViewed,
+				Files:       metadata.files(),
+				Seasons:     seasons[metadata.RatingKey],
+				Size:        size,
+				Thumb:       metadata.Thumb,
+			})
+		}
+
+		if tautulli != nil {
+			history, err := tautulli.libraryWatchHistory(dir.Key)
+			if err != nil {
+				logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting watch history from Tautulli")
+			}
+			if household != nil {
+				perUser, err := tautulli.userWatchHistory(dir.Key)
+				if err != nil {
+					logger.WithField("error", err).WithField("library", dir.Key).Fatal("getting per-user watch history from Tautulli")
+				}
+				history = watchedByEveryone(history, perUser, household)
+			}
+			sectionItems = applyWatchHistory(logger, chk.cfg, sectionItems, history, opts.unwatchedFor)
+		}
+		librarySpan.end(nil)
+		items = append(items, sectionItems...)
 	}
-	return secrets, nil
-}
 
-func callUnogs(url, apiKey string) ([]byte, error) {
-	httpClient := http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating request")
+	// Checking every library at once lets the checker spot the same movie in
+	// several libraries.
+	results := chk.check(items)
+	if opts.output == "html" {
+		addPosters(logger, plexConn, results)
 	}
-	req.Header.Add("X-RapidAPI-Key", apiKey)
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	if chk.cfg.Plex.Collection != "" || chk.cfg.Plex.Label != "" {
+		tagPlexResults(logger, plexConn, chk.cfg.Plex, tagged, results)
+	}
+	if playlist := chk.cfg.Plex.Playlist; playlist != "" {
+		if n, err := syncPlexPlaylist(plexConn, playlist, results); err != nil {
+			logger.WithField("error", err).WithField("playlist", playlist).Warn("updating plex playlist")
+		} else {
+			logger.WithField("playlist", playlist).WithField("items", n).Info("updated plex playlist")
+		}
+	}
+	if opts.review {
+		if queued := reviewResults(logger, chk.cfg.KeepFile, os.Stdin, os.Stderr, results); len(queued) > 0 {
+			deletePlexItems(logger, plexConn, chk.cfg, chk.activity, queued, opts.dryRun)
+		}
 	}
+	if opts.delete {
+		deletePlexItems(logger, plexConn, chk.cfg, chk.activity, results, opts.dryRun)
+	}
+	if opts.quarantineDir != "" {
+		q := &quarantine{logger: logger, dir: opts.quarantineDir, retention: opts.retention}
+		q.quarantineItems(plexConn, chk.cfg, chk.activity, arrivedOnNetflix(previous, results), opts.dryRun)
+	}
+	span.end(nil)
+	if err := chk.tracer.flush(); err != nil {
+		logger.WithField("error", err).Warn("exporting traces")
+	}
+	return results
+}
 
-	bytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "reading uNoGS body")
+// sectionSet parses a comma-separated list of library names or keys.
+func sectionSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, section := range strings.Split(list, ",") {
+		if section = strings.ToLower(strings.TrimSpace(section)); section != "" {
+			set[section] = true
+		}
 	}
+	return set
+}
 
-	return bytes, nil
+// sectionIn reports whether a library is in the set, by name or key.
+func sectionIn(set map[string]bool, dir plex.Directory) bool {
+	return set[strings.ToLower(dir.Title)] || set[dir.Key]
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultMinConfidence is the lowest match score a candidate title can have
+// and still be taken as the item.
+const defaultMinConfidence = 0.85
+
+// defaultYearTolerance is how many years Plex and the provider can disagree
+// on a title's year by.
+const defaultYearTolerance = 1
+
+var diacritics = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "č", "c", "ć", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n", "ń", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ý", "y", "ÿ", "y", "ß", "ss", "š", "s", "ž", "z",
+)
+
+// normalizeTitle folds case and diacritics, spells out "&", drops
+// punctuation and leading or trailing articles, so "Amélie" matches "Amelie"
+// and "Matrix, The" matches "The Matrix".
+func normalizeTitle(title string) string {
+	title = diacritics.Replace(strings.ToLower(title))
+	title = strings.Replace(title, "&", " and ", -1)
+	title = strings.Replace(title, "'", "", -1)
+	title = strings.Replace(title, "’", "", -1)
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 {
+		switch words[0] {
+		case "the", "a", "an":
+			words = words[1:]
+		}
+	}
+	if len(words) > 1 && words[len(words)-1] == "the" {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// mainTitle returns the title without its subtitle, e.g. "Birdman" for
+// "Birdman or (The Unexpected Virtue of Ignorance)".
+func mainTitle(title string) string {
+	if i := strings.IndexAny(title, ":("); i > 0 {
+		title = title[:i]
+	}
+	if i := strings.Index(title, " - "); i > 0 {
+		title = title[:i]
+	}
+	title = strings.TrimSpace(title)
+	return strings.TrimSuffix(title, " or")
+}
+
+// titleScore returns how alike two titles are, from 0 to 1. Titles that are
+// the same once normalized score 1, titles where one has a subtitle the
+// other lacks score 0.9, and anything else scores by edit distance.
+func titleScore(a, b string) float64 {
+	score, subtitled := compareTitles(a, b)
+	if subtitled && score < 0.9 {
+		score = 0.9
+	}
+	return score
+}
+
+// compareTitles returns the edit distance score of two titles once
+// normalized, and whether they differ only by a subtitle one of them has.
+func compareTitles(a, b string) (float64, bool) {
+	na, nb := normalizeTitle(a), normalizeTitle(b)
+	if na == nb {
+		return 1, false
+	}
+	// Only one side may have a subtitle: franchise entries like "Star Trek:
+	// Picard" and "Star Trek: Lower Decks" share a main title but aren't the
+	// same title.
+	subtitled := na == normalizeTitle(mainTitle(b)) || nb == normalizeTitle(mainTitle(a))
+	return similarity(na, nb), subtitled
+}
+
+// titleMatcher scores search results against items.
+type titleMatcher struct {
+	// minConfidence is the lowest score a result is taken as the item at.
+	minConfidence float64
+	// yearTolerance is how many years a result's year can be off by, as
+	// happens between premiere and release dates.
+	yearTolerance int
+}
+
+// score scores a candidate title and year against an item's. Each year the
+// candidate is off by costs a little, up to yearTolerance; any further off
+// rules it out. An unknown year costs nothing, but then a subtitle one title
+// lacks only counts by edit distance: without a year, "Alien" can't be told
+// from "Alien: Covenant".
+func (m titleMatcher) score(title string, year int, candidateTitle string, candidateYear int) float64 {
+	if year == 0 || candidateYear == 0 {
+		score, _ := compareTitles(title, candidateTitle)
+		return score
+	}
+	score := titleScore(title, candidateTitle)
+	diff := year - candidateYear
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > m.yearTolerance {
+		return 0
+	}
+	return score * (1 - 0.05*float64(diff))
+}
+
+// cacheMatch caches the best candidate of a search, whatever its score, so
+// a later run with a lower -min-confidence can use it, and returns it if it
+// scores at least minConfidence.
+func cacheMatch(cache *lookupCache, key, id string, score, minConfidence float64) (string, float64, error) {
+	if id == "" {
+		cache.put(key, []string{})
+	} else {
+		cache.put(key, []string{id, strconv.FormatFloat(score, 'f', -1, 64)})
+	}
+	if score < minConfidence {
+		return "", 0, nil
+	}
+	return id, score, nil
+}
+
+// cachedMatch reads what cacheMatch cached. Entries cached before scores
+// were kept were exact matches.
+func cachedMatch(values []string, minConfidence float64) (string, float64, error) {
+	if len(values) == 0 {
+		return "", 0, nil
+	}
+	score := 1.0
+	if len(values) > 1 {
+		score, _ = strconv.ParseFloat(values[1], 64)
+	}
+	if score < minConfidence {
+		return "", 0, nil
+	}
+	return values[0], score, nil
+}
+
+// similarity is 1 minus the Levenshtein distance between a and b relative
+// to the longer of them.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestTitleScore(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Amélie", "Amelie", 1},
+		{"The Matrix", "Matrix, The", 1},
+		{"Fast & Furious", "Fast and Furious", 1},
+		{"Alien", "Alien: Covenant", 0.9},
+		{"Birdman", "Birdman or (The Unexpected Virtue of Ignorance)", 0.9},
+		{"The Office (US)", "The Office", 0.9},
+	}
+	for _, test := range tests {
+		if got := titleScore(test.a, test.b); got != test.want {
+			t.Errorf("titleScore(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := titleScore(test.b, test.a); got != test.want {
+			t.Errorf("titleScore(%q, %q) = %v, want %v", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestTitleScoreMismatches(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		// Franchise entries share a main title but are different titles.
+		{"Star Trek: Picard", "Star Trek: Lower Decks"},
+		{"Star Wars: Episode IV - A New Hope", "Star Wars: Episode V - The Empire Strikes Back"},
+		{"Heat", "Heist"},
+		{"Roma", "Rome"},
+	}
+	for _, test := range tests {
+		if got := titleScore(test.a, test.b); got >= defaultMinConfidence {
+			t.Errorf("titleScore(%q, %q) = %v, want below %v", test.a, test.b, got, defaultMinConfidence)
+		}
+	}
+}
+
+func TestTitleMatcherScore(t *testing.T) {
+	m := titleMatcher{minConfidence: defaultMinConfidence, yearTolerance: 1}
+	tests := []struct {
+		year, candidateYear int
+		want                float64
+	}{
+		{2018, 2018, 1},
+		{2018, 2019, 0.95},
+		{2018, 2017, 0.95},
+		{2018, 2020, 0},
+		{0, 2020, 1},
+		{2018, 0, 1},
+	}
+	for _, test := range tests {
+		if got := m.score("Roma", test.year, "Roma", test.candidateYear); got != test.want {
+			t.Errorf("score for %d against %d = %v, want %v", test.year, test.candidateYear, got, test.want)
+		}
+	}
+}
+
+func TestTitleMatcherScoreSubtitles(t *testing.T) {
+	m := titleMatcher{minConfidence: defaultMinConfidence, yearTolerance: 1}
+	// With the years known, a subtitle one side lacks is the same title.
+	if got := m.score("Alien", 2017, "Alien: Covenant", 2017); got != 0.9 {
+		t.Errorf("Alien (2017) against Alien: Covenant (2017) = %v, want 0.9", got)
+	}
+	// Without them, it's as likely another entry in a franchise.
+	for _, years := range [][2]int{{0, 2017}, {1979, 0}, {0, 0}} {
+		if got := m.score("Alien", years[0], "Alien: Covenant", years[1]); got >= m.minConfidence {
+			t.Errorf("Alien (%d) against Alien: Covenant (%d) = %v, want below %v", years[0], years[1], got, m.minConfidence)
+		}
+	}
+}
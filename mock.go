@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type mockTitle struct {
+	title     string
+	year      int
+	netflixID string
+	countries []string
+}
+
+// mockCatalog is a small, fixed Netflix catalog for trying plex2netflix out
+// without a RapidAPI key. It is not meant to reflect the real catalog.
+var mockCatalog = []mockTitle{
+	{"Bird Box", 2018, "80196789", []string{"us", "gb", "ca", "de", "in"}},
+	{"Breaking Bad", 2008, "70143836", []string{"us", "gb", "ca", "de", "in"}},
+	{"Extraction", 2020, "80230399", []string{"us", "gb", "ca", "de", "in"}},
+	{"Inception", 2010, "70131314", []string{"gb", "ca", "in"}},
+	{"Pulp Fiction", 1994, "880640", []string{"us", "ca"}},
+	{"Roma", 2018, "80240715", []string{"us", "gb", "ca", "de", "in"}},
+	{"Stranger Things", 2016, "80057281", []string{"us", "gb", "ca", "de", "in"}},
+	{"The Irishman", 2019, "80175798", []string{"us", "gb", "ca", "de", "in"}},
+	{"The Matrix", 1999, "20557937", []string{"gb", "de"}},
+	{"The Social Network", 2010, "70132721", []string{"us", "in"}},
+	{"Okja", 2017, "80091936", []string{"us", "gb", "ca", "de", "in"}},
+	{"Taxi Driver", 1976, "60010932", []string{"us"}},
+}
+
+// mockQuality is the video quality of the mock catalog's titles that
+// aren't in HD.
+var mockQuality = map[string]string{
+	"Bird Box":        "uhd",
+	"Extraction":      "uhd",
+	"Okja":            "uhd",
+	"Roma":            "uhd",
+	"Stranger Things": "uhd",
+	"The Irishman":    "uhd",
+	"Taxi Driver":     "sd",
+}
+
+// mockLanguages are the audio and subtitle languages of the mock catalog's
+// titles that have more than English, in every country.
+var mockLanguages = map[string][2][]string{
+	"80196789": {{"en", "es", "fr", "ja"}, {"en", "es", "fr", "ja"}},
+	"80091936": {{"en", "ko"}, {"en", "ko"}},
+	"80240715": {{"es", "en"}, {"en", "es"}},
+	"80057281": {{"en", "de", "es", "fr", "ja"}, {"en", "de", "es", "fr", "ja"}},
+	"20557937": {{"en"}, {}},
+}
+
+// mockAudioDescribed are the mock catalog's titles with audio description,
+// in every country. Every title has closed captions.
+var mockAudioDescribed = map[string]bool{
+	"80196789": true,
+	"80230399": true,
+	"80057281": true,
+	"80175798": true,
+	"70143836": true,
+}
+
+// mockLeaving is how many days from now mock catalog titles leave Netflix
+// in the countries they're leaving, keyed by Netflix ID.
+var mockLeaving = map[string]map[string]int{
+	"880640":   {"us": 20},
+	"60010932": {"us": 45},
+	"70131314": {"gb": 10, "ca": 10, "in": 90},
+}
+
+// mockProvider answers lookups from mockCatalog.
+type mockProvider struct {
+	matcher titleMatcher
+}
+
+func (p mockProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	ex.setCleanTitle(item.Title)
+	var m netflixMatch
+	for _, t := range mockCatalog {
+		score := p.matcher.score(item.Title, item.Year, t.title, t.year)
+		if score < p.matcher.minConfidence {
+			continue
+		}
+		ex.addCandidate(candidate{title: t.title, year: strconv.Itoa(t.year), netflixID: t.netflixID, score: score})
+		ex.setCountries(t.countries)
+		m = netflixMatch{Found: containsAny(t.countries, countries), NetflixID: t.netflixID, Countries: t.countries, Score: score}
+		if m.Found {
+			ex.decide("the mock catalog has it in %s", strings.Join(t.countries, ","))
+			return m, nil
+		}
+	}
+	ex.decide("not available in the mock catalog for %s", strings.Join(countries, ","))
+	return m, nil
+}
+
+func (mockProvider) netflixIDCountries(id string, ex *explanation) ([]string, error) {
+	for _, t := range mockCatalog {
+		if t.netflixID == id {
+			return t.countries, nil
+		}
+	}
+	return []string{}, nil
+}
+
+func (mockProvider) netflixQuality(item mediaItem, countries []string) (string, error) {
+	for title, quality := range mockQuality {
+		if strings.EqualFold(title, item.Title) {
+			return quality, nil
+		}
+	}
+	return "hd", nil
+}
+
+func (p mockProvider) netflixLanguages(id string) (audio, subtitles map[string][]string, err error) {
+	languages, ok := mockLanguages[id]
+	if !ok {
+		languages = [2][]string{{"en"}, {"en"}}
+	}
+	countries, _ := p.netflixIDCountries(id, nil)
+	audio, subtitles = map[string][]string{}, map[string][]string{}
+	for _, country := range countries {
+		audio[country], subtitles[country] = languages[0], languages[1]
+	}
+	return audio, subtitles, nil
+}
+
+func (p mockProvider) netflixAccessibility(id string) (map[string]accessibility, error) {
+	countries, _ := p.netflixIDCountries(id, nil)
+	features := map[string]accessibility{}
+	for _, country := range countries {
+		features[country] = accessibility{AudioDescription: mockAudioDescribed[id], ClosedCaptions: true}
+	}
+	return features, nil
+}
+
+func (mockProvider) netflixExpiry(id string) (map[string]time.Time, error) {
+	today := time.Now().Truncate(24 * time.Hour)
+	expires := map[string]time.Time{}
+	for country, days := range mockLeaving[id] {
+		expires[country] = today.AddDate(0, 0, days)
+	}
+	return expires, nil
+}
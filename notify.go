@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// notifyConfig configures where notifications are sent besides the log.
+type notifyConfig struct {
+	// WebhookURL receives a JSON POST for every notification. The message is
+	// sent as both "text" and "content", so Slack and Discord incoming
+	// webhooks can be used directly.
+	WebhookURL string `json:"webhook_url"`
+}
+
+type notification struct {
+	Event   string                 `json:"event"`
+	Message string                 `json:"text"`
+	Content string                 `json:"content"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// notifier sends notifications about events that need the user's attention.
+type notifier struct {
+	logger *logrus.Logger
+	cfg    notifyConfig
+}
+
+func (n *notifier) notify(event, message string, fields map[string]interface{}) {
+	n.logger.WithFields(logrus.Fields(fields)).WithField("event", event).Warn(message)
+	if n.cfg.WebhookURL == "" {
+		return
+	}
+	if err := n.post(notification{Event: event, Message: message, Content: message, Fields: fields}); err != nil {
+		n.logger.WithField("error", err).WithField("event", event).Error("sending notification")
+	}
+}
+
+func (n *notifier) post(body notification) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "marshaling notification")
+	}
+	resp, err := httpClient.Post(n.cfg.WebhookURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "posting notification")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// overrideNone pins a title as not on Netflix.
+const overrideNone = "none"
+
+// overrides pin titles to known Netflix IDs, or to overrideNone, for titles
+// that providers get wrong. Keys are Plex GUIDs, "imdb://tt..." or
+// "tmdb://..." IDs, or "title (year)".
+type overrides map[string]string
+
+func loadOverrides(path string) (overrides, error) {
+	o := overrides{}
+	if path == "" {
+		return o, nil
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(bytes, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", path)
+	}
+	for key, id := range raw {
+		o[strings.ToLower(strings.TrimSpace(key))] = strings.ToLower(strings.TrimSpace(id))
+	}
+	return o, nil
+}
+
+// find returns the Netflix ID, or overrideNone, pinned for an item.
+func (o overrides) find(item mediaItem) (string, bool) {
+	for _, key := range item.pinKeys() {
+		if id, ok := o[key]; ok && id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// pinKeys are the lowercase keys an item can be listed under in the
+// overrides file and keep list, most specific first.
+func (m mediaItem) pinKeys() []string {
+	var keys []string
+	if m.GUID != "" {
+		keys = append(keys, strings.ToLower(m.GUID))
+	}
+	if m.IMDbID != "" {
+		keys = append(keys, "imdb://"+strings.ToLower(m.IMDbID))
+	}
+	if m.TMDBID != "" {
+		keys = append(keys, "tmdb://"+m.TMDBID)
+	}
+	return append(keys, strings.ToLower(fmt.Sprintf("%s (%d)", m.Title, m.Year)))
+}
+
+// netflixIDProvider is implemented by providers that can tell where a known
+// Netflix ID is available.
+type netflixIDProvider interface {
+	netflixIDCountries(netflixID string, ex *explanation) ([]string, error)
+}
+
+// overrideMatch answers a lookup from an override. When the provider can't
+// say where the pinned ID is available, it's taken to be available in every
+// country asked about.
+func overrideMatch(p provider, id string, countries []string, ex *explanation) (netflixMatch, error) {
+	if id == overrideNone {
+		ex.decide("pinned as not on netflix by the overrides file")
+		return netflixMatch{Score: 1}, nil
+	}
+	available := countries
+	if ip, ok := p.(netflixIDProvider); ok {
+		var err error
+		if available, err = ip.netflixIDCountries(id, ex); err != nil {
+			return netflixMatch{}, errors.Wrapf(err, "getting countries of pinned netflix ID %s", id)
+		}
+	}
+	ex.setCountries(available)
+	m := netflixMatch{Found: containsAny(available, countries), NetflixID: id, Countries: available, Score: 1}
+	ex.decide("pinned to netflix ID %s by the overrides file", id)
+	return m, nil
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/pkg/errors"
+)
+
+// plexMetadata is the subset of Plex's item metadata plex2netflix uses. The
+// go-plex-client types don't cover all of it, so library contents are
+// fetched directly.
+type plexMetadata struct {
+	RatingKey    string `json:"ratingKey"`
+	GUID         string `json:"guid"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	Year         int    `json:"year"`
+	EditionTitle string `json:"editionTitle"`
+	Thumb        string `json:"thumb"`
+	AddedAt      int64  `json:"addedAt"`
+	ViewCount    int    `json:"viewCount"`
+	LastViewedAt int64  `json:"lastViewedAt"`
+	// Index and ParentRatingKey are a season's number and its show.
+	Index           int    `json:"index"`
+	ParentRatingKey string `json:"parentRatingKey"`
+	// GrandparentRatingKey is an episode's show.
+	GrandparentRatingKey string `json:"grandparentRatingKey"`
+
+	Rating              float64 `json:"rating"`
+	RatingImage         string  `json:"ratingImage"`
+	AudienceRating      float64 `json:"audienceRating"`
+	AudienceRatingImage string  `json:"audienceRatingImage"`
+
+	// Guid lists the agent IDs, like "imdb://tt0133093", of items matched
+	// by Plex's newer agents.
+	Guid       []plexGUID  `json:"Guid"`
+	Genre      []plexTag   `json:"Genre"`
+	Label      []plexTag   `json:"Label"`
+	Collection []plexTag   `json:"Collection"`
+	Media      []plexMedia `json:"Media"`
+}
+
+// mediaType returns "movie" or "show" for the item. Mixed libraries and
+// "Other Videos" libraries can also hold clips, episodes and other types that
+// can't be looked up on their own, and those return "".
+func (m plexMetadata) mediaType() string {
+	switch m.Type {
+	case "movie":
+		return "movie"
+	case "show":
+		return "show"
+	default:
+		return ""
+	}
+}
+
+// unmatched reports whether Plex has no agent match for the item, as in
+// "Other Videos" libraries, so its title is probably just the file name.
+func (m plexMetadata) unmatched() bool {
+	return m.GUID == "" || strings.HasPrefix(m.GUID, "local://") || strings.HasPrefix(m.GUID, "com.plexapp.agents.none://")
+}
+
+// hasLabel reports whether the item has the label, ignoring case as Plex
+// does.
+func (m plexMetadata) hasLabel(label string) bool {
+	for _, tag := range m.Label {
+		if strings.EqualFold(tag.Tag, label) {
+			return true
+		}
+	}
+	return false
+}
+
+type plexGUID struct {
+	ID string `json:"id"`
+}
+
+// externalIDs returns the item's IMDb, TMDB and TVDB IDs from the Guid list
+// of the newer Plex agents, or from the GUID of the legacy ones, e.g.
+// "com.plexapp.agents.imdb://tt0133093?lang=en".
+func (m plexMetadata) externalIDs() (imdb, tmdb, tvdb string) {
+	guids := []string{m.GUID}
+	for _, g := range m.Guid {
+		guids = append(guids, g.ID)
+	}
+	for _, guid := range guids {
+		parts := strings.SplitN(strings.TrimPrefix(guid, "com.plexapp.agents."), "://", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		id := parts[1]
+		if i := strings.IndexAny(id, "?/"); i >= 0 {
+			id = id[:i]
+		}
+		switch parts[0] {
+		case "imdb":
+			imdb = id
+		case "tmdb", "themoviedb":
+			tmdb = id
+		case "tvdb", "thetvdb":
+			tvdb = id
+		}
+	}
+	return imdb, tmdb, tvdb
+}
+
+type plexTag struct {
+	Tag string `json:"tag"`
+}
+
+func tags(t []plexTag) []string {
+	values := make([]string, 0, len(t))
+	for _, tag := range t {
+		values = append(values, tag.Tag)
+	}
+	return values
+}
+
+type plexMedia struct {
+	VideoResolution string     `json:"videoResolution"`
+	AudioChannels   int        `json:"audioChannels"`
+	Bitrate         int        `json:"bitrate"` // kbps
+	Part            []plexPart `json:"Part"`
+}
+
+type plexPart struct {
+	File   string       `json:"file"`
+	Size   int64        `json:"size"`
+	Stream []plexStream `json:"Stream"`
+}
+
+// plexStream is a track of a media part. Plex only lists them when an item's
+// own metadata is asked for, not in library listings.
+type plexStream struct {
+	StreamType  int    `json:"streamType"` // 1 for video
+	ColorTrc    string `json:"colorTrc"`
+	DOVIPresent bool   `json:"DOVIPresent"`
+}
+
+type plexLibraryContent struct {
+	MediaContainer struct {
+		TotalSize int            `json:"totalSize"`
+		Metadata  []plexMetadata `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+// Plex returns everything it knows about every item in a library listing
+// unless told otherwise, which adds up on big libraries and slow links. These
+// cover what plexMetadata doesn't use.
+var (
+	plexExcludeElements = []string{
+		"Country", "Director", "Field", "Image",
+		"Location", "Mood", "Producer", "Role", "Similar", "Tag", "UltraBlurColors", "Writer",
+	}
+	plexExcludeFields = []string{
+		"art", "chapterSource", "contentRating", "duration", "originalTitle",
+		"originallyAvailableAt", "primaryExtraKey", "studio", "summary", "tagline",
+		"titleSort", "updatedAt",
+	}
+)
+
+// plexPageSize is how many items are fetched per request, which bounds the
+// size of each response.
+const plexPageSize = 500
+
+// file returns the path of the item's first media file, if Plex reported one.
+func (m plexMetadata) file() string {
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			return part.File
+		}
+	}
+	return ""
+}
+
+// resolution returns the best video resolution among the item's media, as
+// Plex names them: "sd", "480", "576", "720", "1080" or "4k".
+func (m plexMetadata) resolution() string {
+	best, bestRank := "", -1
+	for _, media := range m.Media {
+		if rank := resolutionRank(media.VideoResolution); rank > bestRank {
+			best, bestRank = media.VideoResolution, rank
+		}
+	}
+	return best
+}
+
+// bitrate returns the bitrate in kbps of the item's best resolution media.
+func (m plexMetadata) bitrate() int {
+	bitrate, bestRank := 0, -1
+	for _, media := range m.Media {
+		if rank := resolutionRank(media.VideoResolution); rank > bestRank || (rank == bestRank && media.Bitrate > bitrate) {
+			bitrate, bestRank = media.Bitrate, rank
+		}
+	}
+	return bitrate
+}
+
+// hdrPattern recognises HDR and Dolby Vision releases by file name, for when
+// Plex hasn't listed the video streams.
+var hdrPattern = regexp.MustCompile(`(?i)\b(hdr(10)?(\+|plus)?|dv|dovi|dolby[ ._-]?vision)\b`)
+
+// hdr reports whether any of the item's media is HDR or Dolby Vision, from
+// its video streams' color transfer or else its file names.
+func (m plexMetadata) hdr() bool {
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			for _, stream := range part.Stream {
+				if stream.StreamType != 1 {
+					continue
+				}
+				switch {
+				case stream.DOVIPresent, stream.ColorTrc == "smpte2084", stream.ColorTrc == "arib-std-b67":
+					return true
+				}
+			}
+			if hdrPattern.MatchString(filepath.Base(part.File)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// audio returns the best audio format among the item's media.
+func (m plexMetadata) audio() string {
+	channels := 0
+	for _, media := range m.Media {
+		if media.AudioChannels > channels {
+			channels = media.AudioChannels
+		}
+	}
+	switch {
+	case channels == 0:
+		return ""
+	case channels <= 2:
+		return "stereo"
+	case channels <= 6:
+		return "5.1"
+	default:
+		return "7.1"
+	}
+}
+
+func resolutionRank(resolution string) int {
+	switch strings.ToLower(resolution) {
+	case "sd":
+		return 0
+	case "480":
+		return 1
+	case "576":
+		return 2
+	case "720":
+		return 3
+	case "1080":
+		return 4
+	case "2k":
+		return 5
+	case "4k":
+		return 6
+	default:
+		return -1
+	}
+}
+
+func (m plexMetadata) files() []string {
+	var files []string
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			files = append(files, part.File)
+		}
+	}
+	return files
+}
+
+// size returns the total size of the item's media files.
+func (m plexMetadata) size() int64 {
+	var size int64
+	for _, media := range m.Media {
+		for _, part := range media.Part {
+			size += part.Size
+		}
+	}
+	return size
+}
+
+func getPlexLibrary(conn *plex.Plex, sectionKey string) ([]plexMetadata, error) {
+	return getPlexItems(conn, sectionKey, url.Values{})
+}
+
+// plexSeasonType is Plex's metadata type number for seasons.
+const plexSeasonType = "3"
+
+// getPlexSeasons returns the season numbers of every show in a section,
+// keyed by the show's rating key, in one listing rather than a request per
+// show. Specials (season 0) aren't included.
+func getPlexSeasons(conn *plex.Plex, sectionKey string) (map[string][]int, error) {
+	params := url.Values{}
+	params.Set("type", plexSeasonType)
+	seasons, err := getPlexItems(conn, sectionKey, params)
+	if err != nil {
+		return nil, err
+	}
+	byShow := map[string][]int{}
+	for _, season := range seasons {
+		if season.Index > 0 {
+			byShow[season.ParentRatingKey] = append(byShow[season.ParentRatingKey], season.Index)
+		}
+	}
+	for _, numbers := range byShow {
+		sort.Ints(numbers)
+	}
+	return byShow, nil
+}
+
+// plexEpisodeType is Plex's metadata type number for episodes.
+const plexEpisodeType = "4"
+
+// getPlexShowSizes returns the total size of every show's episodes in a
+// section, keyed by the show's rating key, since Plex only reports sizes on
+// episodes.
+func getPlexShowSizes(conn *plex.Plex, sectionKey string) (map[string]int64, error) {
+	params := url.Values{}
+	params.Set("type", plexEpisodeType)
+	episodes, err := getPlexItems(conn, sectionKey, params)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, episode := range episodes {
+		sizes[episode.GrandparentRatingKey] += episode.size()
+	}
+	return sizes, nil
+}
+
+func getPlexItems(conn *plex.Plex, sectionKey string, params url.Values) ([]plexMetadata, error) {
+	params.Set("includeGuids", "1")
+	params.Set("excludeElements", strings.Join(plexExcludeElements, ","))
+	params.Set("excludeFields", strings.Join(plexExcludeFields, ","))
+	params.Set("X-Plex-Container-Size", strconv.Itoa(plexPageSize))
+
+	var metadata []plexMetadata
+	for {
+		params.Set("X-Plex-Container-Start", strconv.Itoa(len(metadata)))
+		var content plexLibraryContent
+		if err := plexGet(conn, "/library/sections/"+sectionKey+"/all?"+params.Encode(), &content); err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, content.MediaContainer.Metadata...)
+		if len(content.MediaContainer.Metadata) == 0 || len(metadata) >= content.MediaContainer.TotalSize {
+			return metadata, nil
+		}
+	}
+}
+
+// plexTransport sends requests for the Plex server with its own TLS
+// settings, and everything else with next.
+type plexTransport struct {
+	plex http.RoundTripper
+	next http.RoundTripper
+}
+
+// plexHosts are the hosts the Plex server is reached at: the configured
+// host, and the addresses discovery finds for it, such as its plex.direct
+// and relay hosts.
+var plexHosts = struct {
+	sync.RWMutex
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+// addPlexHost adds the host of a URL the Plex server is reached at to
+// plexHosts.
+func addPlexHost(rawurl string) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return
+	}
+	plexHosts.Lock()
+	defer plexHosts.Unlock()
+	plexHosts.hosts[strings.ToLower(u.Hostname())] = true
+}
+
+func isPlexHost(host string) bool {
+	plexHosts.RLock()
+	defer plexHosts.RUnlock()
+	return plexHosts.hosts[strings.ToLower(host)]
+}
+
+// newPlexTransport returns next unchanged unless cfg has TLS settings.
+func newPlexTransport(cfg plexConfig, next http.RoundTripper) (http.RoundTripper, error) {
+	if cfg.CACert == "" && !cfg.InsecureSkipVerify {
+		return next, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", cfg.CACert)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	addPlexHost(cfg.url())
+	return plexTransport{
+		plex: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		next: next,
+	}, nil
+}
+
+func (t plexTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isPlexHost(req.URL.Hostname()) {
+		return t.plex.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+func plexGet(conn *plex.Plex, path string, v interface{}) error {
+	return plexDo(conn, "GET", path, v)
+}
+
+// plexDo sends a request to the Plex server and decodes the response into
+// v, unless v is nil.
+func plexDo(conn *plex.Plex, method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(conn.URL, "/")+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Token", conn.Token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling Plex")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Plex returned %s for %s", resp.Status, path)
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding Plex response")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// plexTagged is what tagging needs to know about a scanned Plex item.
+type plexTagged struct {
+	sectionKey  string
+	typ         string
+	labels      []string
+	collections []string
+}
+
+// plexTypes are Plex's metadata type numbers.
+var plexTypes = map[string]int{"movie": 1, "show": 2}
+
+// tagPlexResults puts every found item into the collection and gives it the
+// label, whichever are set, and takes them off items that were tagged by an
+// earlier run but aren't on Netflix any more. Items that couldn't be checked
+// are left alone. Only successful edits are counted as added or removed;
+// the rest are logged and counted as failed.
+func tagPlexResults(logger *logrus.Logger, conn *plex.Plex, cfg plexConfig, items map[string]plexTagged, results []checkResult) {
+	added, removed, failed := 0, 0, 0
+	for _, result := range results {
+		item, ok := items[result.Item.RatingKey]
+		if !ok || result.Error != "" {
+			continue
+		}
+		kinds := []struct {
+			tag, name string
+			existing  []string
+		}{
+			{"collection", cfg.Collection, item.collections},
+			{"label", cfg.Label, item.labels},
+		}
+		for _, t := range kinds {
+			if t.name == "" {
+				continue
+			}
+			has := containsFold(t.existing, t.name)
+			var err error
+			switch {
+			case result.Found && !has:
+				if err = editPlexTags(conn, result.Item.RatingKey, item, t.tag, append(t.existing, t.name), ""); err == nil {
+					added++
+				}
+			case !result.Found && has:
+				if err = editPlexTags(conn, result.Item.RatingKey, item, t.tag, nil, t.name); err == nil {
+					removed++
+				}
+			}
+			if err != nil {
+				failed++
+				logger.WithField("error", err).WithField("title", result.Item.Title).WithField(t.tag, t.name).Warn("tagging plex item")
+			}
+		}
+	}
+	entry := logger.WithField("added", added).WithField("removed", removed)
+	if failed > 0 {
+		entry.WithField("failed", failed).Warn("tagged plex items, some edits failed")
+		return
+	}
+	entry.Info("tagged plex items")
+}
+
+// editPlexTags sets an item's collections or labels to tags, or removes
+// remove from them. Plex replaces the whole list when it's set, so tags has
+// to include the ones the item already has.
+func editPlexTags(conn *plex.Plex, ratingKey string, item plexTagged, tag string, tags []string, remove string) error {
+	params := url.Values{}
+	params.Set("type", strconv.Itoa(plexTypes[item.typ]))
+	params.Set("id", ratingKey)
+	params.Set(tag+".locked", "1")
+	for i, t := range tags {
+		params.Set(tag+"["+strconv.Itoa(i)+"].tag.tag", t)
+	}
+	if remove != "" {
+		params.Set(tag+"[].tag.tag-", remove)
+	}
+	return plexDo(conn, "PUT", "/library/sections/"+item.sectionKey+"/all?"+params.Encode(), nil)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// plexPlaylistBatch is how many items are added to a playlist per request,
+// which keeps the request URL short.
+const plexPlaylistBatch = 100
+
+// syncPlexPlaylist makes the video playlist called title hold exactly the
+// items found on Netflix, creating it if it doesn't exist. Shows are added
+// with all their episodes, as Plex does.
+func syncPlexPlaylist(conn *plex.Plex, title string, results []checkResult) (int, error) {
+	var keys []string
+	seen := map[string]bool{}
+	for _, result := range results {
+		key := result.Item.RatingKey
+		if result.Found && key != "" && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	var root struct {
+		MediaContainer struct {
+			MachineIdentifier string `json:"machineIdentifier"`
+		} `json:"MediaContainer"`
+	}
+	if err := plexGet(conn, "/", &root); err != nil {
+		return 0, errors.Wrap(err, "getting server identifier")
+	}
+	uri := func(keys []string) string {
+		return "server://" + root.MediaContainer.MachineIdentifier + "/com.plexapp.plugins.library/library/metadata/" + strings.Join(keys, ",")
+	}
+
+	var playlists struct {
+		MediaContainer struct {
+			Metadata []struct {
+				RatingKey string `json:"ratingKey"`
+				Title     string `json:"title"`
+				Smart     bool   `json:"smart"`
+			} `json:"Metadata"`
+		} `json:"MediaContainer"`
+	}
+	if err := plexGet(conn, "/playlists?playlistType=video", &playlists); err != nil {
+		return 0, errors.Wrap(err, "listing playlists")
+	}
+	id := ""
+	for _, p := range playlists.MediaContainer.Metadata {
+		if p.Title == title && !p.Smart {
+			id = p.RatingKey
+			break
+		}
+	}
+	if id != "" {
+		if err := plexDo(conn, "DELETE", "/playlists/"+id+"/items", nil); err != nil {
+			return 0, errors.Wrap(err, "clearing playlist")
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	for start := 0; start < len(keys); start += plexPlaylistBatch {
+		end := start + plexPlaylistBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		params := url.Values{}
+		params.Set("uri", uri(keys[start:end]))
+		if id != "" {
+			if err := plexDo(conn, "PUT", "/playlists/"+id+"/items?"+params.Encode(), nil); err != nil {
+				return 0, errors.Wrap(err, "adding to playlist")
+			}
+			continue
+		}
+		params.Set("type", "video")
+		params.Set("title", title)
+		params.Set("smart", "0")
+		var created struct {
+			MediaContainer struct {
+				Metadata []struct {
+					RatingKey string `json:"ratingKey"`
+				} `json:"Metadata"`
+			} `json:"MediaContainer"`
+		}
+		if err := plexDo(conn, "POST", "/playlists?"+params.Encode(), &created); err != nil {
+			return 0, errors.Wrap(err, "creating playlist")
+		}
+		if len(created.MediaContainer.Metadata) == 0 {
+			return 0, errors.New("Plex didn't return the new playlist")
+		}
+		id = created.MediaContainer.Metadata[0].RatingKey
+	}
+	return len(keys), nil
+}
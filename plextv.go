@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const plexResourcesURL = "https://plex.tv/api/v2/resources?includeHttps=1&includeRelay=1"
+
+// plexClientID identifies plex2netflix to plex.tv.
+const plexClientID = "plex2netflix"
+
+// plexTVGet calls a plex.tv API on behalf of the account that owns token.
+func plexTVGet(token, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("X-Plex-Token", token)
+	}
+	req.Header.Set("X-Plex-Client-Identifier", plexClientID)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling plex.tv")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("plex.tv returned %s", resp.Status)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding plex.tv response")
+}
+
+// plexResource is a server, player or other device on a plex.tv account.
+type plexResource struct {
+	Name        string `json:"name"`
+	Provides    string `json:"provides"`
+	AccessToken string `json:"accessToken"`
+	Connections []struct {
+		URI   string `json:"uri"`
+		Local bool   `json:"local"`
+		Relay bool   `json:"relay"`
+	} `json:"connections"`
+}
+
+// plexDiscoverTimeout bounds how long each of a server's addresses is tried,
+// since LAN addresses don't answer when running away from home.
+const plexDiscoverTimeout = 5 * time.Second
+
+// discoverPlexServer finds the named server on the plex.tv account that owns
+// token, or its only server when name is empty, and returns the first of its
+// addresses that answers, with the token to use for it.
+func discoverPlexServer(token, name string) (url, serverToken string, err error) {
+	var resources []plexResource
+	if err := plexTVGet(token, plexResourcesURL, &resources); err != nil {
+		return "", "", errors.Wrap(err, "listing plex.tv servers")
+	}
+
+	var servers []plexResource
+	var names []string
+	for _, r := range resources {
+		if !strings.Contains(r.Provides, "server") {
+			continue
+		}
+		names = append(names, r.Name)
+		if name == "" || strings.EqualFold(r.Name, name) {
+			servers = append(servers, r)
+		}
+	}
+	switch {
+	case len(names) == 0:
+		return "", "", errors.New("the plex.tv account has no servers")
+	case len(servers) == 0:
+		return "", "", errors.Errorf("no server named %q, the account has %s", name, strings.Join(names, ", "))
+	case len(servers) > 1:
+		return "", "", errors.Errorf("the account has several servers, pick one with -plex-server: %s", strings.Join(names, ", "))
+	}
+	server := servers[0]
+
+	// Direct connections beat relayed ones, which are slow and capped, and
+	// local ones are tried first as they're the fastest when they work.
+	connections := server.Connections
+	sort.SliceStable(connections, func(i, j int) bool {
+		if connections[i].Relay != connections[j].Relay {
+			return !connections[i].Relay
+		}
+		return connections[i].Local && !connections[j].Local
+	})
+	for _, c := range connections {
+		// The Plex TLS settings apply to whichever address is used.
+		addPlexHost(c.URI)
+		if plexReachable(c.URI, server.AccessToken) {
+			return c.URI, server.AccessToken, nil
+		}
+	}
+	return "", "", errors.Errorf("none of %s's addresses answered", server.Name)
+}
+
+func plexReachable(url, token string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), plexDiscoverTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", strings.TrimSuffix(url, "/")+"/identity", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("X-Plex-Token", token)
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+const (
+	plexPinsURL = "https://plex.tv/api/v2/pins"
+	plexAuthURL = "https://app.plex.tv/auth#"
+	// plexPinTimeout is how long a plex.tv PIN stays valid.
+	plexPinTimeout = 15 * time.Minute
+)
+
+type plexPin struct {
+	ID        int    `json:"id"`
+	Code      string `json:"code"`
+	AuthToken string `json:"authToken"`
+}
+
+// plexLogin gets a Plex token with plex.tv's PIN flow, where the user signs
+// in on plex.tv in a browser, and saves it to tokenFile.
+func plexLogin(logger *logrus.Logger, tokenFile string) error {
+	req, err := http.NewRequest("POST", plexPinsURL+"?strong=true", nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Product", "plex2netflix")
+	req.Header.Set("X-Plex-Client-Identifier", plexClientID)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling plex.tv")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return errors.Errorf("plex.tv returned %s", resp.Status)
+	}
+	var pin plexPin
+	if err := json.NewDecoder(resp.Body).Decode(&pin); err != nil {
+		return errors.Wrap(err, "decoding plex.tv PIN")
+	}
+
+	params := url.Values{}
+	params.Set("clientID", plexClientID)
+	params.Set("code", pin.Code)
+	params.Set("context[device][product]", "plex2netflix")
+	logger.WithField("url", plexAuthURL+"?"+params.Encode()).Info("sign in to plex.tv to authorize plex2netflix")
+
+	deadline := time.Now().Add(plexPinTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		var status plexPin
+		if err := plexTVGet("", fmt.Sprintf("%s/%d?code=%s", plexPinsURL, pin.ID, url.QueryEscape(pin.Code)), &status); err != nil {
+			return errors.Wrap(err, "polling for Plex token")
+		}
+		if status.AuthToken != "" {
+			return errors.Wrapf(ioutil.WriteFile(tokenFile, []byte(status.AuthToken), 0600), "writing %s", tokenFile)
+		}
+	}
+	return errors.New("timed out waiting for plex.tv sign-in")
+}
+
+// readPlexToken returns the token saved by plexLogin, or "" if there's none.
+func readPlexToken(tokenFile string) (string, error) {
+	bytes, err := ioutil.ReadFile(tokenFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", tokenFile)
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Action names, as used in policies.
+const (
+	actionRadarrExclude   = "radarr-exclude"
+	actionWatchlistRemove = "watchlist-remove"
+)
+
+// policy restricts the actions taken on items in certain genres, e.g.
+// "documentaries: report only" or "kids: require a Disney+ match".
+type policy struct {
+	// Genres the policy applies to, matched case-insensitively against the
+	// item's genres.
+	Genres []string `json:"genres"`
+	// ReportOnly turns off every action for matching items.
+	ReportOnly bool `json:"report_only"`
+	// Actions, when set, lists the only actions allowed on matching items.
+	Actions []string `json:"actions"`
+	// RequireServices lists streaming services that must all have the title
+	// before any action is taken. Services other than Netflix have to be
+	// checked with -services, or the policy blocks actions on its items.
+	RequireServices []string `json:"require_services"`
+}
+
+func (p policy) matches(item mediaItem) bool {
+	for _, genre := range item.Genres {
+		for _, g := range p.Genres {
+			if strings.EqualFold(genre, g) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether the policy lets action be taken on a found item,
+// and if not, why.
+func (p policy) allows(action string, result checkResult) (bool, string) {
+	if p.ReportOnly {
+		return false, "report only"
+	}
+	if p.Actions != nil && !containsAny(p.Actions, []string{action}) {
+		return false, "action not allowed"
+	}
+	for _, service := range p.RequireServices {
+		name := serviceName(service)
+		if result.Services == nil && name == "netflix" {
+			// Only Netflix was checked, and the item was found there.
+			continue
+		}
+		if name == "" || !containsAny(result.Services, []string{name}) {
+			return false, "requires a match on " + service
+		}
+	}
+	return true, ""
+}
+
+// checkRequireQuality returns an error when require_quality is set but the
+// provider can't tell what quality Netflix streams in, as every action would
+// then be skipped.
+func checkRequireQuality(cfg *config, p provider) error {
+	if _, ok := p.(qualityProvider); cfg.RequireQuality != "" && !ok {
+		return errors.New("require_quality needs a provider that knows Netflix's video quality, use streaming-availability")
+	}
+	return nil
+}
+
+// allowedResults returns the found results that the configured policies let
+// action be applied to.
+func allowedResults(logger *logrus.Logger, cfg *config, action string, results []checkResult) []checkResult {
+	var allowed []checkResult
+	for _, result := range results {
+		if !result.Found {
+			continue
+		}
+		if cfg.leavingWithin > 0 && !result.Leaving.IsZero() && time.Until(result.Leaving) < cfg.leavingWithin {
+			logger.WithField("title", result.Item.Title).
+				WithField("action", action).
+				WithField("leaving", cfg.dates.date(result.Leaving)).
+				Info("skipping action because the title is leaving netflix soon")
+			continue
+		}
+		if cfg.RequireQuality != "" && qualityRank(result.NetflixQuality) < qualityRank(cfg.RequireQuality) {
+			quality := result.NetflixQuality
+			if quality == "" {
+				quality = "unknown"
+			}
+			logger.WithField("title", result.Item.Title).
+				WithField("action", action).
+				WithField("netflix_quality", quality).
+				Info("skipping action because netflix's video quality is below require_quality")
+			continue
+		}
+		ok := true
+		for _, p := range cfg.Policies {
+			if !p.matches(result.Item) {
+				continue
+			}
+			var reason string
+			if ok, reason = p.allows(action, result); !ok {
+				logger.WithField("title", result.Item.Title).
+					WithField("action", action).
+					WithField("genres", strings.Join(p.Genres, ",")).
+					WithField("reason", reason).
+					Info("skipping action because of a genre policy")
+				break
+			}
+		}
+		if ok {
+			allowed = append(allowed, result)
+		}
+	}
+	return allowed
+}
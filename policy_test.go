@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAllowedResults(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	cfg := &config{Policies: []policy{
+		{Genres: []string{"documentary"}, ReportOnly: true},
+		{Genres: []string{"Kids"}, RequireServices: []string{"Disney"}},
+		{Genres: []string{"Drama"}, Actions: []string{actionQuarantine}},
+	}}
+	results := []checkResult{
+		{Item: mediaItem{Title: "Icarus", Genres: []string{"Documentary"}}, Found: true},
+		{Item: mediaItem{Title: "Moana", Genres: []string{"Kids"}}, Found: true, Services: []string{"netflix", "disney+"}},
+		{Item: mediaItem{Title: "Klaus", Genres: []string{"Kids"}}, Found: true, Services: []string{"netflix"}},
+		{Item: mediaItem{Title: "Roma", Genres: []string{"Drama"}}, Found: true},
+		{Item: mediaItem{Title: "Heat", Genres: []string{"Action"}}, Found: true},
+		{Item: mediaItem{Title: "Taxi Driver", Genres: []string{"Action"}}},
+	}
+	tests := []struct {
+		action string
+		want   []string
+	}{
+		{actionDelete, []string{"Moana", "Heat"}},
+		{actionQuarantine, []string{"Moana", "Roma", "Heat"}},
+	}
+	for _, test := range tests {
+		var titles []string
+		for _, result := range allowedResults(logger, cfg, test.action, results) {
+			titles = append(titles, result.Item.Title)
+		}
+		if !reflect.DeepEqual(titles, test.want) {
+			t.Errorf("%s allowed on %q, want %q", test.action, titles, test.want)
+		}
+	}
+}
+
+func TestPolicyRequireNetflix(t *testing.T) {
+	p := policy{Genres: []string{"Kids"}, RequireServices: []string{"netflix"}}
+	// Without -services, only Netflix is checked, and results don't list
+	// services.
+	if ok, reason := p.allows(actionDelete, checkResult{Found: true}); !ok {
+		t.Errorf("requiring netflix blocked a netflix-only match: %s", reason)
+	}
+	if ok, _ := p.allows(actionDelete, checkResult{Found: true, Services: []string{"disney+"}}); ok {
+		t.Error("requiring netflix allowed a match only on disney+")
+	}
+}
+
+func TestCheckRequireQuality(t *testing.T) {
+	cfg := &config{RequireQuality: "uhd"}
+	if err := checkRequireQuality(cfg, &unogsProvider{}); err == nil {
+		t.Error("require_quality allowed with a provider that doesn't know quality")
+	}
+	if err := checkRequireQuality(cfg, &streamingAvailabilityProvider{}); err != nil {
+		t.Errorf("require_quality refused with streaming-availability: %v", err)
+	}
+	if err := checkRequireQuality(&config{}, &unogsProvider{}); err != nil {
+		t.Errorf("refused without require_quality: %v", err)
+	}
+}
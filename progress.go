@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// progressBar draws a one-line progress bar with the rate and ETA, overall
+// and for the section being checked, at the bottom of the terminal. Log lines
+// written to the terminal in the meantime go above it.
+type progressBar struct {
+	mu       sync.Mutex
+	term     io.Writer
+	logger   *logrus.Logger
+	logOut   io.Writer
+	start    time.Time
+	total    int
+	done     int
+	sections map[string]*[2]int
+	section  string
+	drawn    time.Time
+}
+
+// newProgressBar returns a progress bar for checking items, or nil when
+// stdout isn't a terminal or info logs are off. While it's shown, logs that
+// go to stdout are written above it.
+func newProgressBar(logger *logrus.Logger, items []mediaItem) *progressBar {
+	if !logger.IsLevelEnabled(logrus.InfoLevel) {
+		return nil
+	}
+	if stat, err := os.Stdout.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	p := &progressBar{term: os.Stdout, logger: logger, start: time.Now(), total: len(items), sections: map[string]*[2]int{}}
+	for _, item := range items {
+		if p.sections[item.Section] == nil {
+			p.sections[item.Section] = &[2]int{}
+		}
+		p.sections[item.Section][1]++
+	}
+	if logger.Out == os.Stdout {
+		p.logOut = logger.Out
+		logger.Out = p
+	}
+	return p
+}
+
+// Write writes a log line above the bar.
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.term, "\r\033[K")
+	n, err := p.logOut.Write(b)
+	p.draw()
+	return n, err
+}
+
+// advance counts an item of section as checked.
+func (p *progressBar) advance(section string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if s := p.sections[section]; s != nil {
+		s[0]++
+	}
+	p.section = section
+	if time.Since(p.drawn) >= 100*time.Millisecond || p.done == p.total {
+		p.draw()
+	}
+}
+
+// finish removes the bar and gives the logger its output back.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.term, "\r\033[K")
+	if p.logOut != nil {
+		p.logger.Out = p.logOut
+	}
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	const width = 30
+	filled := 0
+	if p.total > 0 {
+		filled = width * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	line := fmt.Sprintf("[%s] %d/%d", bar, p.done, p.total)
+	if s := p.sections[p.section]; s != nil && len(p.sections) > 1 {
+		line += fmt.Sprintf("  %s %d/%d", p.section, s[0], s[1])
+	}
+	elapsed := time.Since(p.start)
+	if p.done > 0 && elapsed > 0 {
+		rate := float64(p.done) / elapsed.Seconds()
+		eta := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		line += fmt.Sprintf("  %.1f items/s  ETA %s", rate, eta.Round(time.Second))
+	}
+	fmt.Fprint(p.term, "\r\033[K"+line)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// provider answers whether a title is streamable on Netflix in any of the
+// given countries. When ex isn't nil, the provider records its reasoning in
+// it.
+type provider interface {
+	findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error)
+}
+
+// netflixMatch is a provider's answer for one item.
+type netflixMatch struct {
+	// Found is set when the title is available in one of the countries
+	// asked about.
+	Found bool
+	// NetflixID is set when the provider matched the title to a Netflix
+	// title, whether or not it's available in those countries.
+	NetflixID string
+	// Countries are every country the title is available in, when known.
+	Countries []string
+	// Score is how sure the provider is that it matched the right title, from
+	// 0 to 1. Matches by ID score 1.
+	Score float64
+}
+
+// requestCounter is implemented by providers that count the API requests
+// they make, which is what their quota is spent on.
+type requestCounter interface {
+	requests() int
+}
+
+// seasonProvider is implemented by providers that can tell which seasons of
+// a matched show Netflix has.
+type seasonProvider interface {
+	netflixSeasons(netflixID string, countries []string) ([]int, error)
+}
+
+// qualityProvider is implemented by providers that know the best video
+// quality Netflix streams a title in: "sd", "hd" or "uhd", or "" when
+// unknown.
+type qualityProvider interface {
+	netflixQuality(item mediaItem, countries []string) (string, error)
+}
+
+// expiryProvider is implemented by providers that know when Netflix stops
+// streaming a title. It returns the last day by country, for the countries
+// the title is leaving.
+type expiryProvider interface {
+	netflixExpiry(netflixID string) (map[string]time.Time, error)
+}
+
+// languageProvider is implemented by providers that know the audio and
+// subtitle languages Netflix offers a title in. Both are keyed by country and
+// hold ISO 639-1 codes.
+type languageProvider interface {
+	netflixLanguages(netflixID string) (audio, subtitles map[string][]string, err error)
+}
+
+// accessibilityProvider is implemented by providers that know whether
+// Netflix offers a title with audio description and closed captions, keyed
+// by country.
+type accessibilityProvider interface {
+	netflixAccessibility(netflixID string) (map[string]accessibility, error)
+}
+
+type accessibility struct {
+	AudioDescription bool
+	ClosedCaptions   bool
+}
+
+// qualityRank orders Netflix video qualities from worst to best.
+func qualityRank(quality string) int {
+	switch quality {
+	case "sd":
+		return 1
+	case "hd":
+		return 2
+	case "uhd":
+		return 3
+	default:
+		return 0
+	}
+}
+
+// parseQuality reads a video quality as given in require_quality, where 4k
+// is taken for uhd.
+func parseQuality(s string) (string, error) {
+	switch q := strings.ToLower(s); q {
+	case "", "sd", "hd", "uhd":
+		return q, nil
+	case "4k":
+		return "uhd", nil
+	default:
+		return "", errors.Errorf("unknown video quality %q, use sd, hd or uhd", s)
+	}
+}
+
+// newProvider creates the named provider. Providers that support it remember
+// lookups in cache, which may be nil. RapidAPI providers take the rate
+// limiter of their key from limiters.
+func newProvider(logger *logrus.Logger, name string, cfg *config, secrets map[string]string, cache *lookupCache, limiters *limiterPool) (provider, error) {
+	switch name {
+	case "unogs":
+		// Several keys can be given, separated by commas, to spread a big
+		// scan over more than one key's quota.
+		var keys []string
+		for _, key := range strings.Split(secrets["RAPID_API_KEY"], ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("the unogs provider needs RAPID_API_KEY in secrets.json")
+		}
+		return &unogsProvider{
+			logger:   logger,
+			baseURL:  cfg.Unogs.BaseURL,
+			apiKeys:  keys,
+			limiters: limiters,
+			cache:    cache,
+
+			matcher: cfg.matcher(),
+		}, nil
+	case "streaming-availability":
+		key := strings.TrimSpace(strings.Split(secrets["RAPID_API_KEY"], ",")[0])
+		if key == "" {
+			return nil, errors.New("the streaming-availability provider needs RAPID_API_KEY in secrets.json")
+		}
+		return &streamingAvailabilityProvider{logger: logger, apiKey: key, limiter: limiters.limiter(key), cache: cache, matcher: cfg.matcher()}, nil
+	case "tmdb":
+		if secrets["TMDB_API_KEY"] == "" {
+			return nil, errors.New("the tmdb provider needs TMDB_API_KEY in secrets.json")
+		}
+		return &tmdbProvider{client: &tmdbClient{apiKey: secrets["TMDB_API_KEY"]}, cache: cache, matcher: cfg.matcher()}, nil
+	case "justwatch":
+		return &justwatchProvider{logger: logger, cache: cache, matcher: cfg.matcher()}, nil
+	case "mock":
+		return mockProvider{matcher: cfg.matcher()}, nil
+	default:
+		return nil, errors.Errorf("unknown provider %q", name)
+	}
+}
+
+// containsAll reports whether values has every one of wanted.
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		if !containsAny(values, []string{w}) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
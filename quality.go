@@ -0,0 +1,67 @@
+package main
+
+// Quality verdicts, comparing a found item's local copy with Netflix's.
+const (
+	qualityNetflix = "netflix"
+	qualityLocal   = "local"
+)
+
+// netflixBitrates are roughly the bitrates in kbps Netflix streams each
+// quality at. A local copy well above them, e.g. a remux, looks better at the
+// same resolution.
+var netflixBitrates = map[string]int{
+	"sd":  2000,
+	"hd":  8000,
+	"uhd": 16000,
+}
+
+// resolutionQuality returns the Netflix quality a Plex resolution compares
+// with, or "" for an unknown one.
+func resolutionQuality(resolution string) string {
+	switch rank := resolutionRank(resolution); {
+	case rank < 0:
+		return ""
+	case rank <= resolutionRank("576"):
+		return "sd"
+	case rank < resolutionRank("4k"):
+		return "hd"
+	default:
+		return "uhd"
+	}
+}
+
+// compareQuality returns qualityLocal when the local copy of an item is
+// better than what Netflix streams, by resolution, HDR or bitrate, and why,
+// or qualityNetflix when Netflix's is as good or better. It returns "" when
+// either quality isn't known.
+func compareQuality(item mediaItem, netflix string) (verdict, reason string) {
+	local := resolutionQuality(item.Resolution)
+	if local == "" || netflix == "" {
+		return "", ""
+	}
+	switch {
+	case qualityRank(local) > qualityRank(netflix):
+		return qualityLocal, "higher resolution"
+	case qualityRank(local) < qualityRank(netflix):
+		return qualityNetflix, ""
+	case item.HDR && netflix != "uhd":
+		// Netflix only streams HDR in UHD.
+		return qualityLocal, "hdr"
+	case item.Bitrate > 2*netflixBitrates[netflix]:
+		return qualityLocal, "higher bitrate"
+	default:
+		return qualityNetflix, ""
+	}
+}
+
+// qualityVerdictText describes a quality verdict for reports.
+func qualityVerdictText(verdict string) string {
+	switch verdict {
+	case qualityNetflix:
+		return "netflix is equal or better"
+	case qualityLocal:
+		return "keep local, better quality"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// actionQuarantine is the quarantine action, as used in policies.
+const actionQuarantine = "quarantine"
+
+// defaultQuarantineRetention is how long quarantined files are kept.
+const defaultQuarantineRetention = 30 * 24 * time.Hour
+
+// quarantineManifest is the file in the quarantine directory that records
+// where every quarantined file came from.
+const quarantineManifest = "plex2netflix-quarantine.json"
+
+// quarantineEntry is one quarantined item.
+type quarantineEntry struct {
+	Title   string    `json:"title"`
+	Year    int       `json:"year"`
+	Section string    `json:"section"`
+	Time    time.Time `json:"time"`
+	// Files are the original paths of the item's files. Each is kept at the
+	// same path under the quarantine directory.
+	Files []string `json:"files"`
+}
+
+// quarantine moves media files into a holding directory instead of deleting
+// them, so that bad matches can be undone until the retention period is up.
+type quarantine struct {
+	logger    *logrus.Logger
+	dir       string
+	retention time.Duration
+}
+
+// path returns where an original file is kept in the quarantine, which is
+// its absolute path under the quarantine directory.
+func (q *quarantine) path(original string) string {
+	return filepath.Join(q.dir, strings.TrimPrefix(original, filepath.VolumeName(original)))
+}
+
+// holds reports whether file is in the quarantine directory.
+func (q *quarantine) holds(file string) bool {
+	dir, err := filepath.Abs(q.dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (q *quarantine) load() ([]quarantineEntry, error) {
+	path := filepath.Join(q.dir, quarantineManifest)
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	var entries []quarantineEntry
+	return entries, errors.Wrapf(json.Unmarshal(bytes, &entries), "unmarshaling %s", path)
+}
+
+func (q *quarantine) save(entries []quarantineEntry) error {
+	if err := os.MkdirAll(q.dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", q.dir)
+	}
+	path := filepath.Join(q.dir, quarantineManifest)
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling quarantine manifest")
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, bytes, 0644), "writing %s", path)
+}
+
+// quarantineItems moves the files of the items found on Netflix into the
+// quarantine, then deletes files that have been there longer than the
+// retention period. Like -delete, only items whose confidence is 1 are
+// moved. With dryRun it only logs what it would move.
+func (q *quarantine) quarantineItems(conn *plex.Plex, cfg *config, activity *activityLog, results []checkResult, dryRun bool) {
+	logger := q.logger
+	entries, err := q.load()
+	if err != nil {
+		logger.WithField("error", err).Error("loading quarantine")
+		return
+	}
+
+	// Plex lists quarantined files until its next scan, and a quarantine
+	// directory inside a library is scanned like the rest of it, so files
+	// already quarantined are skipped rather than moved again.
+	quarantined := map[string]bool{}
+	for _, e := range entries {
+		for _, file := range e.Files {
+			quarantined[file] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, result := range allowedResults(logger, cfg, actionQuarantine, results) {
+		item := result.Item
+		entry := logger.WithField("title", item.Title).WithField("section", item.Section)
+		if result.Confidence < 1 {
+			entry.WithField("confidence", result.Confidence).Info("not quarantining a match that needs review")
+			continue
+		}
+		files := item.Files
+		if item.Type == "show" && item.RatingKey != "" {
+			if files, err = getPlexShowFiles(conn, item.RatingKey); err != nil {
+				entry.WithField("error", err).Error("getting episode files")
+				continue
+			}
+		}
+		var moved []string
+		for _, file := range files {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			if quarantined[file] || q.holds(file) {
+				entry.WithField("file", file).Debug("already quarantined")
+				continue
+			}
+			if dryRun {
+				entry.WithField("file", file).Info("would quarantine (dry run)")
+				continue
+			}
+			if err := moveFile(file, q.path(file)); err != nil {
+				entry.WithField("error", err).WithField("file", file).Error("quarantining file")
+				continue
+			}
+			moved = append(moved, file)
+		}
+		if len(moved) == 0 {
+			continue
+		}
+		entries = append(entries, quarantineEntry{Title: item.Title, Year: item.Year, Section: item.Section, Time: time.Now(), Files: moved})
+		entry.WithField("files", len(moved)).Info("quarantined")
+		activity.recordAction(actionQuarantine, item)
+	}
+
+	if dryRun {
+		return
+	}
+	if err := q.save(q.purge(entries)); err != nil {
+		logger.WithField("error", err).Error("saving quarantine")
+	}
+}
+
+// purge deletes the files of entries older than the retention period and
+// returns the entries that are left.
+func (q *quarantine) purge(entries []quarantineEntry) []quarantineEntry {
+	cutoff := time.Now().Add(-q.retention)
+	var kept []quarantineEntry
+	for _, e := range entries {
+		if e.Time.After(cutoff) {
+			kept = append(kept, e)
+			continue
+		}
+		for _, file := range e.Files {
+			if err := os.Remove(q.path(file)); err != nil && !os.IsNotExist(err) {
+				q.logger.WithField("error", err).WithField("file", file).Error("deleting quarantined file")
+			}
+		}
+		q.logger.WithField("title", e.Title).WithField("quarantined", e.Time).Info("deleted quarantined files past retention")
+	}
+	return kept
+}
+
+// undo moves the files of quarantined items whose title contains filter, or
+// of every item when filter is empty, back to where they came from.
+func (q *quarantine) undo(filter string) {
+	logger := q.logger
+	entries, err := q.load()
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading quarantine")
+	}
+	var kept []quarantineEntry
+	restored := 0
+	for _, e := range entries {
+		if filter != "" && !strings.Contains(strings.ToLower(e.Title), strings.ToLower(filter)) {
+			kept = append(kept, e)
+			continue
+		}
+		var failed []string
+		for _, file := range e.Files {
+			if err := moveFile(q.path(file), file); err != nil {
+				logger.WithField("error", err).WithField("file", file).Error("restoring file")
+				failed = append(failed, file)
+			}
+		}
+		if len(failed) > 0 {
+			e.Files = failed
+			kept = append(kept, e)
+			continue
+		}
+		logger.WithField("title", e.Title).WithField("year", e.Year).Info("restored")
+		restored++
+	}
+	if err := q.save(kept); err != nil {
+		logger.WithField("error", err).Fatal("saving quarantine")
+	}
+	logger.WithField("restored", restored).Info("restored files are picked up on Plex's next library scan")
+}
+
+// getPlexShowFiles returns the files of every episode of a show.
+func getPlexShowFiles(conn *plex.Plex, ratingKey string) ([]string, error) {
+	var content plexLibraryContent
+	if err := plexGet(conn, "/library/metadata/"+ratingKey+"/allLeaves", &content); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, episode := range content.MediaContainer.Metadata {
+		files = append(files, episode.files()...)
+	}
+	return files, nil
+}
+
+// moveFile moves a file, creating the directories it goes in, and copies it
+// when it can't be renamed, e.g. across filesystems.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(to))
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", from)
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", to)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return errors.Wrapf(err, "copying %s", from)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(to)
+		return errors.Wrapf(err, "closing %s", to)
+	}
+	in.Close()
+	return errors.Wrapf(os.Remove(from), "removing %s", from)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestQuarantine returns a quarantine in a temporary directory, and a
+// library directory next to it.
+func newTestQuarantine(t *testing.T) (*quarantine, string) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library")
+	if err := os.Mkdir(library, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &quarantine{logger: logger, dir: filepath.Join(dir, "quarantine"), retention: defaultQuarantineRetention}, library
+}
+
+// writeTestFile creates a file with some content, and the directories it's
+// in.
+func writeTestFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(path), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestQuarantineSkipsQuarantinedFiles(t *testing.T) {
+	q, library := newTestQuarantine(t)
+	roma := filepath.Join(library, "Roma (2018)", "Roma.mkv")
+	writeTestFile(t, roma)
+	results := []checkResult{{Item: mediaItem{Title: "Roma", Year: 2018, Type: "movie", Files: []string{roma}}, Found: true, Confidence: 1}}
+
+	q.quarantineItems(nil, &config{}, nil, results, false)
+	// Until Plex scans the library again, it still lists the file where it
+	// was.
+	q.quarantineItems(nil, &config{}, nil, results, false)
+	entries, err := q.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d quarantine entries, want 1", len(entries))
+	}
+
+	// A quarantine directory inside a library gets scanned like the rest of
+	// it.
+	inside := q.path(roma)
+	results[0].Item.Files = []string{inside}
+	q.quarantineItems(nil, &config{}, nil, results, false)
+	if !exists(inside) || exists(q.path(inside)) {
+		t.Error("a file in the quarantine was moved again")
+	}
+	if entries, _ := q.load(); len(entries) != 1 {
+		t.Errorf("got %d quarantine entries, want 1", len(entries))
+	}
+}
+
+func TestQuarantineItems(t *testing.T) {
+	q, library := newTestQuarantine(t)
+	roma := filepath.Join(library, "Roma (2018)", "Roma.mkv")
+	heat := filepath.Join(library, "Heat (1995)", "Heat.mkv")
+	taxi := filepath.Join(library, "Taxi Driver (1976)", "Taxi Driver.mkv")
+	for _, file := range []string{roma, heat, taxi} {
+		writeTestFile(t, file)
+	}
+	results := []checkResult{
+		{Item: mediaItem{Title: "Roma", Year: 2018, Type: "movie", Files: []string{roma}}, Found: true, Confidence: 1},
+		// A fuzzy match is left for review.
+		{Item: mediaItem{Title: "Heat", Year: 1995, Type: "movie", Files: []string{heat}}, Found: true, Confidence: 0.9},
+		{Item: mediaItem{Title: "Taxi Driver", Year: 1976, Type: "movie", Files: []string{taxi}}},
+	}
+
+	q.quarantineItems(nil, &config{}, nil, results, true)
+	if !exists(roma) || exists(q.dir) {
+		t.Fatal("a dry run moved files")
+	}
+
+	q.quarantineItems(nil, &config{}, nil, results, false)
+	if exists(roma) || !exists(q.path(roma)) {
+		t.Error("Roma wasn't moved into the quarantine")
+	}
+	if !exists(heat) || !exists(taxi) {
+		t.Error("a title that wasn't a sure match was moved")
+	}
+	entries, err := q.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Title != "Roma" || len(entries[0].Files) != 1 || entries[0].Files[0] != roma {
+		t.Errorf("quarantine entries = %+v, want Roma's file", entries)
+	}
+}
+
+func TestQuarantineUndo(t *testing.T) {
+	q, library := newTestQuarantine(t)
+	roma := filepath.Join(library, "Roma (2018)", "Roma.mkv")
+	okja := filepath.Join(library, "Okja (2017)", "Okja.mkv")
+	for _, file := range []string{roma, okja} {
+		writeTestFile(t, file)
+	}
+	results := []checkResult{
+		{Item: mediaItem{Title: "Roma", Year: 2018, Type: "movie", Files: []string{roma}}, Found: true, Confidence: 1},
+		{Item: mediaItem{Title: "Okja", Year: 2017, Type: "movie", Files: []string{okja}}, Found: true, Confidence: 1},
+	}
+	q.quarantineItems(nil, &config{}, nil, results, false)
+
+	q.undo("roma")
+	if !exists(roma) || exists(q.path(roma)) {
+		t.Error("Roma wasn't restored")
+	}
+	if exists(okja) {
+		t.Error("Okja was restored without matching the filter")
+	}
+	entries, err := q.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Title != "Okja" {
+		t.Errorf("quarantine entries = %+v, want only Okja's", entries)
+	}
+
+	q.undo("")
+	if !exists(okja) {
+		t.Error("Okja wasn't restored")
+	}
+}
+
+func TestQuarantinePurge(t *testing.T) {
+	q, library := newTestQuarantine(t)
+	old, recent := filepath.Join(library, "Old.mkv"), filepath.Join(library, "Recent.mkv")
+	for _, file := range []string{old, recent} {
+		writeTestFile(t, q.path(file))
+	}
+	entries := []quarantineEntry{
+		{Title: "Old", Time: time.Now().Add(-q.retention - time.Hour), Files: []string{old}},
+		{Title: "Recent", Time: time.Now().Add(-time.Hour), Files: []string{recent}},
+	}
+
+	kept := q.purge(entries)
+	if len(kept) != 1 || kept[0].Title != "Recent" {
+		t.Errorf("kept %+v, want only the recent entry", kept)
+	}
+	if exists(q.path(old)) || !exists(q.path(recent)) {
+		t.Error("purged the wrong files")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Radarr cleanup actions, as used in policies.
+const (
+	actionRadarrUnmonitor = "radarr-unmonitor"
+	actionRadarrTag       = "radarr-tag"
+	actionRadarrDelete    = "radarr-delete"
+)
+
+// radarrCleanup picks what's done in Radarr to movies found on Netflix.
+type radarrCleanup struct {
+	unmonitor bool
+	// tag is a Radarr tag to add, created if it doesn't exist.
+	tag    string
+	delete bool
+	// dryRun logs what would be done without changing anything.
+	dryRun bool
+}
+
+type arrTag struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+// cleanUp unmonitors, tags or deletes the movies found on Netflix in Radarr.
+// Deleting removes the movie's files too. Movies Radarr doesn't manage are
+// skipped, and like with -delete, only matches with a confidence of 1 are
+// touched: fuzzy matches and editions are left for review.
+func (c *arrClient) cleanUp(logger *logrus.Logger, cfg *config, activity *activityLog, results []checkResult, cleanup radarrCleanup) {
+	var library []arrMedia
+	if err := c.get("/api/v3/movie", &library); err != nil {
+		logger.WithField("error", err).Error("getting Radarr movies")
+		return
+	}
+
+	tagID := 0
+	if cleanup.tag != "" {
+		var err error
+		if tagID, err = c.tagID(cleanup.tag, cleanup.dryRun); err != nil {
+			logger.WithField("error", err).WithField("tag", cleanup.tag).Error("getting Radarr tag")
+			return
+		}
+	}
+
+	steps := []struct {
+		action  string
+		enabled bool
+		// needed reports whether the movie isn't already done.
+		needed func(arrMedia) bool
+		apply  func(ids []int) error
+	}{
+		{actionRadarrTag, cleanup.tag != "", func(m arrMedia) bool { return tagID == 0 || !containsInt(m.Tags, tagID) }, func(ids []int) error {
+			return c.send("PUT", "/api/v3/movie/editor", map[string]interface{}{"movieIds": ids, "tags": []int{tagID}, "applyTags": "add"}, nil)
+		}},
+		{actionRadarrUnmonitor, cleanup.unmonitor, func(m arrMedia) bool { return m.Monitored }, func(ids []int) error {
+			return c.send("PUT", "/api/v3/movie/editor", map[string]interface{}{"movieIds": ids, "monitored": false}, nil)
+		}},
+		{actionRadarrDelete, cleanup.delete, func(arrMedia) bool { return true }, func(ids []int) error {
+			return c.send("DELETE", "/api/v3/movie/editor", map[string]interface{}{"movieIds": ids, "deleteFiles": true, "addImportExclusion": false}, nil)
+		}},
+	}
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		var ids []int
+		var items []mediaItem
+		for _, result := range allowedResults(logger, cfg, step.action, results) {
+			item := result.Item
+			if item.Type == "show" {
+				continue
+			}
+			if result.Confidence < 1 {
+				logger.WithField("title", item.Title).WithField("action", step.action).WithField("confidence", result.Confidence).Info("not applying in Radarr to a match that needs review")
+				continue
+			}
+			m, ok := findArrMedia(library, item)
+			if !ok {
+				logger.WithField("title", item.Title).Debug("not in Radarr")
+				continue
+			}
+			if step.needed(m) {
+				ids = append(ids, m.ID)
+				items = append(items, item)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if cleanup.dryRun {
+			for _, item := range items {
+				logger.WithField("title", item.Title).WithField("action", step.action).Info("would apply in Radarr (dry run)")
+			}
+			continue
+		}
+		if err := step.apply(ids); err != nil {
+			logger.WithField("error", err).WithField("action", step.action).Error("updating Radarr")
+			continue
+		}
+		for _, item := range items {
+			logger.WithField("title", item.Title).WithField("action", step.action).Info("applied in Radarr")
+			activity.recordAction(step.action, item)
+		}
+	}
+}
+
+// tagID returns the ID of the Radarr or Sonarr tag with the label, creating
+// it unless dryRun is set, in which case a missing tag is 0.
+func (c *arrClient) tagID(label string, dryRun bool) (int, error) {
+	var tags []arrTag
+	if err := c.get("/api/v3/tag", &tags); err != nil {
+		return 0, err
+	}
+	for _, t := range tags {
+		if strings.EqualFold(t.Label, label) {
+			return t.ID, nil
+		}
+	}
+	if dryRun {
+		return 0, nil
+	}
+	var created arrTag
+	if err := c.send("POST", "/api/v3/tag", arrTag{Label: label}, &created); err != nil {
+		return 0, errors.Wrap(err, "creating tag")
+	}
+	return created.ID, nil
+}
+
+// findArrMedia finds the item in a Radarr or Sonarr library by TMDB, TVDB or
+// IMDb ID, or failing those by title and year.
+func findArrMedia(library []arrMedia, item mediaItem) (arrMedia, bool) {
+	for _, m := range library {
+		switch {
+		case item.TMDBID != "" && m.TMDBID != 0:
+			if item.TMDBID == strconv.Itoa(m.TMDBID) {
+				return m, true
+			}
+		case item.TVDBID != "" && m.TVDBID != 0:
+			if item.TVDBID == strconv.Itoa(m.TVDBID) {
+				return m, true
+			}
+		case item.IMDbID != "" && m.IMDbID != "":
+			if strings.EqualFold(item.IMDbID, m.IMDbID) {
+				return m, true
+			}
+		case strings.EqualFold(item.Title, m.Title) && (item.Year == 0 || item.Year == m.Year):
+			return m, true
+		}
+	}
+	return arrMedia{}, false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// arrRequest is a request a fakeArr received, with its JSON body decoded.
+type arrRequest struct {
+	method, path string
+	body         map[string]interface{}
+}
+
+// fakeArr is a Radarr or Sonarr API that answers GETs with canned responses
+// and records every other request.
+type fakeArr struct {
+	t         *testing.T
+	responses map[string]interface{}
+	mu        sync.Mutex
+	changes   []arrRequest
+}
+
+func (f *fakeArr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Api-Key") != "key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == "GET" {
+		response, ok := f.responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	f.mu.Lock()
+	f.changes = append(f.changes, arrRequest{r.Method, r.URL.Path, body})
+	f.mu.Unlock()
+	if r.URL.Path == "/api/v3/tag" {
+		json.NewEncoder(w).Encode(arrTag{ID: 9, Label: body["label"].(string)})
+	}
+}
+
+// newFakeArr starts a fakeArr and returns a client for it.
+func newFakeArr(t *testing.T, name string, responses map[string]interface{}) (*fakeArr, *arrClient) {
+	f := &fakeArr{t: t, responses: responses}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, &arrClient{name: name, baseURL: server.URL, apiKey: "key"}
+}
+
+// jsonInts reads a list of IDs from a decoded JSON body.
+func jsonInts(value interface{}) []int {
+	var ids []int
+	list, _ := value.([]interface{})
+	for _, id := range list {
+		if n, ok := id.(float64); ok {
+			ids = append(ids, int(n))
+		}
+	}
+	return ids
+}
+
+var radarrTestResults = []checkResult{
+	{Item: mediaItem{Title: "Roma", Year: 2018, Type: "movie", TMDBID: "426426"}, Found: true, Confidence: 1},
+	{Item: mediaItem{Title: "Okja", Year: 2017, Type: "movie"}, Found: true, Confidence: 1},
+	// A fuzzy match is left for review.
+	{Item: mediaItem{Title: "Heat", Year: 1995, Type: "movie"}, Found: true, Confidence: 0.9},
+	{Item: mediaItem{Title: "Taxi Driver", Year: 1976, Type: "movie"}, Found: false},
+	{Item: mediaItem{Title: "Bird Box", Year: 2018, Type: "movie"}, Found: true, Confidence: 1},
+}
+
+func newFakeRadarr(t *testing.T) (*fakeArr, *arrClient) {
+	return newFakeArr(t, "Radarr", map[string]interface{}{
+		"/api/v3/movie": []arrMedia{
+			{ID: 1, Title: "Roma", Year: 2018, TMDBID: 426426, Monitored: true},
+			{ID: 2, Title: "Okja", Year: 2017, Tags: []int{5}},
+			{ID: 3, Title: "Heat", Year: 1995, Monitored: true},
+			{ID: 4, Title: "Taxi Driver", Year: 1976, Monitored: true},
+		},
+		"/api/v3/tag": []arrTag{{ID: 5, Label: "netflix"}},
+	})
+}
+
+func TestRadarrCleanUp(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	radarr, client := newFakeRadarr(t)
+
+	client.cleanUp(logger, &config{}, nil, radarrTestResults, radarrCleanup{unmonitor: true, tag: "Netflix"})
+	if len(radarr.changes) != 2 {
+		t.Fatalf("made %d changes, want a tag and an unmonitor: %v", len(radarr.changes), radarr.changes)
+	}
+	// Okja is already tagged and unmonitored, and Bird Box isn't in Radarr.
+	tag, unmonitor := radarr.changes[0], radarr.changes[1]
+	if tag.method != "PUT" || tag.path != "/api/v3/movie/editor" || !reflect.DeepEqual(jsonInts(tag.body["movieIds"]), []int{1}) || !reflect.DeepEqual(jsonInts(tag.body["tags"]), []int{5}) {
+		t.Errorf("tagged with %v", tag)
+	}
+	if unmonitor.method != "PUT" || !reflect.DeepEqual(jsonInts(unmonitor.body["movieIds"]), []int{1}) || unmonitor.body["monitored"] != false {
+		t.Errorf("unmonitored with %v", unmonitor)
+	}
+}
+
+func TestRadarrDelete(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	radarr, client := newFakeRadarr(t)
+
+	client.cleanUp(logger, &config{}, nil, radarrTestResults, radarrCleanup{delete: true, tag: "keep-off", dryRun: true})
+	if len(radarr.changes) != 0 {
+		t.Fatalf("a dry run made changes: %v", radarr.changes)
+	}
+
+	client.cleanUp(logger, &config{}, nil, radarrTestResults, radarrCleanup{delete: true})
+	if len(radarr.changes) != 1 {
+		t.Fatalf("made %d changes, want a delete: %v", len(radarr.changes), radarr.changes)
+	}
+	del := radarr.changes[0]
+	if del.method != "DELETE" || del.path != "/api/v3/movie/editor" || !reflect.DeepEqual(jsonInts(del.body["movieIds"]), []int{1, 2}) || del.body["deleteFiles"] != true {
+		t.Errorf("deleted with %v", del)
+	}
+}
+
+func TestRadarrCreatesTag(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	radarr, client := newFakeRadarr(t)
+
+	client.cleanUp(logger, &config{}, nil, radarrTestResults, radarrCleanup{tag: "streamable"})
+	if len(radarr.changes) != 2 || radarr.changes[0].path != "/api/v3/tag" || radarr.changes[0].body["label"] != "streamable" {
+		t.Fatalf("changes %v, want the tag created first", radarr.changes)
+	}
+	if tag := radarr.changes[1]; !reflect.DeepEqual(jsonInts(tag.body["movieIds"]), []int{1, 2}) || !reflect.DeepEqual(jsonInts(tag.body["tags"]), []int{9}) {
+		t.Errorf("tagged with %v", tag)
+	}
+}
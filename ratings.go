@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ratingSource maps the image URIs Plex uses to badge a rating to the rating's
+// source.
+func ratingSource(image string, audience bool) string {
+	switch {
+	case strings.HasPrefix(image, "rottentomatoes://"):
+		if audience {
+			return "rottentomatoes_audience"
+		}
+		return "rottentomatoes_critic"
+	case strings.HasPrefix(image, "imdb://"):
+		return "imdb"
+	case strings.HasPrefix(image, "themoviedb://"):
+		return "tmdb"
+	default:
+		return ""
+	}
+}
+
+// ratings returns the critic and audience ratings Plex has for the item.
+func (m plexMetadata) ratings() map[string]float64 {
+	ratings := map[string]float64{}
+	if source := ratingSource(m.RatingImage, false); source != "" && m.Rating != 0 {
+		ratings[source] = m.Rating
+	}
+	if source := ratingSource(m.AudienceRatingImage, true); source != "" && m.AudienceRating != 0 {
+		ratings[source] = m.AudienceRating
+	}
+	return ratings
+}
+
+const tmdbAPI = "https://api.themoviedb.org/3"
+
+type tmdbClient struct {
+	apiKey string
+	// calls counts the requests made, for the tmdb provider.
+	calls int64
+}
+
+type tmdbMovie struct {
+	ID          int     `json:"id"`
+	VoteAverage float64 `json:"vote_average"`
+}
+
+// rating returns the TMDB user score of an item, looking it up by TMDB ID when
+// it's known and by title and year otherwise. It returns 0 when there is no
+// match.
+func (c *tmdbClient) rating(item mediaItem) (float64, error) {
+	kind, yearParam := "movie", "year"
+	if item.Type == "show" {
+		kind, yearParam = "tv", "first_air_date_year"
+	}
+	if item.TMDBID != "" {
+		var movie tmdbMovie
+		if err := c.get("/"+kind+"/"+item.TMDBID, url.Values{}, &movie); err != nil {
+			return 0, err
+		}
+		return movie.VoteAverage, nil
+	}
+
+	params := url.Values{}
+	params.Set("query", item.Title)
+	if item.Year != 0 {
+		params.Set(yearParam, fmt.Sprint(item.Year))
+	}
+	var search struct {
+		Results []tmdbMovie `json:"results"`
+	}
+	if err := c.get("/search/"+kind, params, &search); err != nil {
+		return 0, err
+	}
+	if len(search.Results) == 0 {
+		return 0, nil
+	}
+	return search.Results[0].VoteAverage, nil
+}
+
+func (c *tmdbClient) get(path string, params url.Values, v interface{}) error {
+	params.Set("api_key", c.apiKey)
+	atomic.AddInt64(&c.calls, 1)
+	resp, err := httpClient.Get(tmdbAPI + path + "?" + params.Encode())
+	if err != nil {
+		return errors.Wrap(err, "calling TMDB")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("TMDB returned %s for %s", resp.Status, path)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding TMDB response")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	plexAccountURL = "https://plex.tv/api/v2/user"
+	// geoIPURL answers with the two-letter country code of the caller's
+	// public IP.
+	geoIPURL = "https://ipapi.co/country/"
+)
+
+// resolveAutoCountries replaces "auto" in the configured countries with the
+// detected region.
+func resolveAutoCountries(logger *logrus.Logger, cfg *config, plexToken string) error {
+	var country string
+	resolve := func(countries []string) ([]string, error) {
+		resolved := make([]string, 0, len(countries))
+		for _, c := range countries {
+			if c != "auto" {
+				resolved = append(resolved, c)
+				continue
+			}
+			if country == "" {
+				var err error
+				if country, err = detectCountry(logger, plexToken); err != nil {
+					return nil, err
+				}
+				logger.WithField("country", country).Info("detected Netflix region")
+			}
+			resolved = append(resolved, country)
+		}
+		return resolved, nil
+	}
+
+	var err error
+	if cfg.Countries, err = resolve(cfg.Countries); err != nil {
+		return err
+	}
+	for name, library := range cfg.Libraries {
+		if library.Countries, err = resolve(library.Countries); err != nil {
+			return err
+		}
+		cfg.Libraries[name] = library
+	}
+	return nil
+}
+
+// detectCountry guesses the Netflix region from the country of the plex.tv
+// account, falling back to a GeoIP lookup of the public IP.
+func detectCountry(logger *logrus.Logger, plexToken string) (string, error) {
+	if plexToken != "" {
+		country, err := plexAccountCountry(plexToken)
+		if err == nil && country != "" {
+			return country, nil
+		}
+		if err != nil {
+			logger.WithField("error", err).Warn("getting the plex.tv account's country, trying GeoIP")
+		}
+	}
+
+	resp, err := httpClient.Get(geoIPURL)
+	if err != nil {
+		return "", errors.Wrap(err, "calling GeoIP service")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "reading GeoIP response")
+	}
+	country := strings.ToLower(strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK || len(country) != 2 {
+		return "", errors.Errorf("GeoIP service returned %s: %s", resp.Status, body)
+	}
+	return country, nil
+}
+
+func plexAccountCountry(token string) (string, error) {
+	var account struct {
+		Country string `json:"country"`
+	}
+	if err := plexTVGet(token, plexAccountURL, &account); err != nil {
+		return "", err
+	}
+	return strings.ToLower(account.Country), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// htmlReport is a standalone page, posters and all, so it can be shared
+// without access to the Plex server. Clicking a column header sorts by it.
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>plex2netflix report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 0.4em 0.8em; text-align: left; border-bottom: 1px solid #ddd; vertical-align: middle; }
+th { cursor: pointer; background: #f4f4f4; position: sticky; top: 0; }
+td img { width: 60px; border-radius: 3px; }
+tr.found td { background: #eefaf0; }
+tr.error td { color: #b00; }
+a { color: #e50914; }
+</style>
+</head>
+<body>
+<h1>plex2netflix report</h1>
+<p>{{.Found}} of {{len .Records}} titles on Netflix, {{.Time}}</p>
+<table id="results">
+<thead><tr><th></th><th>Title</th><th>Year</th><th>Library</th><th>On Netflix</th><th>Netflix</th><th>Countries</th><th>Quality</th><th>Quality Verdict</th><th>Confidence</th></tr></thead>
+<tbody>
+{{range .Records}}<tr class="{{if .Error}}error{{else if .OnNetflix}}found{{end}}">
+<td>{{if .Poster}}<img src="{{.Poster}}" alt="">{{end}}</td>
+<td>{{.Title}}</td>
+<td>{{if .Year}}{{.Year}}{{end}}</td>
+<td>{{.Library}}</td>
+<td>{{if .Error}}error: {{.Error}}{{else if .OnNetflix}}yes{{if .Leaving}}, leaving {{.Leaving}}{{end}}{{else}}no{{end}}</td>
+<td>{{if .NetflixID}}<a href="https://www.netflix.com/title/{{.NetflixID}}">{{.NetflixID}}</a>{{end}}</td>
+<td>{{range $i, $c := .Countries}}{{if $i}} {{end}}{{$c}}{{end}}</td>
+<td>{{.Quality}}</td>
+<td>{{.Verdict}}</td>
+<td>{{if .OnNetflix}}{{printf "%.2f" .Confidence}}{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+<script>
+document.querySelectorAll("#results th").forEach(function (th, column) {
+  var ascending = true;
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#results tbody");
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[column].textContent, y = b.cells[column].textContent;
+      var n = parseFloat(x) - parseFloat(y);
+      var order = isNaN(n) ? x.localeCompare(y) : n;
+      return ascending ? order : -order;
+    });
+    ascending = !ascending;
+    rows.forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTMLReport writes the HTML report, dated with dates.
+func writeHTMLReport(w io.Writer, records []exportRecord, dates dateFormatter) error {
+	found := 0
+	for _, r := range records {
+		if r.OnNetflix {
+			found++
+		}
+	}
+	return htmlReport.Execute(w, struct {
+		Time    string
+		Found   int
+		Records []exportRecord
+	}{dates.dateTime(time.Now()), found, records})
+}
+
+// runReport implements the report subcommand, which shows the last saved
+// results as a table, or writes them in -format to -out.
+func runReport(logger *logrus.Logger, cfg *config, opts options) {
+	saved, err := loadLastResults(opts.stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading results, run a scan first")
+	}
+	if opts.output == "" {
+		printResultsTable(os.Stdout, saved.Results, cfg.dates, !opts.noColor && os.Getenv("NO_COLOR") == "")
+		return
+	}
+	if err := exportResults(opts.out, opts.output, saved.Results, opts.breakdown, cfg.dates); err != nil {
+		logger.WithField("error", err).Fatal("writing report")
+	}
+	if opts.out != "-" {
+		logger.WithField("file", opts.out).Info("wrote report")
+	}
+}
+
+// addPosters fetches small poster thumbnails from Plex for the titles found
+// on Netflix and embeds them in the results as data URLs, which keeps the
+// Plex token out of the report.
+func addPosters(logger *logrus.Logger, conn *plex.Plex, results []checkResult) {
+	for i, result := range results {
+		if !result.Found || result.Item.Thumb == "" {
+			continue
+		}
+		poster, err := plexPoster(conn, result.Item.Thumb)
+		if err != nil {
+			logger.WithField("error", err).WithField("title", result.Item.Title).Warn("getting poster")
+			continue
+		}
+		results[i].Item.Poster = poster
+	}
+}
+
+func plexPoster(conn *plex.Plex, thumb string) (string, error) {
+	params := url.Values{}
+	params.Set("width", "120")
+	params.Set("height", "180")
+	params.Set("minSize", "1")
+	params.Set("url", thumb)
+	req, err := http.NewRequest("GET", strings.TrimSuffix(conn.URL, "/")+"/photo/:/transcode?"+params.Encode(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("X-Plex-Token", conn.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "calling Plex")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Plex returned %s for the poster", resp.Status)
+	}
+	image, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "reading poster")
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image), nil
+}
+
+// writeMarkdownReport writes a table per library and a totals line, for
+// pasting into a wiki, issue or note.
+func writeMarkdownReport(w io.Writer, records []exportRecord) error {
+	byLibrary := map[string][]exportRecord{}
+	var libraries []string
+	for _, r := range records {
+		if _, ok := byLibrary[r.Library]; !ok {
+			libraries = append(libraries, r.Library)
+		}
+		byLibrary[r.Library] = append(byLibrary[r.Library], r)
+	}
+	sort.Strings(libraries)
+
+	cell := strings.NewReplacer("|", `\|`, "\n", " ")
+	var b strings.Builder
+	found := 0
+	for _, library := range libraries {
+		rows := byLibrary[library]
+		libraryFound := 0
+		fmt.Fprintf(&b, "## %s\n\n| Title | Year | On Netflix | Netflix ID | Countries | Quality | Quality Verdict |\n| --- | --- | --- | --- | --- | --- | --- |\n", cell.Replace(library))
+		for _, r := range rows {
+			status := "no"
+			switch {
+			case r.Error != "":
+				status = "error"
+			case r.OnNetflix:
+				status = "yes"
+				if r.Leaving != "" {
+					status += ", leaving " + r.Leaving
+				}
+				libraryFound++
+			}
+			year, id := "", ""
+			if r.Year != 0 {
+				year = strconv.Itoa(r.Year)
+			}
+			if r.NetflixID != "" {
+				id = fmt.Sprintf("[%s](https://www.netflix.com/title/%s)", r.NetflixID, r.NetflixID)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n", cell.Replace(r.Title), year, status, id, strings.Join(r.Countries, " "), r.Quality, r.Verdict)
+		}
+		fmt.Fprintf(&b, "\n%d of %d on Netflix\n\n", libraryFound, len(rows))
+		found += libraryFound
+	}
+	fmt.Fprintf(&b, "**Total: %d of %d titles on Netflix**\n", found, len(records))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// resultsFile is the saved outcome of one run.
+type resultsFile struct {
+	Time time.Time `json:"time"`
+	// Partial is set when the run was interrupted before every item was
+	// checked.
+	Partial bool          `json:"partial,omitempty"`
+	Results []checkResult `json:"results"`
+}
+
+func saveResults(path string, results []checkResult, partial bool) error {
+	bytes, err := json.MarshalIndent(resultsFile{Time: time.Now(), Partial: partial, Results: results}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling results")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", filepath.Dir(path))
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, bytes, 0644), "writing %s", path)
+}
+
+func loadResults(path string) (*resultsFile, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	var f resultsFile
+	if err := json.Unmarshal(bytes, &f); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", path)
+	}
+	return &f, nil
+}
+
+// loadLastResults loads the last run's results from stateDir. When the run
+// was killed before it could save them, or is still going, they're read
+// from its journal instead, as partial results.
+func loadLastResults(stateDir string) (*resultsFile, error) {
+	path := filepath.Join(stateDir, "results.json")
+	journal, err := os.Stat(filepath.Join(stateDir, "results.journal"))
+	if err == nil {
+		if saved, err := os.Stat(path); err != nil || journal.ModTime().After(saved.ModTime()) {
+			return readJournal(stateDir)
+		}
+	}
+	return loadResults(path)
+}
+
+// readJournal reads the results written to the journal in stateDir. A last
+// line cut short by the process being killed is skipped.
+func readJournal(stateDir string) (*resultsFile, error) {
+	path := filepath.Join(stateDir, "results.journal")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	saved := &resultsFile{Time: stat.ModTime(), Partial: true, Results: []checkResult{}}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var result checkResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		saved.Results = append(saved.Results, result)
+	}
+	return saved, errors.Wrapf(scanner.Err(), "reading %s", path)
+}
+
+// recoverJournal saves the results in a journal left behind by a run that was
+// killed before it could save them, e.g. by SIGKILL or the OOM killer, as
+// partial results, and removes the journal. It returns how many results it
+// recovered.
+func recoverJournal(stateDir string) (int, error) {
+	path := filepath.Join(stateDir, "results.journal")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	saved, err := readJournal(stateDir)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveResults(filepath.Join(stateDir, "results.json"), saved.Results, true); err != nil {
+		return 0, err
+	}
+	return len(saved.Results), errors.Wrapf(os.Remove(path), "removing %s", path)
+}
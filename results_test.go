@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal := `{"item":{"title":"Roma","year":2018},"found":true}
+{"item":{"title":"Bird Box","year":2018},"found":false}
+{"item":{"title":"Tru`
+	if err := ioutil.WriteFile(filepath.Join(dir, "results.journal"), []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := loadLastResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Partial || len(saved.Results) != 2 {
+		t.Fatalf("read %d results from the journal, partial %v, want 2 partial", len(saved.Results), saved.Partial)
+	}
+
+	n, err := recoverJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("recovered %d results, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "results.journal")); !os.IsNotExist(err) {
+		t.Errorf("journal still there after recovery: %v", err)
+	}
+	saved, err = loadResults(filepath.Join(dir, "results.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Partial || len(saved.Results) != 2 || saved.Results[0].Item.Title != "Roma" {
+		t.Errorf("saved %+v, want Roma and Bird Box as partial results", saved)
+	}
+}
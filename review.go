@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const reviewHelp = `Commands:
+  l                 list the results shown
+  f <text>          show titles containing text, or all titles without it
+  s found|missing|errors|all
+                    show only titles on Netflix, not on it, that failed, or all
+  k <n>             add title n to the keep list
+  o <n>             open title n's Netflix page
+  d <n>             queue title n for deletion, or unqueue it
+  q                 finish, and delete the queued titles after confirming
+`
+
+// reviewResults lets results be reviewed at the terminal once a scan is
+// done: filtered, added to the keep list, opened on Netflix and queued for
+// deletion. It returns the results queued for deletion, with a confidence of
+// 1: queueing a fuzzy match confirms it.
+func reviewResults(logger *logrus.Logger, keepFile string, in io.Reader, out io.Writer, results []checkResult) []checkResult {
+	filter, status := "", "found"
+	queued := map[int]bool{}
+	var shown []int
+	list := func() {
+		shown = shown[:0]
+		for i, result := range results {
+			switch {
+			case status == "found" && !result.Found,
+				status == "missing" && (result.Found || result.Error != ""),
+				status == "errors" && result.Error == "":
+				continue
+			}
+			if filter != "" && !strings.Contains(strings.ToLower(result.Item.Title), strings.ToLower(filter)) {
+				continue
+			}
+			shown = append(shown, i)
+			mark := " "
+			if queued[i] {
+				mark = "D"
+			}
+			fmt.Fprintf(out, "%4d %s %-12s %s (%d), %s\n", len(shown), mark, reviewStatus(result), result.Item.Title, result.Item.Year, result.Item.Section)
+		}
+		fmt.Fprintf(out, "%d of %d titles, %d queued for deletion\n", len(shown), len(results), len(queued))
+	}
+
+	fmt.Fprint(out, reviewHelp)
+	list()
+	scanner := bufio.NewScanner(in)
+	for fmt.Fprint(out, "> "); scanner.Scan(); fmt.Fprint(out, "> ") {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		command, arg := fields[0], strings.Join(fields[1:], " ")
+		if command == "q" {
+			break
+		}
+		var result checkResult
+		i := -1
+		if command == "k" || command == "o" || command == "d" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(shown) {
+				fmt.Fprintf(out, "no title %q in the list\n", arg)
+				continue
+			}
+			i = shown[n-1]
+			result = results[i]
+		}
+		switch command {
+		case "l":
+			list()
+		case "f":
+			filter = arg
+			list()
+		case "s":
+			switch arg {
+			case "found", "missing", "errors", "all":
+				status = arg
+				list()
+			default:
+				fmt.Fprint(out, reviewHelp)
+			}
+		case "k":
+			if err := appendKeepList(keepFile, result.Item); err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			fmt.Fprintf(out, "added %s to %s\n", result.Item.Title, keepFile)
+		case "o":
+			if result.NetflixID == "" {
+				fmt.Fprintf(out, "no Netflix ID for %s\n", result.Item.Title)
+				continue
+			}
+			url := "https://www.netflix.com/title/" + result.NetflixID
+			if err := openBrowser(url); err != nil {
+				fmt.Fprintf(out, "%s\n", url)
+			}
+		case "d":
+			if !result.Found || result.Item.RatingKey == "" {
+				fmt.Fprintf(out, "%s isn't a Plex title on Netflix\n", result.Item.Title)
+				continue
+			}
+			if queued[i] {
+				delete(queued, i)
+				fmt.Fprintf(out, "unqueued %s\n", result.Item.Title)
+			} else {
+				queued[i] = true
+				fmt.Fprintf(out, "queued %s for deletion\n", result.Item.Title)
+			}
+		default:
+			fmt.Fprint(out, reviewHelp)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.WithField("error", err).Error("reading review commands")
+	}
+
+	var doomed []checkResult
+	for i, result := range results {
+		if queued[i] {
+			result.Confidence = 1
+			doomed = append(doomed, result)
+		}
+	}
+	return doomed
+}
+
+func reviewStatus(result checkResult) string {
+	switch {
+	case result.Error != "":
+		return "error"
+	case result.Found:
+		return "on netflix"
+	default:
+		return "not found"
+	}
+}
+
+// appendKeepList adds an item to the keep list file by its most specific
+// key.
+func appendKeepList(path string, item mediaItem) error {
+	if path == "" {
+		return errors.New("set -keep or keep_file in the config to keep titles")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "# %s (%d)\n%s\n", item.Title, item.Year, item.pinKeys()[0]); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return errors.Wrapf(f.Close(), "closing %s", path)
+}
+
+// openBrowser opens url in the default browser.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
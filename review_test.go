@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestReviewResults(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	keepFile := filepath.Join(t.TempDir(), "keep.txt")
+	results := []checkResult{
+		{Item: mediaItem{Title: "Roma", Year: 2018, RatingKey: "1"}, Found: true, Confidence: 1},
+		{Item: mediaItem{Title: "Heat", Year: 1995, RatingKey: "2"}, Found: true, Confidence: 0.9},
+		{Item: mediaItem{Title: "Taxi Driver", Year: 1976, RatingKey: "3"}},
+		{Item: mediaItem{Title: "Okja", Year: 2017, RatingKey: "4"}, Found: true, Confidence: 1},
+	}
+	// Only found titles are listed at first: Roma, Heat and Okja.
+	commands := strings.Join([]string{
+		"d 1",
+		"d 2",
+		"k 3",
+		"d 3",
+		"d 3",
+		"s all",
+		"d 3",
+		"q",
+	}, "\n")
+	var out bytes.Buffer
+	queued := reviewResults(logger, keepFile, strings.NewReader(commands), &out, results)
+
+	var titles []string
+	for _, result := range queued {
+		titles = append(titles, result.Item.Title)
+		// Queueing a title confirms the match, so -delete takes it.
+		if result.Confidence != 1 {
+			t.Errorf("%s queued with confidence %v, want 1", result.Item.Title, result.Confidence)
+		}
+	}
+	if strings.Join(titles, ",") != "Roma,Heat" {
+		t.Errorf("queued %q, want Roma and Heat", titles)
+	}
+	if !strings.Contains(out.String(), "Taxi Driver isn't a Plex title on Netflix") {
+		t.Error("queued a title that isn't on Netflix")
+	}
+	keep, err := ioutil.ReadFile(keepFile)
+	if err != nil || !strings.Contains(string(keep), "Okja") {
+		t.Errorf("keep list = %q, %v, want Okja in it", keep, err)
+	}
+
+	items, _ := deletableItems(logger, &config{}, queued)
+	if len(items) != 2 {
+		t.Errorf("%d queued titles deletable, want 2", len(items))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var videoExtensions = map[string]bool{
+	".avi":  true,
+	".m2ts": true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".mpg":  true,
+	".ts":   true,
+	".wmv":  true,
+}
+
+var (
+	yearPattern    = regexp.MustCompile(`^[(\[]?((?:19|20)\d{2})[)\]]?$`)
+	episodePattern = regexp.MustCompile(`(?i)\bs\d{1,2}e\d{1,3}\b`)
+	sampleName     = regexp.MustCompile(`(?i)\bsample\b`)
+)
+
+// sceneTags are tokens that mark the end of the title in scene-style release
+// names that have no year, e.g. "Some.Movie.1080p.BluRay.x264-GROUP".
+var sceneTags = map[string]bool{
+	"480p": true, "576p": true, "720p": true, "1080p": true, "1080i": true, "2160p": true, "4k": true, "uhd": true,
+	"bluray": true, "bdrip": true, "brrip": true, "dvdrip": true, "hdrip": true, "hdtv": true, "remux": true,
+	"web": true, "webrip": true, "web-dl": true, "webdl": true,
+	"x264": true, "x265": true, "h264": true, "h265": true, "hevc": true, "xvid": true, "10bit": true, "hdr": true,
+	"proper": true, "repack": true, "limited": true, "internal": true, "multi": true,
+	"extended": true, "directors": true, "unrated": true, "uncut": true, "remastered": true,
+}
+
+// scanDir walks root and returns a media item for every video file whose
+// title can be parsed from its name.
+func scanDir(root string) ([]mediaItem, error) {
+	var items []mediaItem
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !videoExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		name := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		if sampleName.MatchString(name) || episodePattern.MatchString(name) {
+			return nil
+		}
+
+		title, year := parseReleaseName(name)
+		if title == "" {
+			// Files named like "1080p.mkv" inside a well-named folder.
+			title, year = parseReleaseName(filepath.Base(filepath.Dir(path)))
+		}
+		if title == "" {
+			return nil
+		}
+
+		items = append(items, mediaItem{
+			Section: root,
+			Type:    "movie",
+			Title:   title,
+			Year:    year,
+			Edition: detectEdition(info.Name()),
+			AddedAt: info.ModTime(),
+			Files:   []string{path},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walking %s", root)
+	}
+
+	return items, nil
+}
+
+// parseReleaseName extracts a title and year from a file or folder name such
+// as "The Matrix (1999)" or "The.Matrix.1999.1080p.BluRay.x264-GROUP". The year
+// is 0 when the name doesn't contain one.
+func parseReleaseName(name string) (string, int) {
+	if !strings.Contains(name, " ") {
+		name = strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	}
+	tokens := strings.Fields(name)
+
+	// The last year-like token wins so that "2001 A Space Odyssey 1968" keeps
+	// its leading number as part of the title.
+	end, year := len(tokens), 0
+	for i := len(tokens) - 1; i > 0; i-- {
+		if m := yearPattern.FindStringSubmatch(tokens[i]); m != nil {
+			year, _ = strconv.Atoi(m[1])
+			end = i
+			break
+		}
+	}
+	if year == 0 {
+		for i, token := range tokens {
+			if sceneTags[strings.ToLower(strings.Split(token, "-")[0])] || sceneTags[strings.ToLower(token)] {
+				end = i
+				break
+			}
+		}
+	}
+
+	title := strings.Join(tokens[:end], " ")
+	title = strings.Trim(title, " -([")
+	return title, year
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		year  int
+	}{
+		{"The Matrix (1999)", "The Matrix", 1999},
+		{"The.Matrix.1999.1080p.BluRay.x264-GROUP", "The Matrix", 1999},
+		{"Alien [1979]", "Alien", 1979},
+		{"Heat - 1995", "Heat", 1995},
+		{"Up.2009.mkv", "Up", 2009},
+		// The last year wins, so numbers in the title stay part of it.
+		{"2001 A Space Odyssey 1968", "2001 A Space Odyssey", 1968},
+		{"2001.A.Space.Odyssey.1968.720p", "2001 A Space Odyssey", 1968},
+		{"Blade_Runner_2049_2017_2160p", "Blade Runner 2049", 2017},
+		// Without a year, scene tags end the title.
+		{"Amelie.1080p.BluRay.x264-GRP", "Amelie", 0},
+		{"Heat", "Heat", 0},
+	}
+	for _, test := range tests {
+		title, year := parseReleaseName(test.name)
+		if title != test.title || year != test.year {
+			t.Errorf("parseReleaseName(%q) = %q, %d, want %q, %d", test.name, title, year, test.title, test.year)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// schedule says when the next scan in serve mode is due.
+type schedule interface {
+	next(after time.Time) time.Time
+}
+
+// parseSchedule parses an interval accepted by parseAge, like "24h" or "7d",
+// or a cron expression.
+func parseSchedule(s string) (schedule, error) {
+	if d, err := parseAge(s); err == nil {
+		if d <= 0 {
+			return nil, errors.Errorf("invalid interval %q", s)
+		}
+		return intervalSchedule(d), nil
+	}
+	return parseCron(s)
+}
+
+type intervalSchedule time.Duration
+
+func (i intervalSchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// cronSchedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week (0 or 7 is Sunday). Each field is *, a number, a
+// range like 1-5 or a list like 1,15, optionally with a step like */6. As in
+// cron, when both days are restricted a day matching either one is due.
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+func parseCron(s string) (*cronSchedule, error) {
+	if alias, ok := cronAliases[s]; ok {
+		s = alias
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid schedule %q, use an interval like 24h or a cron expression like \"0 3 * * *\"", s)
+	}
+	c := &cronSchedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	for i, f := range []struct {
+		set      *map[int]bool
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}} {
+		set, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing schedule %q", s)
+		}
+		*f.set = set
+	}
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	if c.next(time.Now()).IsZero() {
+		return nil, errors.Errorf("schedule %q never comes round", s)
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, errors.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, errors.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, errors.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// next returns the first matching minute after the given time, or the zero
+// time when there's none in the next five years, e.g. for February 30th.
+func (c *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) day(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
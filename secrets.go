@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Shopify/ejson"
+	"github.com/pkg/errors"
+)
+
+// secretNames are the secrets plex2netflix reads. Each can also be set as an
+// environment variable, which takes precedence over the secrets file.
+var secretNames = []string{
+	"PLEX_TOKEN", "RAPID_API_KEY", "TMDB_API_KEY", "TAUTULLI_API_KEY",
+	"TRAKT_CLIENT_ID", "TRAKT_CLIENT_SECRET", "SIMKL_CLIENT_ID",
+	"RADARR_API_KEY", "SONARR_API_KEY", "SMTP_PASSWORD", "WEBHOOK_SECRET", "HTTP_PASSWORD",
+}
+
+// secretsFiles are tried in order when no secrets file is given, and the
+// first one that exists is read.
+var secretsFiles = []string{"secrets.json", "secrets.env"}
+
+// defaultEJSONKeyDir is where ejson keeps its private keys unless EJSON_KEYDIR
+// says otherwise.
+const defaultEJSONKeyDir = "/opt/ejson/keys"
+
+// getSecrets reads the secrets file at path, or the first of secretsFiles
+// when path is empty, decrypting ejson files with the keys in keyDir.
+func getSecrets(path, keyDir string) (map[string]string, error) {
+	secrets := map[string]string{}
+	paths := secretsFiles
+	if path != "" {
+		paths = []string{path}
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); os.IsNotExist(err) && path == "" {
+			continue
+		}
+		var err error
+		if secrets, err = readSecretsFile(p, keyDir); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	for _, name := range secretNames {
+		if value := os.Getenv(name); value != "" {
+			secrets[name] = value
+		}
+	}
+	// Nothing is secret when using the mock provider on a directory, so it's
+	// fine to end up with none.
+	return secrets, nil
+}
+
+// envOr returns the environment variable, or fallback when it's unset.
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// readSecretsFile reads secrets from an ejson file, a sops-encrypted JSON
+// file, a plain JSON file or a KEY=value env file.
+func readSecretsFile(path, keyDir string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	if strings.HasSuffix(path, ".env") {
+		return parseEnvFile(raw), nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", path)
+	}
+	switch {
+	case fields["_public_key"] != nil:
+		if raw, err = ejson.DecryptFile(path, keyDir, ""); err != nil {
+			return nil, errors.Wrapf(err, "decrypting %s with ejson", path)
+		}
+	case fields["sops"] != nil:
+		if raw, err = exec.Command("sops", "--decrypt", path).Output(); err != nil {
+			return nil, errors.Wrapf(err, "decrypting %s with sops", path)
+		}
+	}
+
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling secrets")
+	}
+	// Only strings are secrets; sops keeps its metadata alongside them.
+	secrets := map[string]string{}
+	for key, value := range fields {
+		if s, ok := value.(string); ok {
+			secrets[key] = s
+		}
+	}
+	return secrets, nil
+}
+
+// parseEnvFile reads KEY=value lines, ignoring blank lines and comments.
+func parseEnvFile(raw []byte) map[string]string {
+	secrets := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		secrets[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+	}
+	return secrets
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrudio/go-plex-client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// serveConfig configures serve mode.
+type serveConfig struct {
+	// Interval is how often serve scans: a duration like "24h" or "7d", or a
+	// cron expression like "0 3 * * *" for 3am every day. It defaults to 24h.
+	Interval string `json:"interval"`
+	// Listen is the address the dashboard, REST API and Plex webhooks are
+	// served on, e.g. ":8080", so new titles are checked as they're added.
+	// Point a Plex webhook at http://<host>:8080/webhook?token=<WEBHOOK_SECRET>.
+	// Nothing is listened on when it's empty.
+	Listen string `json:"listen"`
+}
+
+// server keeps running in serve mode, scanning on a schedule. Results are
+// saved after every scan as usual, but only the titles that arrived on
+// Netflix since the last scan are reported and acted on.
+type server struct {
+	logger   *logrus.Logger
+	cfg      *config
+	schedule schedule
+	notifier *notifier
+	// scan checks the titles and acts on those found on Netflix that
+	// weren't in previous.
+	scan func(previous []checkResult) []checkResult
+	// apply applies the configured actions to results, for the REST API.
+	apply func(results []checkResult)
+	// checker and the section filters check titles from webhooks.
+	checker          *checker
+	include, exclude map[string]bool
+	// checking is held while a scan or a webhook's check uses the checker,
+	// so webhooks that come in during a scan wait for it to finish.
+	checking sync.Mutex
+
+	mu sync.Mutex
+	// busy is set while a scan or API-triggered actions run.
+	busy bool
+	// scanning is set while tryScan runs a scan.
+	scanning bool
+	results  []checkResult
+}
+
+// run scans on the schedule, and never returns. It scans straight away
+// when there are no results from an earlier run to compare with.
+func (s *server) run() {
+	if s.lastResults() == nil {
+		s.scanOnce()
+	}
+	for {
+		next := s.schedule.next(time.Now())
+		s.logger.WithField("at", s.cfg.dates.dateTime(next)).Info("waiting for the next scan")
+		time.Sleep(time.Until(next))
+		s.scanOnce()
+	}
+}
+
+// scanOnce runs a scan and reports the changes since the last one, unless
+// something else is running.
+func (s *server) scanOnce() {
+	if !s.start() {
+		s.logger.Info("skipping scan, the last one is still running")
+		return
+	}
+	s.runScan()
+}
+
+// start marks the server busy, unless it already is.
+func (s *server) start() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy {
+		return false
+	}
+	s.busy = true
+	return true
+}
+
+func (s *server) done() {
+	s.mu.Lock()
+	s.busy = false
+	s.mu.Unlock()
+}
+
+// lastResults returns the results of the last scan.
+func (s *server) lastResults() []checkResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results
+}
+
+// runScan scans after start and reports the changes since the last scan.
+func (s *server) runScan() {
+	defer s.done()
+	previous := s.lastResults()
+	results, ok := s.tryScan(previous)
+	if !ok {
+		return
+	}
+	arrived := arrivedOnNetflix(previous, results)
+	if previous != nil {
+		for _, result := range arrived {
+			s.notifier.notify(
+				"on_netflix",
+				fmt.Sprintf("%s (%d) is on Netflix now.", result.Item.Title, result.Item.Year),
+				map[string]interface{}{"title": result.Item.Title, "year": result.Item.Year, "library": result.Item.Section, "countries": strings.Join(result.Countries, ",")},
+			)
+		}
+	}
+	s.logger.WithField("found", countFound(results)).
+		WithField("new", len(arrived)).
+		WithField("left", len(leftNetflix(previous, results))).
+		Info("finished scan")
+	s.mu.Lock()
+	s.results = results
+	s.mu.Unlock()
+}
+
+// listen serves the dashboard and REST API on addr, checked by auth, and
+// takes Plex webhooks, verified by verifier, in the background.
+func (s *server) listen(addr string, verifier *webhookVerifier, auth *authenticator) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "listening on %s", addr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", verifier.wrap(http.HandlerFunc(s.handleWebhook)))
+	s.routes(mux, auth)
+	s.logger.WithField("address", listener.Addr()).Info("serving the dashboard, REST API and Plex webhooks")
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			s.logger.WithField("error", err).Error("serving webhooks")
+		}
+	}()
+	return nil
+}
+
+// routes adds the dashboard and REST API to mux, each route behind auth with
+// the scope it needs:
+//
+//	GET  /             the last scan's results as an HTML report (read)
+//	GET  /api/results  the last scan's results as JSON, as exported (read)
+//	POST /api/scan     start a scan (scan)
+//	POST /api/actions  apply the configured actions to the last results (actions)
+func (s *server) routes(mux *http.ServeMux, auth *authenticator) {
+	mux.Handle("/", auth.wrap(scopeRead, http.HandlerFunc(s.handleDashboard)))
+	mux.Handle("/api/results", auth.wrap(scopeRead, http.HandlerFunc(s.handleResults)))
+	mux.Handle("/api/scan", auth.wrap(scopeScan, http.HandlerFunc(s.handleScan)))
+	mux.Handle("/api/actions", auth.wrap(scopeActions, http.HandlerFunc(s.handleActions)))
+}
+
+func (s *server) records() []exportRecord {
+	results := s.lastResults()
+	records := make([]exportRecord, 0, len(results))
+	for _, result := range results {
+		records = append(records, newExportRecord(result))
+	}
+	return records
+}
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := writeHTMLReport(w, s.records(), s.cfg.dates); err != nil {
+		s.logger.WithField("error", err).Warn("writing dashboard")
+	}
+}
+
+func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeExport(w, "json", s.records(), s.cfg.dates); err != nil {
+		s.logger.WithField("error", err).Warn("writing results")
+	}
+}
+
+func (s *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.start() {
+		http.Error(w, "a scan or actions are already running", http.StatusConflict)
+		return
+	}
+	s.logger.WithField("remote", r.RemoteAddr).Info("starting scan from the REST API")
+	go s.runScan()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *server) handleActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	results := s.lastResults()
+	if results == nil {
+		http.Error(w, "no results to act on yet", http.StatusConflict)
+		return
+	}
+	if !s.start() {
+		http.Error(w, "a scan or actions are already running", http.StatusConflict)
+		return
+	}
+	s.logger.WithField("remote", r.RemoteAddr).Info("applying actions from the REST API")
+	go func() {
+		defer s.done()
+		s.apply(results)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleWebhook checks titles added to Plex, from its library.new
+// webhooks, and notifies about those that are on Netflix already.
+func (s *server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Plex posts the payload as a multipart form field, next to a
+	// thumbnail. Other clients can post it as the body.
+	var payload string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		payload = r.FormValue("payload")
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "reading payload", http.StatusBadRequest)
+			return
+		}
+		payload = string(body)
+	}
+	var hook plexWebhook
+	if err := json.Unmarshal([]byte(payload), &hook); err != nil {
+		s.logger.WithField("error", err).Warn("unmarshaling webhook")
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	if hook.Event != "library.new" {
+		s.logger.WithField("event", hook.Event).Debug("ignoring webhook")
+		return
+	}
+	item, episodes, ok := hook.item()
+	if !ok {
+		s.logger.WithField("type", hook.Metadata.Type).Debug("ignoring new item that isn't a movie or show")
+		return
+	}
+	dir := plex.Directory{Title: item.Section, Key: strconv.Itoa(hook.Metadata.LibrarySectionID)}
+	if (len(s.include) > 0 && !sectionIn(s.include, dir)) || sectionIn(s.exclude, dir) {
+		s.logger.WithField("title", item.Title).WithField("section", item.Section).Debug("ignoring new item in a skipped section")
+		return
+	}
+	if label := s.cfg.Plex.ExcludeLabel; label != "" && hook.Metadata.hasLabel(label) {
+		s.logger.WithField("title", item.Title).WithField("label", label).Info("skipping new item with the exclude label")
+		return
+	}
+	go s.checkAdded(item, episodes)
+}
+
+// checkAdded checks a title that was just added to Plex, after any scan
+// that's running. New seasons and episodes are only checked when their show
+// hasn't been before.
+func (s *server) checkAdded(item mediaItem, episodes bool) {
+	s.checking.Lock()
+	defer s.checking.Unlock()
+	c := s.checker
+	if episodes && c.history.has(item, s.cfg.countriesFor(item.Section)) {
+		s.logger.WithField("title", item.Title).Debug("skipping new episodes of a show that's been checked")
+		return
+	}
+	if c.keep.has(item) {
+		s.logger.WithField("title", item.Title).Info("skipping new item on the keep list")
+		return
+	}
+	result := c.lookup(item, s.cfg.countriesFor(item.Section))
+	if err := c.history.save(); err != nil {
+		s.logger.WithField("error", err).Error("saving history")
+	}
+	if !result.Found {
+		s.logger.WithField("title", item.Title).WithField("year", item.Year).WithField("section", item.Section).Info("checked new item, not on netflix")
+		return
+	}
+	s.notifier.notify(
+		"added_on_netflix",
+		fmt.Sprintf("%s (%d) was just added to Plex, but it's on Netflix already.", item.Title, item.Year),
+		map[string]interface{}{"title": item.Title, "year": item.Year, "library": item.Section, "countries": strings.Join(result.Countries, ",")},
+	)
+}
+
+// scanFailed is what a fatal log panics with during a scan in serve mode.
+type scanFailed struct{}
+
+// catchFatal makes fatal logs panic with scanFailed while a scan runs, for
+// tryScan to recover from, and exit as usual otherwise. The logger is shared
+// with every goroutine serve starts, so this has to be done before any of
+// them are.
+func (s *server) catchFatal() {
+	exit := s.logger.ExitFunc
+	if exit == nil {
+		exit = os.Exit
+	}
+	s.logger.ExitFunc = func(code int) {
+		s.mu.Lock()
+		scanning := s.scanning
+		s.mu.Unlock()
+		if scanning {
+			panic(scanFailed{})
+		}
+		exit(code)
+	}
+}
+
+// tryScan runs a scan, turning a fatal error in it, e.g. from Plex being
+// down, into a failed scan so that serve carries on to the next one. It
+// needs catchFatal.
+func (s *server) tryScan(previous []checkResult) (results []checkResult, ok bool) {
+	s.checking.Lock()
+	defer s.checking.Unlock()
+	s.mu.Lock()
+	s.scanning = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.scanning = false
+		s.mu.Unlock()
+		if r := recover(); r != nil {
+			if _, failed := r.(scanFailed); !failed {
+				panic(r)
+			}
+			s.logger.Error("scan failed, trying again at the next one")
+			ok = false
+		}
+	}()
+	return s.scan(previous), true
+}
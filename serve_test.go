@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTryScanCatchesFatal(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	exited := 0
+	logger.ExitFunc = func(code int) { exited = code }
+
+	s := &server{logger: logger}
+	s.scan = func([]checkResult) []checkResult {
+		logger.Fatal("plex is down")
+		return nil
+	}
+	s.catchFatal()
+
+	if _, ok := s.tryScan(nil); ok {
+		t.Error("a scan that logged a fatal error succeeded")
+	}
+	if exited != 0 {
+		t.Errorf("a fatal error in a scan exited with %d", exited)
+	}
+
+	// Outside scans, fatal errors exit as usual.
+	logger.Fatal("listening")
+	if exited != 1 {
+		t.Errorf("a fatal error outside a scan exited with %d, want 1", exited)
+	}
+
+	s.scan = func([]checkResult) []checkResult { return []checkResult{{}} }
+	if results, ok := s.tryScan(nil); !ok || len(results) != 1 {
+		t.Errorf("scan returned %d results, ok %v, want 1 result", len(results), ok)
+	}
+}
+
+// recordingProvider finds every title and records the order it's asked in.
+type recordingProvider struct {
+	mu     sync.Mutex
+	titles []string
+}
+
+func (p *recordingProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.titles = append(p.titles, item.Title)
+	return netflixMatch{Found: true, Countries: countries, Score: 1}, nil
+}
+
+func TestWebhookChecksWaitForScans(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	history, err := loadHistory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &recordingProvider{}
+	cfg := &config{Countries: []string{"us"}, Services: []string{"netflix"}}
+	chk := &checker{logger: logger, provider: provider, cfg: cfg, history: history}
+
+	scanning, release := make(chan bool), make(chan bool)
+	s := &server{logger: logger, cfg: cfg, checker: chk, notifier: &notifier{logger: logger}}
+	s.scan = func([]checkResult) []checkResult {
+		scanning <- true
+		<-release
+		return []checkResult{chk.lookup(mediaItem{Title: "Roma", Year: 2018}, cfg.Countries)}
+	}
+	s.catchFatal()
+
+	scanned := make(chan bool)
+	go func() {
+		s.tryScan(nil)
+		scanned <- true
+	}()
+	<-scanning
+	checked := make(chan bool)
+	go func() {
+		s.checkAdded(mediaItem{Title: "Okja", Year: 2017}, false)
+		checked <- true
+	}()
+	select {
+	case <-checked:
+		t.Fatal("a webhook was checked during a scan")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-scanned
+	<-checked
+	if got := strings.Join(provider.titles, ","); got != "Roma,Okja" {
+		t.Errorf("checked %s, want the scan's Roma before the webhook's Okja", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+)
+
+// streamingService is a subscription service that can be checked with
+// -services, with the names providers know it by.
+type streamingService struct {
+	// tmdb are TMDB's watch provider IDs for the service.
+	tmdb []int
+	// justwatch are JustWatch's package technical names.
+	justwatch []string
+	// streamingAvailability are the Streaming Availability API's service IDs.
+	streamingAvailability []string
+}
+
+// streamingServices are keyed by the names used in -services and policies.
+var streamingServices = map[string]streamingService{
+	"netflix": {tmdb: []int{8, 1796}, justwatch: []string{"netflix", "netflixbasicwithads"}, streamingAvailability: []string{"netflix"}},
+	"prime":   {tmdb: []int{9, 119}, justwatch: []string{"amazonprime", "amazonprimevideo"}, streamingAvailability: []string{"prime"}},
+	"disney+": {tmdb: []int{337}, justwatch: []string{"disneyplus"}, streamingAvailability: []string{"disney"}},
+	"hulu":    {tmdb: []int{15}, justwatch: []string{"hulu"}, streamingAvailability: []string{"hulu"}},
+	"max":     {tmdb: []int{1899, 384}, justwatch: []string{"max", "hbomax"}, streamingAvailability: []string{"hbo", "max"}},
+}
+
+// serviceAliases are other names people use for the services.
+var serviceAliases = map[string]string{
+	"amazon":             "prime",
+	"amazon prime":       "prime",
+	"prime video":        "prime",
+	"amazon prime video": "prime",
+	"disney":             "disney+",
+	"disneyplus":         "disney+",
+	"disney plus":        "disney+",
+	"hbo":                "max",
+	"hbo max":            "max",
+	"hbomax":             "max",
+}
+
+// serviceName returns the canonical name of a service, or "" if it's unknown.
+func serviceName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := serviceAliases[name]; ok {
+		return alias
+	}
+	if _, ok := streamingServices[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// serviceProvider is implemented by providers that know about services other
+// than Netflix. Only netflixMatch.NetflixID is specific to Netflix, and it's
+// empty for other services.
+type serviceProvider interface {
+	findOnService(item mediaItem, countries []string, service string, ex *explanation) (netflixMatch, error)
+}
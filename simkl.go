@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const simklAPI = "https://api.simkl.com"
+
+var simklLists = map[string]bool{"plantowatch": true, "watching": true, "completed": true, "hold": true, "dropped": true}
+
+type simklClient struct {
+	clientID    string
+	tokenFile   string
+	accessToken string
+}
+
+type simklPin struct {
+	Result          string `json:"result"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	AccessToken     string `json:"access_token"`
+}
+
+type simklItems struct {
+	Movies []struct {
+		Movie simklMedia `json:"movie"`
+	} `json:"movies"`
+	Shows []struct {
+		Show simklMedia `json:"show"`
+	} `json:"shows"`
+}
+
+type simklMedia struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		IMDb string      `json:"imdb"`
+		TMDB json.Number `json:"tmdb"`
+	} `json:"ids"`
+}
+
+// authorize loads a saved token or runs Simkl's PIN flow to get one. Simkl
+// tokens don't expire.
+func (c *simklClient) authorize(logger *logrus.Logger) error {
+	bytes, err := ioutil.ReadFile(c.tokenFile)
+	if err == nil {
+		c.accessToken = string(bytes)
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading %s", c.tokenFile)
+	}
+
+	var pin simklPin
+	if err := c.get("/oauth/pin?client_id="+url.QueryEscape(c.clientID), &pin); err != nil {
+		return errors.Wrap(err, "requesting Simkl PIN")
+	}
+	logger.WithField("url", pin.VerificationURL).WithField("code", pin.UserCode).Info("authorize plex2netflix on Simkl")
+
+	deadline := time.Now().Add(time.Duration(pin.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Duration(pin.Interval) * time.Second)
+		var status simklPin
+		if err := c.get("/oauth/pin/"+pin.UserCode+"?client_id="+url.QueryEscape(c.clientID), &status); err != nil {
+			return errors.Wrap(err, "polling for Simkl token")
+		}
+		if status.Result == "OK" && status.AccessToken != "" {
+			c.accessToken = status.AccessToken
+			return errors.Wrapf(ioutil.WriteFile(c.tokenFile, []byte(c.accessToken), 0600), "writing %s", c.tokenFile)
+		}
+	}
+	return errors.New("timed out waiting for Simkl authorization")
+}
+
+// list returns the movies and shows in one of the user's Simkl lists, e.g.
+// "plantowatch".
+func (c *simklClient) list(name string) ([]mediaItem, error) {
+	if !simklLists[name] {
+		return nil, errors.Errorf("unknown Simkl list %q", name)
+	}
+
+	var result simklItems
+	if err := c.get("/sync/all-items/all/"+name, &result); err != nil {
+		return nil, errors.Wrapf(err, "getting Simkl %s list", name)
+	}
+
+	items := make([]mediaItem, 0, len(result.Movies)+len(result.Shows))
+	add := func(kind string, m simklMedia) {
+		items = append(items, mediaItem{
+			Section: "Simkl " + name,
+			Type:    kind,
+			IMDbID:  m.IDs.IMDb,
+			TMDBID:  m.IDs.TMDB.String(),
+			Title:   m.Title,
+			Year:    m.Year,
+		})
+	}
+	for _, m := range result.Movies {
+		add("movie", m.Movie)
+	}
+	for _, s := range result.Shows {
+		add("show", s.Show)
+	}
+	return items, nil
+}
+
+func (c *simklClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", simklAPI+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("simkl-api-key", c.clientID)
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Simkl returned %s", resp.Status)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding Simkl response")
+}
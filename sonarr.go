@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// actionSonarrUnmonitor is the Sonarr cleanup action, as used in policies.
+const actionSonarrUnmonitor = "sonarr-unmonitor"
+
+type sonarrSeries struct {
+	arrMedia
+	Seasons []struct {
+		SeasonNumber int  `json:"seasonNumber"`
+		Monitored    bool `json:"monitored"`
+	} `json:"seasons"`
+}
+
+// unmonitorSeasons unmonitors the seasons of shows found on Netflix in
+// Sonarr. With mode "all", a series is unmonitored, with all its seasons,
+// only once Netflix has every season Sonarr knows of; with "any", each
+// season Netflix has is unmonitored on its own. Specials are left alone.
+// Shows the provider didn't list seasons for are skipped.
+func (c *arrClient) unmonitorSeasons(logger *logrus.Logger, cfg *config, activity *activityLog, results []checkResult, mode string, dryRun bool) {
+	var library []sonarrSeries
+	if err := c.get("/api/v3/series", &library); err != nil {
+		logger.WithField("error", err).Error("getting Sonarr series")
+		return
+	}
+	media := make([]arrMedia, len(library))
+	for i, s := range library {
+		media[i] = s.arrMedia
+	}
+
+	for _, result := range allowedResults(logger, cfg, actionSonarrUnmonitor, results) {
+		item := result.Item
+		entry := logger.WithField("title", item.Title)
+		if item.Type != "show" {
+			continue
+		}
+		if result.NetflixSeasons == nil {
+			entry.Debug("no Netflix seasons known, not unmonitoring in Sonarr")
+			continue
+		}
+		m, ok := findArrMedia(media, item)
+		if !ok {
+			entry.Debug("not in Sonarr")
+			continue
+		}
+		var series sonarrSeries
+		for _, s := range library {
+			if s.ID == m.ID {
+				series = s
+			}
+		}
+
+		var seasons []int
+		complete := true
+		for _, season := range series.Seasons {
+			if season.SeasonNumber == 0 {
+				continue
+			}
+			if !containsInt(result.NetflixSeasons, season.SeasonNumber) {
+				complete = false
+				continue
+			}
+			if season.Monitored {
+				seasons = append(seasons, season.SeasonNumber)
+			}
+		}
+		unmonitorSeries := mode == "all" && series.Monitored
+		if mode == "all" && !complete {
+			entry.Debug("netflix doesn't have every season, not unmonitoring in Sonarr")
+			continue
+		}
+		if len(seasons) == 0 && !unmonitorSeries {
+			continue
+		}
+
+		entry = entry.WithField("seasons", joinInts(seasons))
+		if dryRun {
+			entry.Info("would unmonitor in Sonarr (dry run)")
+			continue
+		}
+		if err := c.unmonitor(series.ID, seasons, unmonitorSeries); err != nil {
+			entry.WithField("error", err).Error("unmonitoring in Sonarr")
+			continue
+		}
+		entry.Info("unmonitored in Sonarr")
+		activity.recordAction(actionSonarrUnmonitor, item)
+	}
+}
+
+// unmonitor turns off monitoring of some of a series' seasons, and of the
+// series itself when whole is set. Sonarr only takes whole series, so the
+// series is read and written back with the changes.
+func (c *arrClient) unmonitor(id int, seasons []int, whole bool) error {
+	path := "/api/v3/series/" + strconv.Itoa(id)
+	var series map[string]interface{}
+	if err := c.get(path, &series); err != nil {
+		return errors.Wrap(err, "getting series")
+	}
+	if whole {
+		series["monitored"] = false
+	}
+	list, _ := series["seasons"].([]interface{})
+	for _, s := range list {
+		season, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if number, ok := season["seasonNumber"].(float64); ok && containsInt(seasons, int(number)) {
+			season["monitored"] = false
+		}
+	}
+	return errors.Wrap(c.send("PUT", path, series, nil), "updating series")
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
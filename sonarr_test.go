@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sonarrTestSeries is a series with specials and four seasons, all
+// monitored.
+func sonarrTestSeries() map[string]interface{} {
+	var seasons []interface{}
+	for number := 0; number <= 4; number++ {
+		seasons = append(seasons, map[string]interface{}{"seasonNumber": number, "monitored": true})
+	}
+	return map[string]interface{}{"id": 7, "title": "Stranger Things", "year": 2016, "tvdbId": 305288, "monitored": true, "seasons": seasons}
+}
+
+// monitoredSeasons returns the season numbers monitored in a series Sonarr
+// was sent.
+func monitoredSeasons(series map[string]interface{}) []int {
+	var monitored []int
+	seasons, _ := series["seasons"].([]interface{})
+	for _, s := range seasons {
+		season := s.(map[string]interface{})
+		if season["monitored"] == true {
+			monitored = append(monitored, int(season["seasonNumber"].(float64)))
+		}
+	}
+	return monitored
+}
+
+func TestSonarrUnmonitorSeasons(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	show := mediaItem{Title: "Stranger Things", Year: 2016, Type: "show", TVDBID: "305288"}
+	tests := []struct {
+		name           string
+		mode           string
+		netflixSeasons []int
+		// want is nil when the series isn't changed.
+		want            []int
+		seriesMonitored bool
+		dryRun          bool
+	}{
+		{name: "all seasons on netflix", mode: "all", netflixSeasons: []int{1, 2, 3, 4}, want: []int{0}},
+		{name: "some seasons with all", mode: "all", netflixSeasons: []int{1, 2}},
+		{name: "some seasons with any", mode: "any", netflixSeasons: []int{1, 2}, want: []int{0, 3, 4}, seriesMonitored: true},
+		{name: "dry run", mode: "any", netflixSeasons: []int{1, 2}, dryRun: true},
+		{name: "seasons unknown", mode: "any"},
+	}
+	for _, test := range tests {
+		sonarr, client := newFakeArr(t, "Sonarr", map[string]interface{}{
+			"/api/v3/series":   []interface{}{sonarrTestSeries()},
+			"/api/v3/series/7": sonarrTestSeries(),
+		})
+		results := []checkResult{{Item: show, Found: true, Confidence: 1, NetflixSeasons: test.netflixSeasons}}
+		client.unmonitorSeasons(logger, &config{}, nil, results, test.mode, test.dryRun)
+
+		if test.want == nil {
+			if len(sonarr.changes) != 0 {
+				t.Errorf("%s: changed %v", test.name, sonarr.changes)
+			}
+			continue
+		}
+		if len(sonarr.changes) != 1 || sonarr.changes[0].method != "PUT" || sonarr.changes[0].path != "/api/v3/series/7" {
+			t.Errorf("%s: changed %v, want the series updated", test.name, sonarr.changes)
+			continue
+		}
+		series := sonarr.changes[0].body
+		if got := monitoredSeasons(series); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: seasons %v left monitored, want %v", test.name, got, test.want)
+		}
+		if series["monitored"] != test.seriesMonitored {
+			t.Errorf("%s: series monitored %v, want %v", test.name, series["monitored"], test.seriesMonitored)
+		}
+		// The rest of the series is written back as it was.
+		if series["title"] != "Stranger Things" || series["tvdbId"] != 305288.0 {
+			t.Errorf("%s: series written back as %v", test.name, series)
+		}
+	}
+}
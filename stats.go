@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+)
+
+type overlap struct {
+	total int
+	found int
+}
+
+// showStats implements the stats subcommand. It summarises how much of the
+// library is on Netflix from the last saved results, without any lookups.
+func showStats(logger *logrus.Logger, cfg *config, stateDir string) {
+	saved, err := loadLastResults(stateDir)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading results, run a scan first")
+	}
+
+	groups := []struct {
+		name string
+		keys func(mediaItem) []string
+	}{
+		{"Library", func(m mediaItem) []string { return []string{m.Section} }},
+		{"Genre", func(m mediaItem) []string { return m.Genres }},
+		{"Decade", func(m mediaItem) []string {
+			if m.Year == 0 {
+				return []string{"unknown"}
+			}
+			return []string{fmt.Sprintf("%ds", m.Year/10*10)}
+		}},
+		{"Resolution", func(m mediaItem) []string {
+			if m.Resolution == "" {
+				return []string{"unknown"}
+			}
+			return []string{m.Resolution}
+		}},
+	}
+
+	fmt.Printf("Results from %s\n", cfg.dates.dateTime(saved.Time))
+	if saved.Partial {
+		fmt.Println("The run was interrupted, so these results are partial.")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, group := range groups {
+		counts := map[string]*overlap{}
+		for _, result := range saved.Results {
+			for _, key := range group.keys(result.Item) {
+				if counts[key] == nil {
+					counts[key] = &overlap{}
+				}
+				counts[key].total++
+				if result.Found {
+					counts[key].found++
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(w, "\n%s\tItems\tOn Netflix\tOverlap\t\n", group.name)
+		for _, key := range keys {
+			c := counts[key]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t\n", key, c.total, c.found, 100*float64(c.found)/float64(c.total))
+		}
+	}
+	w.Flush()
+}
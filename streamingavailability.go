@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const streamingAvailabilityHost = "streaming-availability.p.rapidapi.com"
+
+type streamingAvailabilityShow struct {
+	ID           string `json:"id"`
+	IMDbID       string `json:"imdbId"`
+	Title        string `json:"title"`
+	ShowType     string `json:"showType"`
+	ReleaseYear  int    `json:"releaseYear"`
+	FirstAirYear int    `json:"firstAirYear"`
+	// StreamingOptions are keyed by lowercase country code.
+	StreamingOptions map[string][]struct {
+		Service struct {
+			ID string `json:"id"`
+		} `json:"service"`
+		Type string `json:"type"`
+		Link string `json:"link"`
+		// Quality is the best video quality the option streams in: sd,
+		// hd, qhd or uhd.
+		Quality string `json:"quality"`
+	} `json:"streamingOptions"`
+}
+
+func (s streamingAvailabilityShow) year() int {
+	if s.ReleaseYear != 0 {
+		return s.ReleaseYear
+	}
+	return s.FirstAirYear
+}
+
+// streamingAvailabilityProvider looks titles up with the Streaming
+// Availability API on RapidAPI, by IMDb or TMDB ID when Plex has one and by
+// exact title and year otherwise, like the uNoGS provider.
+type streamingAvailabilityProvider struct {
+	logger *logrus.Logger
+	apiKey string
+	// limiter is shared with every other provider using the key.
+	limiter *rateLimiter
+	cache   *lookupCache
+	calls   int64
+	// matcher scores search results against items.
+	matcher titleMatcher
+}
+
+func (p *streamingAvailabilityProvider) requests() int {
+	return int(atomic.LoadInt64(&p.calls))
+}
+
+func (p *streamingAvailabilityProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	return p.findOnService(item, countries, "netflix", ex)
+}
+
+func (p *streamingAvailabilityProvider) findOnService(item mediaItem, countries []string, service string, ex *explanation) (netflixMatch, error) {
+	ex.setCleanTitle(item.Title)
+	id, score, err := p.showID(item, countries[0], ex)
+	if err != nil {
+		return netflixMatch{}, errors.Wrap(err, "searching Streaming Availability")
+	}
+	if id == "" {
+		ex.decide("no candidate matched the title with a score of at least %.2f", p.matcher.minConfidence)
+		return netflixMatch{}, nil
+	}
+
+	netflixID, available, err := p.service(id, service, ex)
+	if err != nil {
+		return netflixMatch{}, errors.Wrap(err, "getting Streaming Availability show")
+	}
+	ex.setCountries(available)
+	m := netflixMatch{Found: containsAny(available, countries), NetflixID: netflixID, Countries: available, Score: score}
+	if m.Found {
+		ex.decide("on %s in %s", service, strings.Join(countries, " or "))
+	} else {
+		ex.decide("not on %s in %s", service, strings.Join(countries, " or "))
+	}
+	return m, nil
+}
+
+// showID returns the Streaming Availability ID of an item, its IMDb or TMDB
+// ID when Plex has one, and how well it matched, or "" when no show matched.
+func (p *streamingAvailabilityProvider) showID(item mediaItem, country string, ex *explanation) (string, float64, error) {
+	if item.IMDbID != "" {
+		return item.IMDbID, 1, nil
+	}
+	if item.TMDBID != "" {
+		if item.Type == "show" {
+			return "tv/" + item.TMDBID, 1, nil
+		}
+		return "movie/" + item.TMDBID, 1, nil
+	}
+	return p.search(item, country, ex)
+}
+
+// search returns the Streaming Availability ID of the show that best
+// matches the item's title and year, and its score, or "" when none scores
+// at least minConfidence.
+func (p *streamingAvailabilityProvider) search(item mediaItem, country string, ex *explanation) (string, float64, error) {
+	// The cached values are the ID and its score, which depends on the year
+	// tolerance.
+	cacheKey := fmt.Sprintf("sa:search:%s|%d|%d|%s", item.Title, item.Year, p.matcher.yearTolerance, item.Type)
+	if ids, ok := p.cache.get(cacheKey); ok {
+		ex.addQuery("cached " + cacheKey)
+		return cachedMatch(ids, p.matcher.minConfidence)
+	}
+
+	params := url.Values{}
+	params.Set("title", item.Title)
+	params.Set("country", country)
+	switch item.Type {
+	case "movie":
+		params.Set("show_type", "movie")
+	case "show":
+		params.Set("show_type", "series")
+	}
+	var shows []streamingAvailabilityShow
+	if err := p.get("/shows/search/title?"+params.Encode(), ex, &shows); err != nil {
+		return "", 0, err
+	}
+
+	id, best := "", 0.0
+	for _, show := range shows {
+		score := p.matcher.score(item.Title, item.Year, show.Title, show.year())
+		ex.addCandidate(candidate{title: show.Title, year: strconv.Itoa(show.year()), score: score})
+		if score > best {
+			id, best = show.ID, score
+		}
+	}
+	return cacheMatch(p.cache, cacheKey, id, best, p.matcher.minConfidence)
+}
+
+// service returns the countries a show is on a subscription to service in,
+// and its Netflix ID when service is Netflix. One request answers for every
+// service, so each service's answer is cached.
+func (p *streamingAvailabilityProvider) service(id, service string, ex *explanation) (string, []string, error) {
+	// The first cached value is the Netflix ID, the rest are countries.
+	cacheKey := func(service string) string {
+		return "sa:show:" + service + ":" + id
+	}
+	if cached, ok := p.cache.get(cacheKey(service)); ok && len(cached) > 0 {
+		ex.addQuery("cached " + cacheKey(service))
+		return cached[0], cached[1:], nil
+	}
+
+	var show streamingAvailabilityShow
+	err := p.get("/shows/"+id, ex, &show)
+	if errors.Cause(err) == errStreamingAvailabilityNotFound {
+		for name := range streamingServices {
+			p.cache.put(cacheKey(name), []string{""})
+		}
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	p.cacheQuality(id, show)
+	var netflixID string
+	var available []string
+	for name, s := range streamingServices {
+		countries := []string{}
+		titleID := ""
+		for country, options := range show.StreamingOptions {
+			for _, option := range options {
+				if !containsAny(s.streamingAvailability, []string{option.Service.ID}) || option.Type != "subscription" {
+					continue
+				}
+				countries = append(countries, strings.ToLower(country))
+				if m := netflixTitleID.FindStringSubmatch(option.Link); m != nil {
+					titleID = m[1]
+				}
+				break
+			}
+		}
+		p.cache.put(cacheKey(name), append([]string{titleID}, countries...))
+		if name == service {
+			netflixID, available = titleID, countries
+		}
+	}
+	return netflixID, available, nil
+}
+
+// netflixQuality returns the best video quality Netflix streams an item in
+// across countries, which comes with the show's streaming options.
+func (p *streamingAvailabilityProvider) netflixQuality(item mediaItem, countries []string) (string, error) {
+	id, _, err := p.showID(item, countries[0], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "searching Streaming Availability")
+	}
+	if id == "" {
+		return "", nil
+	}
+	// The cached values are country=quality pairs.
+	qualities, ok := p.cache.get("sa:quality:" + id)
+	if !ok {
+		var show streamingAvailabilityShow
+		err := p.get("/shows/"+id, nil, &show)
+		if err != nil && errors.Cause(err) != errStreamingAvailabilityNotFound {
+			return "", errors.Wrap(err, "getting Streaming Availability show")
+		}
+		qualities = p.cacheQuality(id, show)
+	}
+	best := ""
+	for _, pair := range qualities {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 && containsAny(countries, parts[:1]) && qualityRank(parts[1]) > qualityRank(best) {
+			best = parts[1]
+		}
+	}
+	return best, nil
+}
+
+// cacheQuality caches the best video quality a show is on Netflix in, by
+// country, and returns it as country=quality pairs. QHD counts as HD, as it
+// isn't UHD.
+func (p *streamingAvailabilityProvider) cacheQuality(id string, show streamingAvailabilityShow) []string {
+	qualities := []string{}
+	for country, options := range show.StreamingOptions {
+		best := ""
+		for _, option := range options {
+			if !containsAny(streamingServices["netflix"].streamingAvailability, []string{option.Service.ID}) || option.Type != "subscription" {
+				continue
+			}
+			quality := option.Quality
+			if quality == "qhd" {
+				quality = "hd"
+			}
+			if qualityRank(quality) > qualityRank(best) {
+				best = quality
+			}
+		}
+		if best != "" {
+			qualities = append(qualities, strings.ToLower(country)+"="+best)
+		}
+	}
+	sort.Strings(qualities)
+	p.cache.put("sa:quality:"+id, qualities)
+	return qualities
+}
+
+// errStreamingAvailabilityNotFound is returned for IDs the API doesn't know.
+var errStreamingAvailabilityNotFound = errors.New("not found")
+
+func (p *streamingAvailabilityProvider) get(path string, ex *explanation, v interface{}) error {
+	query := "https://" + streamingAvailabilityHost + path
+	ex.addQuery(query)
+	if err := p.limiter.wait(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", query, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("X-RapidAPI-Key", p.apiKey)
+	req.Header.Set("X-RapidAPI-Host", streamingAvailabilityHost)
+	atomic.AddInt64(&p.calls, 1)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling Streaming Availability")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errStreamingAvailabilityNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Streaming Availability returned %s", resp.Status)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding Streaming Availability response")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redirectTransport sends every request to a test server instead of the
+// host it's for.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakeStreamingAvailability serves shows by path and returns a provider
+// that calls it.
+func newFakeStreamingAvailability(t *testing.T, shows map[string]interface{}) *streamingAvailabilityProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show, ok := shows[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(show)
+	}))
+	target, _ := url.Parse(server.URL)
+	client := httpClient
+	httpClient = &http.Client{Transport: redirectTransport{target}}
+	t.Cleanup(func() {
+		httpClient = client
+		server.Close()
+	})
+	return &streamingAvailabilityProvider{apiKey: "key", limiter: newRateLimiter(0, 1, 0), matcher: titleMatcher{minConfidence: 0.8}}
+}
+
+func TestStreamingAvailabilityQuality(t *testing.T) {
+	option := func(service, kind, quality string) map[string]interface{} {
+		return map[string]interface{}{"service": map[string]string{"id": service}, "type": kind, "quality": quality, "link": "https://www.netflix.com/title/80240715/"}
+	}
+	p := newFakeStreamingAvailability(t, map[string]interface{}{
+		"/shows/tt6155374": map[string]interface{}{
+			"id": "1", "title": "Roma", "showType": "movie", "releaseYear": 2018,
+			"streamingOptions": map[string]interface{}{
+				"us": []interface{}{option("netflix", "subscription", "hd"), option("prime", "subscription", "uhd")},
+				"gb": []interface{}{option("netflix", "subscription", "uhd")},
+				"de": []interface{}{option("netflix", "subscription", "qhd")},
+				"fr": []interface{}{option("netflix", "rent", "uhd")},
+			},
+		},
+	})
+	roma := mediaItem{Title: "Roma", Year: 2018, Type: "movie", IMDbID: "tt6155374"}
+	tests := []struct {
+		countries []string
+		want      string
+	}{
+		{[]string{"us"}, "hd"},
+		{[]string{"us", "gb"}, "uhd"},
+		{[]string{"de"}, "hd"},
+		// Only a rental is on Netflix in fr.
+		{[]string{"fr"}, ""},
+	}
+	for _, test := range tests {
+		got, err := p.netflixQuality(roma, test.countries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("quality in %v = %q, want %q", test.countries, got, test.want)
+		}
+	}
+
+	got, err := p.netflixQuality(mediaItem{Title: "Okja", Year: 2017, IMDbID: "tt3967856"}, []string{"us"})
+	if err != nil || got != "" {
+		t.Errorf("quality of a show the API doesn't know = %q, %v, want none", got, err)
+	}
+}
+
+func TestStreamingAvailabilityQualityVerdict(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	p := newFakeStreamingAvailability(t, map[string]interface{}{
+		"/shows/tt6155374": map[string]interface{}{
+			"id": "1", "title": "Roma", "showType": "movie", "releaseYear": 2018,
+			"streamingOptions": map[string]interface{}{
+				"us": []interface{}{map[string]interface{}{"service": map[string]string{"id": "netflix"}, "type": "subscription", "quality": "hd"}},
+			},
+		},
+	})
+	c := &checker{logger: logger, provider: p}
+	tests := []struct {
+		resolution string
+		want       string
+	}{
+		{"4k", "keep local, better quality"},
+		{"1080", "netflix is equal or better"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		result := checkResult{Item: mediaItem{Section: "Movies", Title: "Roma", Year: 2018, IMDbID: "tt6155374", Resolution: test.resolution}, Found: true, Countries: []string{"us"}}
+		c.checkQuality(&result, []string{"us"})
+		if got := newExportRecord(result).Verdict; got != test.want {
+			t.Errorf("verdict for a %q copy = %q, want %q", test.resolution, got, test.want)
+		}
+	}
+}
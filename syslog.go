@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log/syslog"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// syslogHook sends every log entry to the local syslog daemon at the
+// matching priority.
+type syslogHook struct {
+	writer    *syslog.Writer
+	formatter logrus.Formatter
+}
+
+func newSyslogHook() (*syslogHook, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "plex2netflix")
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to syslog")
+	}
+	return &syslogHook{writer: w, formatter: &logrus.TextFormatter{DisableTimestamp: true, DisableColors: true}}, nil
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	bytes, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := string(bytes)
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return h.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return h.writer.Err(line)
+	case logrus.WarnLevel:
+		return h.writer.Warning(line)
+	case logrus.InfoLevel:
+		return h.writer.Info(line)
+	default:
+		return h.writer.Debug(line)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type syslogHook struct{}
+
+func newSyslogHook() (*syslogHook, error) {
+	return nil, errors.New("syslog isn't available on this platform")
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return nil
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	return nil
+}
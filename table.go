@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ANSI colors for the results table. They're all the same length, so
+// colored rows still line up.
+const (
+	colorGreen = "\033[32m"
+	colorGrey  = "\033[90m"
+	colorRed   = "\033[31m"
+	colorReset = "\033[0m"
+)
+
+// useTable reports whether results should be shown as a table, which they
+// are when stdout is a terminal that isn't getting the -output report.
+func useTable(opts options) bool {
+	if opts.output != "" && opts.out == "-" {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// printResultsTable writes the results as a table per library, titles on
+// Netflix in green, titles not found in grey and failures in red when color
+// is set, with leaving dates written by dates.
+func printResultsTable(out io.Writer, results []checkResult, dates dateFormatter, color bool) {
+	bySection := map[string][]checkResult{}
+	var sections []string
+	for _, result := range results {
+		section := result.Item.Section
+		if _, ok := bySection[section]; !ok {
+			sections = append(sections, section)
+		}
+		bySection[section] = append(bySection[section], result)
+	}
+	sort.Strings(sections)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, section := range sections {
+		rows := bySection[section]
+		sort.SliceStable(rows, func(i, j int) bool {
+			return strings.ToLower(rows[i].Item.Title) < strings.ToLower(rows[j].Item.Title)
+		})
+		fmt.Fprintf(w, "\n%s (%d on Netflix of %d)\n", section, countFound(rows), len(rows))
+		for _, result := range rows {
+			status, where, rowColor := "not found", "", colorGrey
+			switch {
+			case result.Error != "":
+				status, where, rowColor = "error", result.Error, colorRed
+			case result.Found:
+				status, where, rowColor = "on netflix", strings.Join(result.Countries, ","), colorGreen
+				if len(result.Services) > 0 {
+					where = strings.Join(result.Services, ",") + " " + where
+				}
+				if result.NetflixQuality != "" {
+					where += " in " + strings.ToUpper(result.NetflixQuality)
+				}
+				if !result.Leaving.IsZero() {
+					where += ", leaving " + dates.date(result.Leaving)
+				}
+				if result.QualityVerdict == qualityLocal {
+					where += ", " + qualityVerdictText(result.QualityVerdict)
+				}
+			}
+			year := ""
+			if result.Item.Year != 0 {
+				year = fmt.Sprint(result.Item.Year)
+			}
+			start, end := "", ""
+			if color {
+				start, end = rowColor, colorReset
+			}
+			fmt.Fprintf(w, "%s  %s\t%s\t%s\t%s%s\n", start, result.Item.Title, year, status, where, end)
+		}
+	}
+	w.Flush()
+}
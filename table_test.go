@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultsTableLeavingDate(t *testing.T) {
+	dates, err := newDateFormatter("UTC", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	results := []checkResult{{
+		Item:      mediaItem{Section: "Movies", Title: "Roma", Year: 2018},
+		Found:     true,
+		Countries: []string{"us"},
+		Leaving:   time.Date(2026, 11, 30, 0, 0, 0, 0, time.UTC),
+	}}
+	printResultsTable(&b, results, dates, false)
+	if want := "leaving 30.11.2026"; !strings.Contains(b.String(), want) {
+		t.Errorf("the table doesn't say %q:\n%s", want, b.String())
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type tautulliClient struct {
+	baseURL string
+	apiKey  string
+}
+
+type tautulliResponse struct {
+	Response struct {
+		Result  string          `json:"result"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	} `json:"response"`
+}
+
+type tautulliMediaInfo struct {
+	Data []tautulliMediaItem `json:"data"`
+}
+
+type tautulliMediaItem struct {
+	RatingKey  json.Number `json:"rating_key"`
+	LastPlayed json.Number `json:"last_played"`
+	PlayCount  json.Number `json:"play_count"`
+}
+
+type watchHistory struct {
+	playCount   int
+	lastWatched time.Time
+}
+
+// libraryWatchHistory returns the play count and last watched date of every
+// item in a library section, keyed by rating key. Tautulli aggregates these
+// across all users of the server.
+func (c *tautulliClient) libraryWatchHistory(sectionID string) (map[string]watchHistory, error) {
+	params := url.Values{}
+	params.Set("section_id", sectionID)
+	params.Set("length", "100000")
+	var info tautulliMediaInfo
+	if err := c.call("get_library_media_info", params, &info); err != nil {
+		return nil, err
+	}
+
+	history := make(map[string]watchHistory, len(info.Data))
+	for _, item := range info.Data {
+		var h watchHistory
+		if n, err := item.PlayCount.Int64(); err == nil {
+			h.playCount = int(n)
+		}
+		if ts, err := item.LastPlayed.Int64(); err == nil && ts > 0 {
+			h.lastWatched = time.Unix(ts, 0)
+		}
+		history[item.RatingKey.String()] = h
+	}
+
+	return history, nil
+}
+
+type tautulliUser struct {
+	UserID     json.Number `json:"user_id"`
+	Username   string      `json:"username"`
+	IsAdmin    json.Number `json:"is_admin"`
+	IsHomeUser json.Number `json:"is_home_user"`
+	IsActive   json.Number `json:"is_active"`
+}
+
+// householdUsers returns the IDs of the users whose views count for the
+// household: the listed usernames, or by default the server owner and every
+// active Plex Home or managed user. Friends the server is shared with aren't
+// part of the household.
+func (c *tautulliClient) householdUsers(usernames []string) (map[string]bool, error) {
+	var users []tautulliUser
+	if err := c.call("get_users", url.Values{}, &users); err != nil {
+		return nil, err
+	}
+
+	listed := map[string]bool{}
+	for _, name := range usernames {
+		listed[strings.ToLower(name)] = true
+	}
+	household := map[string]bool{}
+	for _, u := range users {
+		if len(listed) > 0 {
+			if listed[strings.ToLower(u.Username)] {
+				household[u.UserID.String()] = true
+			}
+			continue
+		}
+		if u.IsActive.String() != "0" && (u.IsAdmin.String() == "1" || u.IsHomeUser.String() == "1") {
+			household[u.UserID.String()] = true
+		}
+	}
+	if len(household) == 0 {
+		return nil, errors.New("no Tautulli users match the household")
+	}
+	return household, nil
+}
+
+type tautulliHistory struct {
+	Data []struct {
+		UserID               interface{} `json:"user_id"`
+		RatingKey            interface{} `json:"rating_key"`
+		GrandparentRatingKey interface{} `json:"grandparent_rating_key"`
+		Date                 interface{} `json:"date"`
+	} `json:"data"`
+}
+
+// userWatchHistory returns when each user last watched each item of a
+// library section, keyed by rating key and then user ID. Episodes count as
+// watching their show.
+func (c *tautulliClient) userWatchHistory(sectionID string) (map[string]map[string]time.Time, error) {
+	params := url.Values{}
+	params.Set("section_id", sectionID)
+	params.Set("length", "1000000")
+	var history tautulliHistory
+	if err := c.call("get_history", params, &history); err != nil {
+		return nil, err
+	}
+
+	watched := map[string]map[string]time.Time{}
+	for _, play := range history.Data {
+		key := tautulliString(play.GrandparentRatingKey)
+		if key == "" {
+			key = tautulliString(play.RatingKey)
+		}
+		ts, err := strconv.ParseInt(tautulliString(play.Date), 10, 64)
+		if key == "" || err != nil {
+			continue
+		}
+		user := tautulliString(play.UserID)
+		if watched[key] == nil {
+			watched[key] = map[string]time.Time{}
+		}
+		if t := time.Unix(ts, 0); t.After(watched[key][user]) {
+			watched[key][user] = t
+		}
+	}
+	return watched, nil
+}
+
+// tautulliString formats a value Tautulli may send as a number, a string or
+// an empty string.
+func tautulliString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// watchedByEveryone changes each item's last watched date to when the last
+// household member to see it watched it, or to never if someone hasn't.
+func watchedByEveryone(history map[string]watchHistory, perUser map[string]map[string]time.Time, household map[string]bool) map[string]watchHistory {
+	for key, h := range history {
+		var last time.Time
+		for user := range household {
+			t, ok := perUser[key][user]
+			if !ok {
+				last = time.Time{}
+				break
+			}
+			if last.IsZero() || t.Before(last) {
+				last = t
+			}
+		}
+		h.lastWatched = last
+		history[key] = h
+	}
+	return history
+}
+
+func (c *tautulliClient) call(cmd string, params url.Values, v interface{}) error {
+	params.Set("apikey", c.apiKey)
+	params.Set("cmd", cmd)
+	resp, err := httpClient.Get(fmt.Sprintf("%s/api/v2?%s", strings.TrimSuffix(c.baseURL, "/"), params.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "calling Tautulli")
+	}
+	defer resp.Body.Close()
+
+	var tr tautulliResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return errors.Wrap(err, "decoding Tautulli response")
+	}
+	if tr.Response.Result != "success" {
+		return errors.Errorf("Tautulli returned %q: %s", tr.Response.Result, tr.Response.Message)
+	}
+	return errors.Wrapf(json.Unmarshal(tr.Response.Data, v), "unmarshaling Tautulli %s", cmd)
+}
+
+// applyWatchHistory copies watch history onto items and, when unwatchedFor is
+// set, drops the items somebody watched more recently than that.
+func applyWatchHistory(logger *logrus.Logger, cfg *config, items []mediaItem, history map[string]watchHistory, unwatchedFor time.Duration) []mediaItem {
+	cutoff := time.Now().Add(-unwatchedFor)
+	kept := items[:0]
+	for _, item := range items {
+		h := history[item.RatingKey]
+		item.PlayCount = h.playCount
+		item.LastWatched = h.lastWatched
+		if unwatchedFor > 0 && h.lastWatched.After(cutoff) {
+			logger.WithField("title", item.Title).WithField("last_watched", cfg.dates.date(h.lastWatched)).Debug("skipping recently watched item")
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+type tmdbWatchProviders struct {
+	// Results are keyed by uppercase country code.
+	Results map[string]struct {
+		Flatrate []struct {
+			ProviderID int `json:"provider_id"`
+		} `json:"flatrate"`
+	} `json:"results"`
+}
+
+// tmdbProvider looks up Netflix availability with TMDB's free watch provider
+// data, keyed by the TMDB ID Plex already has. TMDB doesn't know Netflix's
+// own IDs, so matches never have one.
+type tmdbProvider struct {
+	client *tmdbClient
+	cache  *lookupCache
+	// matcher scores search results against items.
+	matcher titleMatcher
+}
+
+func (p *tmdbProvider) requests() int {
+	return int(atomic.LoadInt64(&p.client.calls))
+}
+
+func (p *tmdbProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	return p.findOnService(item, countries, "netflix", ex)
+}
+
+func (p *tmdbProvider) findOnService(item mediaItem, countries []string, service string, ex *explanation) (netflixMatch, error) {
+	ex.setCleanTitle(item.Title)
+	kind := "movie"
+	if item.Type == "show" {
+		kind = "tv"
+	}
+	id, score, err := p.tmdbID(item, kind, ex)
+	if err != nil {
+		return netflixMatch{}, errors.Wrap(err, "finding TMDB ID")
+	}
+	if id == "" {
+		ex.decide("no TMDB title matched the IMDb ID, or the title with a score of at least %.2f", p.matcher.minConfidence)
+		return netflixMatch{}, nil
+	}
+
+	available, err := p.serviceCountries(kind, id, service, ex)
+	if err != nil {
+		return netflixMatch{}, errors.Wrap(err, "getting TMDB watch providers")
+	}
+	ex.setCountries(available)
+	m := netflixMatch{Found: containsAny(available, countries), Countries: available, Score: score}
+	if m.Found {
+		ex.decide("TMDB %s %s is on %s in %s", kind, id, service, strings.Join(countries, " or "))
+	} else {
+		ex.decide("TMDB %s %s isn't on %s in %s", kind, id, service, strings.Join(countries, " or "))
+	}
+	return m, nil
+}
+
+// tmdbID returns the item's TMDB ID and how sure the match is: the ID Plex
+// has, the one TMDB has for its IMDb ID, or that of the search result that
+// best matches its title and year.
+func (p *tmdbProvider) tmdbID(item mediaItem, kind string, ex *explanation) (string, float64, error) {
+	if item.TMDBID != "" {
+		return item.TMDBID, 1, nil
+	}
+	cacheKey := fmt.Sprintf("tmdb:search:%s|%d|%d|%s|%s", item.Title, item.Year, p.matcher.yearTolerance, item.IMDbID, kind)
+	if ids, ok := p.cache.get(cacheKey); ok {
+		ex.addQuery("cached " + cacheKey)
+		return cachedMatch(ids, p.matcher.minConfidence)
+	}
+
+	type tmdbTitle struct {
+		ID           int    `json:"id"`
+		Title        string `json:"title"`
+		Name         string `json:"name"`
+		ReleaseDate  string `json:"release_date"`
+		FirstAirDate string `json:"first_air_date"`
+	}
+	var candidates []tmdbTitle
+	if item.IMDbID != "" {
+		params := url.Values{}
+		params.Set("external_source", "imdb_id")
+		ex.addQuery("tmdb find " + item.IMDbID)
+		var found struct {
+			Movies []tmdbTitle `json:"movie_results"`
+			Shows  []tmdbTitle `json:"tv_results"`
+		}
+		if err := p.client.get("/find/"+item.IMDbID, params, &found); err != nil {
+			return "", 0, err
+		}
+		candidates = found.Movies
+		if kind == "tv" {
+			candidates = found.Shows
+		}
+	}
+
+	id, best := "", 0.0
+	if len(candidates) > 0 {
+		id, best = strconv.Itoa(candidates[0].ID), 1
+	} else {
+		params := url.Values{}
+		params.Set("query", item.Title)
+		ex.addQuery(fmt.Sprintf("tmdb search %s %q", kind, item.Title))
+		var search struct {
+			Results []tmdbTitle `json:"results"`
+		}
+		if err := p.client.get("/search/"+kind, params, &search); err != nil {
+			return "", 0, err
+		}
+		for _, t := range search.Results {
+			title, date := t.Title, t.ReleaseDate
+			if kind == "tv" {
+				title, date = t.Name, t.FirstAirDate
+			}
+			year := 0
+			if len(date) >= 4 {
+				year, _ = strconv.Atoi(date[:4])
+			}
+			score := p.matcher.score(item.Title, item.Year, title, year)
+			ex.addCandidate(candidate{title: title, year: strconv.Itoa(year), score: score})
+			if score > best {
+				id, best = strconv.Itoa(t.ID), score
+			}
+		}
+	}
+	return cacheMatch(p.cache, cacheKey, id, best, p.matcher.minConfidence)
+}
+
+// serviceCountries returns the countries a TMDB title is on a subscription
+// to service in. The watch providers cover every service, so they're cached
+// for each one.
+func (p *tmdbProvider) serviceCountries(kind, id, service string, ex *explanation) ([]string, error) {
+	cacheKey := func(service string) string {
+		return "tmdb:providers:" + service + ":" + kind + "/" + id
+	}
+	if available, ok := p.cache.get(cacheKey(service)); ok {
+		ex.addQuery("cached " + cacheKey(service))
+		return available, nil
+	}
+
+	path := "/" + kind + "/" + id + "/watch/providers"
+	ex.addQuery("tmdb " + path)
+	var providers tmdbWatchProviders
+	if err := p.client.get(path, url.Values{}, &providers); err != nil {
+		return nil, err
+	}
+	byService := map[string][]string{}
+	for name, s := range streamingServices {
+		available := []string{}
+		for country, offers := range providers.Results {
+			for _, offer := range offers.Flatrate {
+				if containsInt(s.tmdb, offer.ProviderID) {
+					available = append(available, strings.ToLower(country))
+					break
+				}
+			}
+		}
+		byService[name] = available
+		p.cache.put(cacheKey(name), available)
+	}
+	return byService[service], nil
+}
+
+func containsInt(values []int, wanted int) bool {
+	for _, v := range values {
+		if v == wanted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// API token scopes. Each REST API route needs one of these.
+const (
+	scopeRead    = "read"    // read scan results
+	scopeScan    = "scan"    // trigger scans
+	scopeActions = "actions" // apply actions like deleting media
+)
+
+var validScopes = map[string]bool{scopeRead: true, scopeScan: true, scopeActions: true}
+
+type apiToken struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+func (t apiToken) hasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenStore keeps API tokens in a JSON file. Only a hash of each token is
+// stored; the token itself is shown once, when it's created.
+type tokenStore struct {
+	mu     sync.Mutex
+	path   string
+	tokens []apiToken
+}
+
+func loadTokenStore(path string) (*tokenStore, error) {
+	s := &tokenStore{path: path}
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	if err := json.Unmarshal(bytes, &s.tokens); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s", path)
+	}
+	return s, nil
+}
+
+// create issues a new token with the given scopes and returns it.
+func (s *tokenStore) create(name string, scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return "", errors.New("a token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", errors.Errorf("unknown scope %q, expected read, scan or actions", scope)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.Name == name {
+			return "", errors.Errorf("a token named %q already exists", name)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "generating token")
+	}
+	token := "p2n_" + hex.EncodeToString(secret)
+	s.tokens = append(s.tokens, apiToken{Name: name, Hash: hashToken(token), Scopes: scopes, Created: time.Now()})
+	return token, s.save()
+}
+
+func (s *tokenStore) revoke(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tokens {
+		if t.Name == name {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return s.save()
+		}
+	}
+	return errors.Errorf("no token named %q", name)
+}
+
+func (s *tokenStore) list() []apiToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := append([]apiToken(nil), s.tokens...)
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens
+}
+
+// lookup returns the stored token matching a presented token.
+func (s *tokenStore) lookup(token string) (apiToken, bool) {
+	hash := hashToken(token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t, true
+		}
+	}
+	return apiToken{}, false
+}
+
+func (s *tokenStore) save() error {
+	bytes, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling tokens")
+	}
+	return errors.Wrapf(ioutil.WriteFile(s.path, bytes, 0600), "writing %s", s.path)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// manageTokens implements the token subcommand:
+//
+//	token create <name> <scope>...
+//	token list
+//	token revoke <name>
+func manageTokens(logger *logrus.Logger, path string, args []string) {
+	store, err := loadTokenStore(path)
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading API tokens")
+	}
+
+	switch {
+	case len(args) >= 3 && args[0] == "create":
+		token, err := store.create(args[1], args[2:])
+		if err != nil {
+			logger.WithField("error", err).Fatal("creating API token")
+		}
+		fmt.Println(token)
+	case len(args) == 1 && args[0] == "list":
+		for _, t := range store.list() {
+			fmt.Printf("%s\t%s\t%s\n", t.Name, strings.Join(t.Scopes, ","), t.Created.Format("2006-01-02"))
+		}
+	case len(args) == 2 && args[0] == "revoke":
+		if err := store.revoke(args[1]); err != nil {
+			logger.WithField("error", err).Fatal("revoking API token")
+		}
+	default:
+		logger.Fatal("usage: plex2netflix token create <name> read|scan|actions... | token list | token revoke <name>")
+	}
+}
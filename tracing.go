@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type tracingConfig struct {
+	// Endpoint is the base URL of an OpenTelemetry collector's OTLP/HTTP
+	// receiver, e.g. "http://localhost:4318". It defaults to
+	// OTEL_EXPORTER_OTLP_ENDPOINT, and tracing is off when neither is set.
+	Endpoint string `json:"endpoint"`
+	// ServiceName defaults to "plex2netflix".
+	ServiceName string `json:"service_name"`
+}
+
+// tracer records spans for a scan and exports them to an OTLP/HTTP collector
+// as JSON. Unless a parent is given, a new span's parent is the innermost span
+// that's still open; with concurrent lookups, a request's span may end up
+// under another item's lookup that's in flight at the same time. All methods are no-ops on a nil tracer,
+// and on the nil spans it returns, so callers don't need to check whether
+// tracing is on.
+type tracer struct {
+	endpoint string
+	service  string
+	client   *http.Client
+
+	mu      sync.Mutex
+	traceID string
+	open    []*span
+	done    []otlpSpan
+}
+
+type span struct {
+	tracer   *tracer
+	traceID  string
+	id       string
+	parentID string
+	name     string
+	start    time.Time
+	attrs    []otlpAttribute
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	// Code is 1 for OK and 2 for an error.
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTLP span kinds.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+func newTracer(cfg tracingConfig, envEndpoint string) *tracer {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = envEndpoint
+	}
+	if endpoint == "" {
+		return nil
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = "plex2netflix"
+	}
+	// The exporter doesn't use httpClient so that its own requests aren't
+	// traced.
+	return &tracer{endpoint: strings.TrimSuffix(endpoint, "/"), service: service, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start opens a span as a child of the innermost open span. Spans opened
+// with no span open start a new trace.
+func (t *tracer) start(name string) *span {
+	return t.startChild(nil, name)
+}
+
+// startChild opens a span as a child of parent, for spans opened in
+// parallel, like concurrent lookups. With a nil parent it's the same as
+// start.
+func (t *tracer) startChild(parent *span, name string) *span {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &span{tracer: t, id: randomID(8), name: name, start: time.Now()}
+	if parent == nil && len(t.open) > 0 {
+		parent = t.open[len(t.open)-1]
+	}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.id
+	} else {
+		s.traceID = randomID(16)
+	}
+	t.open = append(t.open, s)
+	return s
+}
+
+func (s *span) setString(key, value string) *span {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}})
+	}
+	return s
+}
+
+func (s *span) setInt(key string, value int) *span {
+	if s != nil {
+		v := strconv.Itoa(value)
+		s.attrs = append(s.attrs, otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}})
+	}
+	return s
+}
+
+// end closes the span, marking it as failed when err isn't nil.
+func (s *span) end(err error) {
+	s.finish(spanKindInternal, err)
+}
+
+func (s *span) finish(kind int, err error) {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, open := range t.open {
+		if open == s {
+			t.open = append(t.open[:i], t.open[i+1:]...)
+			break
+		}
+	}
+	status := otlpStatus{Code: 1}
+	if err != nil {
+		status = otlpStatus{Code: 2, Message: err.Error()}
+	}
+	t.done = append(t.done, otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.id,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        s.attrs,
+		Status:            status,
+	})
+}
+
+// flush exports the finished spans to the collector.
+func (t *tracer) flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.done
+	t.done = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	service := t.service
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &service}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "plex2netflix", "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "marshaling spans")
+	}
+	resp, err := t.client.Post(t.endpoint+"/v1/traces", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "exporting spans")
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("exporting spans: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// tracingTransport records a client span for every outbound request, such as
+// each provider call, under the span that's open when it's made.
+type tracingTransport struct {
+	tracer *tracer
+	next   http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.tracer.start(req.Method + " " + req.URL.Host)
+	s.setString("http.method", req.Method).setString("http.url", sanitizeURL(req.URL))
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		s.setInt("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			s.finish(spanKindClient, errors.New(resp.Status))
+			return resp, err
+		}
+	}
+	s.finish(spanKindClient, err)
+	return resp, err
+}
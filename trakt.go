@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const traktAPI = "https://api.trakt.tv"
+
+type traktClient struct {
+	clientID     string
+	clientSecret string
+	tokenFile    string
+	token        traktToken
+}
+
+type traktToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+func (t traktToken) expired() bool {
+	return time.Now().Unix() >= t.CreatedAt+t.ExpiresIn
+}
+
+type traktDeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type traktListEntry struct {
+	Movie *traktMedia `json:"movie"`
+	Show  *traktMedia `json:"show"`
+}
+
+type traktMedia struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		IMDb string `json:"imdb"`
+		TMDB int    `json:"tmdb"`
+	} `json:"ids"`
+}
+
+// authorize loads a saved token, refreshing it when it has expired, or runs
+// the OAuth device flow when there is no saved token yet.
+func (c *traktClient) authorize(logger *logrus.Logger) error {
+	bytes, err := ioutil.ReadFile(c.tokenFile)
+	if err == nil {
+		if err := json.Unmarshal(bytes, &c.token); err != nil {
+			return errors.Wrapf(err, "unmarshaling %s", c.tokenFile)
+		}
+		if !c.token.expired() {
+			return nil
+		}
+		err = c.post("/oauth/token", map[string]string{
+			"refresh_token": c.token.RefreshToken,
+			"client_id":     c.clientID,
+			"client_secret": c.clientSecret,
+			"redirect_uri":  "urn:ietf:wg:oauth:2.0:oob",
+			"grant_type":    "refresh_token",
+		}, &c.token)
+		if err != nil {
+			return errors.Wrap(err, "refreshing Trakt token")
+		}
+		return c.saveToken()
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading %s", c.tokenFile)
+	}
+
+	var code traktDeviceCode
+	if err := c.post("/oauth/device/code", map[string]string{"client_id": c.clientID}, &code); err != nil {
+		return errors.Wrap(err, "requesting Trakt device code")
+	}
+	logger.WithField("url", code.VerificationURL).WithField("code", code.UserCode).Info("authorize plex2netflix on Trakt")
+
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Duration(code.Interval) * time.Second)
+		err := c.post("/oauth/device/token", map[string]string{
+			"code":          code.DeviceCode,
+			"client_id":     c.clientID,
+			"client_secret": c.clientSecret,
+		}, &c.token)
+		if err == nil {
+			return c.saveToken()
+		}
+		if status, ok := errors.Cause(err).(traktStatusError); !ok || (status != http.StatusBadRequest && status != http.StatusTooManyRequests) {
+			return errors.Wrap(err, "polling for Trakt token")
+		}
+	}
+	return errors.New("timed out waiting for Trakt authorization")
+}
+
+func (c *traktClient) saveToken() error {
+	bytes, err := json.Marshal(c.token)
+	if err != nil {
+		return errors.Wrap(err, "marshaling Trakt token")
+	}
+	return errors.Wrapf(ioutil.WriteFile(c.tokenFile, bytes, 0600), "writing %s", c.tokenFile)
+}
+
+// list returns the movies and shows on the user's watchlist or collection.
+func (c *traktClient) list(name string) ([]mediaItem, error) {
+	if name != "watchlist" && name != "collection" {
+		return nil, errors.Errorf("unknown Trakt list %q", name)
+	}
+
+	var items []mediaItem
+	for _, kind := range []string{"movies", "shows"} {
+		var entries []traktListEntry
+		if err := c.get("/sync/"+name+"/"+kind, &entries); err != nil {
+			return nil, errors.Wrapf(err, "getting Trakt %s %s", name, kind)
+		}
+		for _, entry := range entries {
+			media, kind := entry.Movie, "movie"
+			if media == nil {
+				media, kind = entry.Show, "show"
+			}
+			if media == nil {
+				continue
+			}
+			item := mediaItem{Section: "Trakt " + name, Type: kind, IMDbID: media.IDs.IMDb, Title: media.Title, Year: media.Year}
+			if media.IDs.TMDB != 0 {
+				item.TMDBID = strconv.Itoa(media.IDs.TMDB)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+type traktStatusError int
+
+func (e traktStatusError) Error() string {
+	return "Trakt returned " + http.StatusText(int(e))
+}
+
+func (c *traktClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", traktAPI+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token.AccessToken)
+	return c.do(req, v)
+}
+
+func (c *traktClient) post(path string, body interface{}, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "marshaling request")
+	}
+	req, err := http.NewRequest("POST", traktAPI+path, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	return c.do(req, v)
+}
+
+func (c *traktClient) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("trakt-api-version", "2")
+	req.Header.Set("trakt-api-key", c.clientID)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return traktStatusError(resp.StatusCode)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding Trakt response")
+}
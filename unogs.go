@@ -0,0 +1,551 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type unogsResponse struct {
+	Count string              `json:"COUNT"`
+	Items []map[string]string `json:"ITEMS"`
+}
+
+type netflixLookup struct {
+	Result netflixLookupResult `json:"RESULT"`
+}
+
+type netflixLookupResult struct {
+	Country []netflixCountry `json:"country"`
+}
+
+type netflixCountry struct {
+	Code string `json:"ccode"`
+	// Expires is the last day the title streams in the country, as
+	// 2006-01-02, when it's leaving.
+	Expires string `json:"expires"`
+	// Audio and Subtitle are comma-separated language names, e.g.
+	// "English,Japanese".
+	Audio    string `json:"audio"`
+	Subtitle string `json:"subtitle"`
+}
+
+// netflixVideo is what loadvideo says about a Netflix ID besides the
+// countries it's in, keyed by country.
+type netflixVideo struct {
+	expires          map[string]time.Time
+	audio, subtitles map[string][]string
+	accessibility    map[string]accessibility
+}
+
+type netflixEpisodes struct {
+	Result []struct {
+		Season   json.Number       `json:"season"`
+		Episodes []json.RawMessage `json:"episodes"`
+	} `json:"RESULT"`
+}
+
+// unogsProvider looks titles up with the uNoGS API on RapidAPI.
+type unogsProvider struct {
+	logger  *logrus.Logger
+	baseURL string
+	// apiKeys are used in turn, moving on to the next one when a key's
+	// quota runs out.
+	apiKeys []string
+	mu      sync.Mutex
+	current int
+	// limiters has each key's rate limiter, shared with every other
+	// provider using the key.
+	limiters *limiterPool
+
+	// cache remembers the Netflix IDs found for each cleaned title and year,
+	// and the countries each ID is available in. A title checked for several
+	// libraries with different countries costs one search, and one loadvideo
+	// call covers every country.
+	cache *lookupCache
+	// calls counts the requests made, for the activity log.
+	calls int64
+	// matcher scores search results against items.
+	matcher titleMatcher
+	// videos holds the expiry dates and languages loadvideo returned this
+	// run, keyed by Netflix ID, so they don't cost another call when caching
+	// is off.
+	videos map[string]netflixVideo
+}
+
+func (p *unogsProvider) requests() int {
+	return int(atomic.LoadInt64(&p.calls))
+}
+
+func (p *unogsProvider) findOnNetflix(item mediaItem, countries []string, ex *explanation) (netflixMatch, error) {
+	// An IMDb ID matches regardless of punctuation or localized titles, so
+	// the title is only searched for without one, or when it didn't match.
+	var netflixID string
+	var err error
+	score := 1.0
+	if item.IMDbID != "" {
+		netflixID, err = p.findNetflixIDByIMDb(item.IMDbID, videoType(item.Type), ex)
+		if err != nil {
+			return netflixMatch{}, errors.Wrap(err, "finding Netflix ID by IMDb ID")
+		}
+	}
+	if netflixID == "" {
+		netflixID, score, err = p.findNetflixID(item.Title, item.Year, videoType(item.Type), ex)
+		if err != nil {
+			return netflixMatch{}, errors.Wrap(err, "finding Netflix ID")
+		}
+	}
+
+	if netflixID == "" {
+		ex.decide("no candidate matched the IMDb ID, or the title with a score of at least %.2f", p.matcher.minConfidence)
+		return netflixMatch{}, nil
+	}
+
+	available, err := p.countries(netflixID, ex)
+	if err != nil {
+		return netflixMatch{}, err
+	}
+	ex.setCountries(available)
+	m := netflixMatch{Found: containsAny(available, countries), NetflixID: netflixID, Countries: available, Score: score}
+	if m.Found {
+		ex.decide("netflix ID %s is available in %s", netflixID, strings.Join(countries, " or "))
+	} else {
+		ex.decide("netflix ID %s isn't available in %s", netflixID, strings.Join(countries, " or "))
+	}
+	return m, nil
+}
+
+// videoType returns the uNoGS video type to search for an item type, so
+// movies and shows in mixed libraries don't match each other.
+func videoType(itemType string) string {
+	switch itemType {
+	case "movie":
+		return "Movie"
+	case "show":
+		return "Series"
+	default:
+		return "Any"
+	}
+}
+
+// findNetflixIDByIMDb searches uNoGS for an IMDb ID, which its search
+// matches as well as titles, and takes the result carrying that IMDb ID.
+func (p *unogsProvider) findNetflixIDByIMDb(imdbID, vtype string, ex *explanation) (string, error) {
+	cacheKey := fmt.Sprintf("search:imdb:%s|%s", imdbID, vtype)
+	if ids, ok := p.cache.get(cacheKey); ok {
+		ex.addQuery("cached " + cacheKey)
+		if len(ids) == 0 {
+			return "", nil
+		}
+		return ids[0], nil
+	}
+
+	query := fmt.Sprintf(
+		"%s/aaapi.cgi?q=%s-!1900,%d-!0,5-!0,10-!0-!%s-!Any-!Any-!gt0-!{downloadable}&t=ns&cl=all&st=adv&ob=Relevance&p=1&sa=and",
+		p.baseURL,
+		url.QueryEscape(imdbID),
+		time.Now().Year(),
+		vtype,
+	)
+	ex.addQuery(query)
+	bytes, err := p.call(query)
+	if err != nil {
+		return "", err
+	}
+	var result unogsResponse
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return "", errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+	}
+
+	netflixID := ""
+	for _, item := range result.Items {
+		score := 0.0
+		if strings.EqualFold(item["imdbid"], imdbID) {
+			score = 1
+		}
+		ex.addCandidate(candidate{title: item["title"], year: item["released"], netflixID: item["netflixid"], score: score})
+		if score == 1 && netflixID == "" {
+			netflixID = item["netflixid"]
+		}
+	}
+
+	if netflixID == "" {
+		p.cache.put(cacheKey, []string{})
+	} else {
+		p.cache.put(cacheKey, []string{netflixID})
+	}
+	return netflixID, nil
+}
+
+// findNetflixID searches uNoGS for a title and returns the best scoring
+// candidate, if it scores at least minConfidence, with its score.
+func (p *unogsProvider) findNetflixID(title string, year int, vtype string, ex *explanation) (string, float64, error) {
+	r, err := regexp.Compile(`\(\d{4}\)$`)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "compiling regexp")
+	}
+	title = r.ReplaceAllString(title, "")
+	title = strings.Replace(title, "'", "", -1)
+	title = strings.TrimSpace(title)
+	ex.setCleanTitle(title)
+
+	// The cached values are the Netflix ID and its score. The year tolerance
+	// changes both the search and the scores, so it's part of the key.
+	cacheKey := fmt.Sprintf("search:%s|%d|%d|%s", title, year, p.matcher.yearTolerance, vtype)
+	if ids, ok := p.cache.get(cacheKey); ok {
+		ex.addQuery("cached " + cacheKey)
+		return cachedMatch(ids, p.matcher.minConfidence)
+	}
+
+	startYear, endYear := year-p.matcher.yearTolerance, year+p.matcher.yearTolerance
+	if year == 0 {
+		// Titles parsed from filenames don't always carry a year.
+		startYear, endYear = 1900, time.Now().Year()
+	}
+
+	query := fmt.Sprintf(
+		"%s/aaapi.cgi?q=%s-!%d,%d-!0,5-!0,10-!0-!%s-!Any-!Any-!gt100-!{downloadable}&t=ns&cl=all&st=adv&ob=Relevance&p=1&sa=and",
+		p.baseURL,
+		url.QueryEscape(title),
+		startYear,
+		endYear,
+		vtype,
+	)
+	ex.addQuery(query)
+	bytes, err := p.call(query)
+	if err != nil {
+		return "", 0, err
+	}
+	var result unogsResponse
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+	}
+
+	netflixID, best := "", 0.0
+	for _, item := range result.Items {
+		released, _ := strconv.Atoi(item["released"])
+		score := p.matcher.score(title, year, html.UnescapeString(item["title"]), released)
+		ex.addCandidate(candidate{title: item["title"], year: item["released"], netflixID: item["netflixid"], score: score})
+		if score > best {
+			netflixID, best = item["netflixid"], score
+		}
+	}
+
+	return cacheMatch(p.cache, cacheKey, netflixID, best, p.matcher.minConfidence)
+}
+
+func (p *unogsProvider) netflixIDCountries(id string, ex *explanation) ([]string, error) {
+	return p.countries(id, ex)
+}
+
+// countries returns every country the Netflix ID is available in.
+func (p *unogsProvider) countries(id string, ex *explanation) ([]string, error) {
+	cacheKey := "countries:" + id
+	if available, ok := p.cache.get(cacheKey); ok {
+		ex.addQuery("cached " + cacheKey)
+		return available, nil
+	}
+	return p.loadVideo(id, ex)
+}
+
+// loadVideo gets the countries the Netflix ID is available in, the expiry
+// dates of those it's leaving and the languages and accessibility features
+// in each, and caches them.
+func (p *unogsProvider) loadVideo(id string, ex *explanation) ([]string, error) {
+	query := fmt.Sprintf("%s/aaapi.cgi?t=loadvideo&q=%s", p.baseURL, id)
+	ex.addQuery(query)
+	bytes, err := p.call(query)
+	if err != nil {
+		return nil, err
+	}
+	var lookup netflixLookup
+	err = json.Unmarshal(bytes, &lookup)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+	}
+
+	available := make([]string, 0, len(lookup.Result.Country))
+	var expiries, languages []string
+	video := newNetflixVideo()
+	for _, country := range lookup.Result.Country {
+		code := strings.ToLower(country.Code)
+		available = append(available, code)
+		if t, err := time.Parse("2006-01-02", country.Expires); err == nil {
+			video.expires[code] = t
+			expiries = append(expiries, code+"="+country.Expires)
+		}
+		video.audio[code] = languageCodeList(country.Audio)
+		video.subtitles[code] = languageCodeList(country.Subtitle)
+		a := accessibility{AudioDescription: hasAudioDescription(country.Audio), ClosedCaptions: hasClosedCaptions(country.Subtitle)}
+		video.accessibility[code] = a
+		languages = append(languages,
+			code+":audio="+strings.Join(video.audio[code], ","),
+			code+":subtitles="+strings.Join(video.subtitles[code], ","),
+			code+":ad="+strconv.FormatBool(a.AudioDescription),
+			code+":cc="+strconv.FormatBool(a.ClosedCaptions))
+	}
+
+	p.cache.put("countries:"+id, available)
+	p.cache.put("expires:"+id, expiries)
+	p.cache.put("languages:"+id, languages)
+	p.mu.Lock()
+	if p.videos == nil {
+		p.videos = map[string]netflixVideo{}
+	}
+	p.videos[id] = video
+	p.mu.Unlock()
+	return available, nil
+}
+
+func newNetflixVideo() netflixVideo {
+	return netflixVideo{
+		expires:       map[string]time.Time{},
+		audio:         map[string][]string{},
+		subtitles:     map[string][]string{},
+		accessibility: map[string]accessibility{},
+	}
+}
+
+// video returns what loadvideo said about the Netflix ID, from this run, the
+// cache or another call.
+func (p *unogsProvider) video(id string) (netflixVideo, error) {
+	p.mu.Lock()
+	video, ok := p.videos[id]
+	p.mu.Unlock()
+	if ok {
+		return video, nil
+	}
+	expiries, hasExpiries := p.cache.get("expires:" + id)
+	languages, hasLanguages := p.cache.get("languages:" + id)
+	if hasExpiries && hasLanguages {
+		video = newNetflixVideo()
+		for _, entry := range expiries {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if t, err := time.Parse("2006-01-02", parts[1]); err == nil {
+				video.expires[parts[0]] = t
+			}
+		}
+		for _, entry := range languages {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			codes := []string{}
+			if parts[1] != "" {
+				codes = strings.Split(parts[1], ",")
+			}
+			switch country := strings.SplitN(parts[0], ":", 2); {
+			case len(country) != 2:
+			case country[1] == "audio":
+				video.audio[country[0]] = codes
+			case country[1] == "subtitles":
+				video.subtitles[country[0]] = codes
+			case country[1] == "ad":
+				a := video.accessibility[country[0]]
+				a.AudioDescription = parts[1] == "true"
+				video.accessibility[country[0]] = a
+			case country[1] == "cc":
+				a := video.accessibility[country[0]]
+				a.ClosedCaptions = parts[1] == "true"
+				video.accessibility[country[0]] = a
+			}
+		}
+		return video, nil
+	}
+	// Countries cached before expiry dates or languages were don't have
+	// them.
+	if _, err := p.loadVideo(id, nil); err != nil {
+		return netflixVideo{}, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.videos[id], nil
+}
+
+// netflixExpiry returns the last day the Netflix ID streams in each country
+// it's leaving.
+func (p *unogsProvider) netflixExpiry(id string) (map[string]time.Time, error) {
+	video, err := p.video(id)
+	return video.expires, err
+}
+
+// netflixLanguages returns the audio and subtitle languages of the Netflix ID
+// in each country it's in.
+func (p *unogsProvider) netflixLanguages(id string) (audio, subtitles map[string][]string, err error) {
+	video, err := p.video(id)
+	return video.audio, video.subtitles, err
+}
+
+// netflixAccessibility returns whether the Netflix ID has audio description
+// and closed captions in each country it's in.
+func (p *unogsProvider) netflixAccessibility(id string) (map[string]accessibility, error) {
+	video, err := p.video(id)
+	return video.accessibility, err
+}
+
+// netflixSeasons returns the season numbers Netflix has episodes of for a
+// show. uNoGS lists a show's seasons for its whole catalog rather than per
+// country.
+func (p *unogsProvider) netflixSeasons(id string, countries []string) ([]int, error) {
+	cacheKey := "seasons:" + id
+	var numbers []string
+	if cached, ok := p.cache.get(cacheKey); ok {
+		numbers = cached
+	} else {
+		bytes, err := p.call(fmt.Sprintf("%s/aaapi.cgi?t=episodes&q=%s", p.baseURL, id))
+		if err != nil {
+			return nil, err
+		}
+		var episodes netflixEpisodes
+		if err := json.Unmarshal(bytes, &episodes); err != nil {
+			return nil, errors.Wrapf(err, "unmarshaling netflix API response: %v", string(bytes))
+		}
+		numbers = []string{}
+		for _, season := range episodes.Result {
+			if len(season.Episodes) > 0 {
+				numbers = append(numbers, season.Season.String())
+			}
+		}
+		p.cache.put(cacheKey, numbers)
+	}
+
+	seasons := make([]int, 0, len(numbers))
+	for _, n := range numbers {
+		if season, err := strconv.Atoi(n); err == nil {
+			seasons = append(seasons, season)
+		}
+	}
+	return seasons, nil
+}
+
+// unogsRetries is how many times a request is retried after a network
+// error, a 5xx response or being rate limited.
+const unogsRetries = 5
+
+func (p *unogsProvider) call(url string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		key := p.key()
+		if err := p.limiters.limiter(p.apiKeys[key]).wait(); err != nil {
+			if err == errQuotaExhausted && p.nextKey(key) {
+				continue
+			}
+			return nil, err
+		}
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating request")
+		}
+		req.Header.Add("X-RapidAPI-Key", p.apiKeys[key])
+		atomic.AddInt64(&p.calls, 1)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			if attempt < unogsRetries {
+				p.retryAfter(attempt, 0, err.Error())
+				continue
+			}
+			return nil, errors.Wrap(err, "calling uNoGS")
+		}
+
+		bytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			if attempt < unogsRetries {
+				p.retryAfter(attempt, 0, err.Error())
+				continue
+			}
+			return nil, errors.Wrap(err, "reading uNoGS body")
+		}
+
+		exhausted := resp.StatusCode == http.StatusTooManyRequests && strings.Contains(strings.ToLower(string(bytes)), "quota")
+		if exhausted || resp.Header.Get("X-RateLimit-Requests-Remaining") == "0" {
+			if !p.nextKey(key) {
+				if exhausted {
+					return nil, errors.New("every RapidAPI key is out of quota")
+				}
+				return bytes, nil
+			}
+			if exhausted {
+				continue
+			}
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return bytes, nil
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < unogsRetries:
+			p.retryAfter(attempt, parseRetryAfter(resp.Header.Get("Retry-After")), resp.Status)
+		default:
+			body := string(bytes)
+			if len(body) > 200 {
+				body = body[:200] + "..."
+			}
+			return nil, errors.Errorf("uNoGS returned %s: %s", resp.Status, body)
+		}
+	}
+}
+
+// retryAfter waits before the next attempt: as long as the server asked
+// for, or otherwise an exponential backoff with jitter.
+func (p *unogsProvider) retryAfter(attempt int, delay time.Duration, reason string) {
+	if delay <= 0 {
+		backoff := time.Second << uint(attempt)
+		delay = backoff + time.Duration(rand.Int63n(int64(backoff)))
+	}
+	p.logger.WithField("reason", reason).WithField("attempt", attempt+1).WithField("delay", delay.Round(time.Millisecond)).Warn("retrying uNoGS request")
+	time.Sleep(delay)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. It returns 0 when there's no usable value.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// key returns the index of the API key in use.
+func (p *unogsProvider) key() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+// nextKey moves on from the key at index used, unless a concurrent lookup
+// already has. It returns false when there are no keys left.
+func (p *unogsProvider) nextKey(used int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current != used {
+		return true
+	}
+	if p.current+1 >= len(p.apiKeys) {
+		return false
+	}
+	p.current++
+	p.logger.WithField("key", p.current+1).WithField("keys", len(p.apiKeys)).Warn("RapidAPI key is out of quota, switching to the next one")
+	return true
+}
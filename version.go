@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// These are set at build time with, for example:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+func userAgent() string {
+	return fmt.Sprintf("plex2netflix/%s (%s)", version, commit)
+}
+
+func versionString() string {
+	return fmt.Sprintf("plex2netflix %s (commit %s, built %s, %s %s/%s)", version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// httpClient is used for every outbound request so that they all identify
+// the plex2netflix build in their User-Agent.
+var httpClient = &http.Client{Transport: userAgentTransport{userAgent(), http.DefaultTransport}}
+
+type userAgentTransport struct {
+	agent string
+	next  http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.agent)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// plexDiscoverURL serves the plex.tv account's watchlist, which lives outside
+// any Plex Media Server.
+const plexDiscoverURL = "https://discover.provider.plex.tv"
+
+type plexWatchlist struct {
+	token string
+}
+
+// items returns the movies and shows on the account's watchlist.
+func (w *plexWatchlist) items() ([]mediaItem, error) {
+	var items []mediaItem
+	for {
+		params := url.Values{}
+		params.Set("X-Plex-Container-Start", strconv.Itoa(len(items)))
+		params.Set("X-Plex-Container-Size", strconv.Itoa(plexPageSize))
+		var content plexLibraryContent
+		if err := w.do("GET", "/library/sections/watchlist/all?"+params.Encode(), &content); err != nil {
+			return nil, errors.Wrap(err, "getting watchlist")
+		}
+		for _, m := range content.MediaContainer.Metadata {
+			items = append(items, mediaItem{
+				Section:   "Plex Watchlist",
+				RatingKey: m.RatingKey,
+				GUID:      m.GUID,
+				Type:      m.Type,
+				Title:     m.Title,
+				Year:      m.Year,
+			})
+		}
+		if len(content.MediaContainer.Metadata) == 0 || len(items) >= content.MediaContainer.TotalSize {
+			return items, nil
+		}
+	}
+}
+
+func (w *plexWatchlist) remove(item mediaItem) error {
+	return w.do("PUT", "/actions/removeFromWatchlist?ratingKey="+url.QueryEscape(item.RatingKey), nil)
+}
+
+func (w *plexWatchlist) do(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, plexDiscoverURL+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Token", w.token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling plex.tv")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("plex.tv returned %s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "decoding plex.tv response")
+}
+
+// removeStreamable takes every found item off the watchlist, so that what's
+// left is what still needs to be sourced.
+func (w *plexWatchlist) removeStreamable(logger *logrus.Logger, cfg *config, activity *activityLog, results []checkResult) {
+	for _, result := range allowedResults(logger, cfg, actionWatchlistRemove, results) {
+		if err := w.remove(result.Item); err != nil {
+			logger.WithField("error", err).WithField("title", result.Item.Title).Error("removing from watchlist")
+			continue
+		}
+		logger.WithField("title", result.Item.Title).Info("removed from watchlist")
+		activity.recordAction(actionWatchlistRemove, result.Item)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookConfig restricts who may post webhooks to the listener.
+type webhookConfig struct {
+	// AllowedSources are IP addresses or CIDR ranges webhooks are accepted
+	// from, e.g. the Plex server's address. Any source is allowed when empty.
+	AllowedSources []string `json:"allowed_sources"`
+}
+
+// webhookVerifier rejects webhook posts that don't carry the shared secret or
+// don't come from an allowed source. Plex can't sign its webhooks, so the
+// secret is passed in the webhook URL configured in Plex, e.g.
+// http://host:port/webhook?token=<WEBHOOK_SECRET>. It can also be sent in an
+// X-Webhook-Secret header by clients that support custom headers.
+type webhookVerifier struct {
+	logger  *logrus.Logger
+	secret  string
+	allowed []*net.IPNet
+}
+
+func newWebhookVerifier(logger *logrus.Logger, cfg webhookConfig, secret string) (*webhookVerifier, error) {
+	v := &webhookVerifier{logger: logger, secret: secret}
+	for _, source := range cfg.AllowedSources {
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing allowed webhook source %q", source)
+		}
+		v.allowed = append(v.allowed, network)
+	}
+	return v, nil
+}
+
+func (v *webhookVerifier) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !v.allowedSource(r) {
+			v.logger.WithField("remote", r.RemoteAddr).Warn("rejecting webhook from a source that isn't allowed")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if !v.validSecret(r) {
+			v.logger.WithField("remote", r.RemoteAddr).Warn("rejecting webhook without a valid secret")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *webhookVerifier) allowedSource(r *http.Request) bool {
+	if len(v.allowed) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range v.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *webhookVerifier) validSecret(r *http.Request) bool {
+	if v.secret == "" {
+		return true
+	}
+	given := r.Header.Get("X-Webhook-Secret")
+	if given == "" {
+		given = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(v.secret)) == 1
+}
+
+// plexWebhook is the part of a Plex webhook payload plex2netflix uses. Its
+// metadata is shaped like the library API's.
+type plexWebhook struct {
+	Event    string `json:"event"`
+	Metadata struct {
+		plexMetadata
+		LibrarySectionID    int    `json:"librarySectionID"`
+		LibrarySectionTitle string `json:"librarySectionTitle"`
+		ParentTitle         string `json:"parentTitle"`
+		ParentGUID          string `json:"parentGuid"`
+		GrandparentTitle    string `json:"grandparentTitle"`
+		GrandparentGUID     string `json:"grandparentGuid"`
+	} `json:"Metadata"`
+}
+
+// item returns the movie or show the webhook is about, which for a season or
+// episode is its show, and whether it's a show that got new episodes rather
+// than a new title.
+func (hook plexWebhook) item() (item mediaItem, episodes, ok bool) {
+	m := hook.Metadata
+	item = mediaItem{Section: m.LibrarySectionTitle, Type: "show"}
+	switch m.Type {
+	case "movie", "show":
+		imdbID, tmdbID, tvdbID := m.externalIDs()
+		item = mediaItem{
+			Section:   m.LibrarySectionTitle,
+			RatingKey: m.RatingKey,
+			GUID:      m.GUID,
+			IMDbID:    imdbID,
+			TMDBID:    tmdbID,
+			TVDBID:    tvdbID,
+			Type:      m.Type,
+			Title:     m.Title,
+			Year:      m.Year,
+			Thumb:     m.Thumb,
+		}
+	case "season":
+		item.RatingKey, item.GUID, item.Title, episodes = m.ParentRatingKey, m.ParentGUID, m.ParentTitle, true
+	case "episode":
+		item.RatingKey, item.GUID, item.Title, episodes = m.GrandparentRatingKey, m.GrandparentGUID, m.GrandparentTitle, true
+	default:
+		return item, false, false
+	}
+	return item, episodes, item.Title != ""
+}